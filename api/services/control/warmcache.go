@@ -0,0 +1,125 @@
+package moby_buildkit_v1
+
+import (
+	context "context"
+	fmt "fmt"
+
+	grpc "google.golang.org/grpc"
+)
+
+// The CacheWarming service pre-populates the daemon cache with the layers of
+// an image. The wire schema is defined in warmcache.proto; the bindings below
+// are maintained by hand until the proto toolchain is re-run over this
+// package.
+
+// WarmCacheRequest asks the daemon to pre-pull an image's layers
+type WarmCacheRequest struct {
+	Ref       string   `protobuf:"bytes,1,opt,name=ref,proto3" json:"ref,omitempty"`
+	Platforms []string `protobuf:"bytes,2,rep,name=platforms,proto3" json:"platforms,omitempty"`
+	// Depth controls how many manifest history levels to warm. Zero warms
+	// the full image.
+	Depth int64 `protobuf:"varint,3,opt,name=depth,proto3" json:"depth,omitempty"`
+}
+
+func (m *WarmCacheRequest) Reset()         { *m = WarmCacheRequest{} }
+func (m *WarmCacheRequest) String() string { return fmt.Sprintf("&WarmCacheRequest{%+v}", *m) }
+func (*WarmCacheRequest) ProtoMessage()    {}
+
+// WarmCacheResponse reports progress for a single warmed platform
+type WarmCacheResponse struct {
+	Platform string `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Done     bool   `protobuf:"varint,2,opt,name=done,proto3" json:"done,omitempty"`
+}
+
+func (m *WarmCacheResponse) Reset()         { *m = WarmCacheResponse{} }
+func (m *WarmCacheResponse) String() string { return fmt.Sprintf("&WarmCacheResponse{%+v}", *m) }
+func (*WarmCacheResponse) ProtoMessage()    {}
+
+// CacheWarmingServer is the server API for the CacheWarming service
+type CacheWarmingServer interface {
+	WarmCache(*WarmCacheRequest, CacheWarming_WarmCacheServer) error
+}
+
+type CacheWarming_WarmCacheServer interface {
+	Send(*WarmCacheResponse) error
+	grpc.ServerStream
+}
+
+type cacheWarmingWarmCacheServer struct {
+	grpc.ServerStream
+}
+
+func (x *cacheWarmingWarmCacheServer) Send(m *WarmCacheResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func RegisterCacheWarmingServer(s *grpc.Server, srv CacheWarmingServer) {
+	s.RegisterService(&_CacheWarming_serviceDesc, srv)
+}
+
+func _CacheWarming_WarmCache_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WarmCacheRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CacheWarmingServer).WarmCache(m, &cacheWarmingWarmCacheServer{stream})
+}
+
+var _CacheWarming_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "moby.buildkit.v1.CacheWarming",
+	HandlerType: (*CacheWarmingServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WarmCache",
+			Handler:       _CacheWarming_WarmCache_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "github.com/moby/buildkit/api/services/control/warmcache.proto",
+}
+
+// CacheWarmingClient is the client API for the CacheWarming service
+type CacheWarmingClient interface {
+	WarmCache(ctx context.Context, in *WarmCacheRequest, opts ...grpc.CallOption) (CacheWarming_WarmCacheClient, error)
+}
+
+type cacheWarmingClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCacheWarmingClient(cc *grpc.ClientConn) CacheWarmingClient {
+	return &cacheWarmingClient{cc}
+}
+
+type CacheWarming_WarmCacheClient interface {
+	Recv() (*WarmCacheResponse, error)
+	grpc.ClientStream
+}
+
+type cacheWarmingWarmCacheClient struct {
+	grpc.ClientStream
+}
+
+func (x *cacheWarmingWarmCacheClient) Recv() (*WarmCacheResponse, error) {
+	m := new(WarmCacheResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cacheWarmingClient) WarmCache(ctx context.Context, in *WarmCacheRequest, opts ...grpc.CallOption) (CacheWarming_WarmCacheClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CacheWarming_serviceDesc.Streams[0], "/moby.buildkit.v1.CacheWarming/WarmCache", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cacheWarmingWarmCacheClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
@@ -0,0 +1,66 @@
+package moby_buildkit_v1
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type stubCacheWarmingServer struct {
+	req *WarmCacheRequest
+}
+
+func (s *stubCacheWarmingServer) WarmCache(req *WarmCacheRequest, stream CacheWarming_WarmCacheServer) error {
+	s.req = req
+	for _, p := range req.Platforms {
+		if err := stream.Send(&WarmCacheResponse{Platform: p, Done: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestCacheWarmingRoundTrip verifies the hand-maintained message bindings
+// survive a real gRPC round trip.
+func TestCacheWarmingRoundTrip(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	stub := &stubCacheWarmingServer{}
+	RegisterCacheWarmingServer(srv, stub)
+	go srv.Serve(l) //nolint:errcheck
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := NewCacheWarmingClient(conn)
+	stream, err := client.WarmCache(context.TODO(), &WarmCacheRequest{
+		Ref:       "docker.io/library/alpine:3.19",
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+		Depth:     2,
+	})
+	require.NoError(t, err)
+
+	var got []string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.True(t, resp.Done)
+		got = append(got, resp.Platform)
+	}
+	require.Equal(t, []string{"linux/amd64", "linux/arm64"}, got)
+
+	require.Equal(t, "docker.io/library/alpine:3.19", stub.req.Ref)
+	require.Equal(t, int64(2), stub.req.Depth)
+}
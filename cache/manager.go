@@ -1020,6 +1020,38 @@ func (cm *cacheManager) Prune(ctx context.Context, ch chan client.UsageInfo, opt
 	return nil
 }
 
+// PruneWithPolicy prunes the cache down to keepBytes, choosing eviction
+// candidates by the given policy instead of the default combined
+// recency/frequency ordering.
+func (cm *cacheManager) PruneWithPolicy(ctx context.Context, ch chan client.UsageInfo, policy PrunePolicy, keepBytes int64) error {
+	cm.muPrune.Lock()
+	defer cm.muPrune.Unlock()
+
+	totalSize := int64(0)
+	du, err := cm.DiskUsage(ctx, client.DiskUsageInfo{})
+	if err != nil {
+		return err
+	}
+	for _, ui := range du {
+		if ui.Shared {
+			continue
+		}
+		totalSize += ui.Size
+	}
+
+	filter, err := filters.ParseAll()
+	if err != nil {
+		return err
+	}
+
+	return cm.prune(ctx, ch, pruneOpt{
+		filter:    filter,
+		keepBytes: keepBytes,
+		totalSize: totalSize,
+		policy:    policy,
+	})
+}
+
 func (cm *cacheManager) pruneOnce(ctx context.Context, ch chan client.UsageInfo, opt client.PruneInfo) error {
 	filter, err := filters.ParseAll(opt.Filter...)
 	if err != nil {
@@ -1056,6 +1088,7 @@ func (cm *cacheManager) pruneOnce(ctx context.Context, ch chan client.UsageInfo,
 		keepDuration: opt.KeepDuration,
 		keepBytes:    opt.KeepBytes,
 		totalSize:    totalSize,
+		dryRun:       opt.DryRun,
 	})
 }
 
@@ -1143,11 +1176,53 @@ func (cm *cacheManager) prune(ctx context.Context, ch chan client.UsageInfo, opt
 	batchSize := len(toDelete)
 	if gcMode && len(toDelete) > 0 {
 		batchSize = 1
-		sortDeleteRecords(toDelete)
+		sortDeleteRecords(toDelete, opt.policy)
 	} else if batchSize > maxPruneBatch {
 		batchSize = maxPruneBatch
 	}
 
+	if opt.dryRun {
+		// report the removal candidates without mutating any record. In
+		// gcMode the real prune deletes in sortDeleteRecords order (applied
+		// above) and stops as soon as the total drops below keepBytes, so
+		// the simulation applies the same size accounting to avoid
+		// overstating the result.
+		simulatedTotal := opt.totalSize
+		infos := make([]client.UsageInfo, 0, len(toDelete))
+		for _, cr := range toDelete {
+			if gcMode && simulatedTotal < opt.keepBytes {
+				break
+			}
+			usageCount, lastUsedAt := cr.getLastUsed()
+			c := client.UsageInfo{
+				ID:          cr.ID(),
+				Mutable:     cr.mutable,
+				Size:        cr.getSize(),
+				CreatedAt:   cr.GetCreatedAt(),
+				Description: cr.GetDescription(),
+				LastUsedAt:  lastUsedAt,
+				UsageCount:  usageCount,
+				RecordType:  cr.GetRecordType(),
+			}
+			if c.Size == sizeUnknown && cr.equalImmutable != nil {
+				c.Size = cr.equalImmutable.getSize()
+			}
+			if c.Size != sizeUnknown {
+				simulatedTotal -= c.Size
+			}
+			infos = append(infos, c)
+		}
+		for _, cr := range toDelete {
+			cr.mu.Unlock()
+			cr.released = true
+		}
+		cm.mu.Unlock()
+		for _, c := range infos {
+			ch <- c
+		}
+		return nil
+	}
+
 	releaseLocks := func() {
 		for _, cr := range toDelete {
 			if !cr.released {
@@ -1608,6 +1683,56 @@ type pruneOpt struct {
 	keepDuration time.Duration
 	keepBytes    int64
 	totalSize    int64
+	policy       PrunePolicy
+	dryRun       bool
+}
+
+// PrunePolicy orders prune candidates; records with lower scores are evicted
+// first.
+type PrunePolicy interface {
+	Name() string
+	// Score rates a candidate based on when it was last used and how often
+	// it has been used.
+	Score(lastUsedAt *time.Time, usageCount int) float64
+}
+
+// LRUPolicy evicts the least recently used records first, regardless of how
+// often they were used.
+type LRUPolicy struct{}
+
+func (LRUPolicy) Name() string { return "lru" }
+
+func (LRUPolicy) Score(lastUsedAt *time.Time, usageCount int) float64 {
+	if lastUsedAt == nil {
+		return 0
+	}
+	return float64(lastUsedAt.UnixNano())
+}
+
+// LFUPolicy evicts the least frequently used records first, keeping popular
+// layers even when they haven't been touched recently.
+type LFUPolicy struct{}
+
+func (LFUPolicy) Name() string { return "lfu" }
+
+func (LFUPolicy) Score(lastUsedAt *time.Time, usageCount int) float64 {
+	return float64(usageCount)
+}
+
+// TinyLFUPolicy approximates TinyLFU by combining recency and frequency.
+// A nil policy in pruneOpt selects the equivalent rank-normalized default.
+type TinyLFUPolicy struct{}
+
+func (TinyLFUPolicy) Name() string { return "tinylfu" }
+
+func (TinyLFUPolicy) Score(lastUsedAt *time.Time, usageCount int) float64 {
+	var recency float64
+	if lastUsedAt != nil {
+		recency = float64(lastUsedAt.UnixNano())
+	}
+	// normalize the epoch offset down so the frequency component is not
+	// drowned out
+	return recency/float64(time.Hour.Nanoseconds()) + float64(usageCount)
 }
 
 type deleteRecord struct {
@@ -1619,7 +1744,15 @@ type deleteRecord struct {
 	released        bool
 }
 
-func sortDeleteRecords(toDelete []*deleteRecord) {
+func sortDeleteRecords(toDelete []*deleteRecord, policy PrunePolicy) {
+	if policy != nil {
+		sort.Slice(toDelete, func(i, j int) bool {
+			return policy.Score(toDelete[i].lastUsedAt, toDelete[i].usageCount) <
+				policy.Score(toDelete[j].lastUsedAt, toDelete[j].usageCount)
+		})
+		return
+	}
+
 	sort.Slice(toDelete, func(i, j int) bool {
 		if toDelete[i].lastUsedAt == nil {
 			return true
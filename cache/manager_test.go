@@ -2709,3 +2709,121 @@ func isReadOnly(mnt mount.Mount) bool {
 	}
 	return false
 }
+
+func TestPruneDryRun(t *testing.T) {
+	t.Parallel()
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, snapshotter.Close())
+	})
+
+	co, cleanup, err := newCacheManager(ctx, t, cmOpt{
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+	})
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+
+	cm := co.manager
+
+	active, err := cm.New(ctx, nil, nil, CachePolicyRetain)
+	require.NoError(t, err)
+	snap, err := active.Commit(ctx)
+	require.NoError(t, err)
+	require.NoError(t, snap.Release(ctx))
+
+	checkDiskUsage(ctx, t, cm, 0, 1)
+
+	// dry run reports the candidate but deletes nothing
+	buf := pruneResultBuffer()
+	err = cm.Prune(ctx, buf.C, client.PruneInfo{DryRun: true})
+	buf.close()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(buf.all))
+
+	checkDiskUsage(ctx, t, cm, 0, 1)
+	dirs, err := os.ReadDir(filepath.Join(tmpdir, "snapshots/snapshots"))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(dirs))
+
+	// a real prune after the dry run still removes the record
+	buf = pruneResultBuffer()
+	err = cm.Prune(ctx, buf.C, client.PruneInfo{})
+	buf.close()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(buf.all))
+	checkDiskUsage(ctx, t, cm, 0, 0)
+}
+
+func TestPruneDryRunKeepBytes(t *testing.T) {
+	t.Parallel()
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, snapshotter.Close())
+	})
+
+	co, cleanup, err := newCacheManager(ctx, t, cmOpt{
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+	})
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+
+	cm := co.manager
+
+	// create three independent unreferenced records with known sizes
+	for i := 0; i < 3; i++ {
+		active, err := cm.New(ctx, nil, nil, CachePolicyRetain)
+		require.NoError(t, err)
+		m, err := active.Mount(ctx, false, nil)
+		require.NoError(t, err)
+		lm := snapshot.LocalMounter(m)
+		target, err := lm.Mount()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(target, "data"), make([]byte, 8192), 0600))
+		require.NoError(t, lm.Unmount())
+		snap, err := active.Commit(ctx)
+		require.NoError(t, err)
+		require.NoError(t, snap.Release(ctx))
+	}
+
+	du, err := cm.DiskUsage(ctx, client.DiskUsageInfo{})
+	require.NoError(t, err)
+	totalSize := int64(0)
+	for _, ui := range du {
+		totalSize += ui.Size
+	}
+	require.Equal(t, 3, len(du))
+
+	// keep enough bytes that a real prune would only delete some records:
+	// the dry run must stop reporting at the same point instead of listing
+	// every candidate
+	keepBytes := totalSize * 2 / 3
+	buf := pruneResultBuffer()
+	err = cm.Prune(ctx, buf.C, client.PruneInfo{DryRun: true, KeepBytes: keepBytes})
+	buf.close()
+	require.NoError(t, err)
+	dryRunCount := len(buf.all)
+	require.Greater(t, dryRunCount, 0)
+	require.Less(t, dryRunCount, 3, "dry run must not list records a real prune would keep")
+
+	// nothing was deleted
+	checkDiskUsage(ctx, t, cm, 0, 3)
+
+	// the real prune with the same limit removes the same number of records
+	buf = pruneResultBuffer()
+	err = cm.Prune(ctx, buf.C, client.PruneInfo{KeepBytes: keepBytes})
+	buf.close()
+	require.NoError(t, err)
+	require.Equal(t, dryRunCount, len(buf.all))
+}
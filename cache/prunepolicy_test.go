@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrunePolicyOrdering(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+
+	// old but popular vs recent but rarely used
+	popular := &deleteRecord{lastUsedAt: &old, usageCount: 100}
+	rare := &deleteRecord{lastUsedAt: &recent, usageCount: 1}
+
+	toDelete := []*deleteRecord{popular, rare}
+	sortDeleteRecords(toDelete, LRUPolicy{})
+	require.Same(t, popular, toDelete[0], "LRU evicts the older record first")
+
+	toDelete = []*deleteRecord{popular, rare}
+	sortDeleteRecords(toDelete, LFUPolicy{})
+	require.Same(t, rare, toDelete[0], "LFU evicts the rarely used record first")
+
+	toDelete = []*deleteRecord{popular, rare}
+	sortDeleteRecords(toDelete, TinyLFUPolicy{})
+	require.Same(t, rare, toDelete[0], "TinyLFU keeps frequently used records despite their age")
+
+	// nil policy keeps the default rank-normalized ordering and doesn't panic
+	toDelete = []*deleteRecord{popular, rare}
+	sortDeleteRecords(toDelete, nil)
+	require.Len(t, toDelete, 2)
+}
+
+func BenchmarkSortDeleteRecords(b *testing.B) {
+	mk := func(n int) []*deleteRecord {
+		out := make([]*deleteRecord, n)
+		for i := range out {
+			ts := time.Now().Add(-time.Duration(i) * time.Minute)
+			out[i] = &deleteRecord{lastUsedAt: &ts, usageCount: i % 17}
+		}
+		return out
+	}
+	for _, policy := range []PrunePolicy{nil, LRUPolicy{}, LFUPolicy{}, TinyLFUPolicy{}} {
+		name := "default"
+		if policy != nil {
+			name = policy.Name()
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sortDeleteRecords(mk(1000), policy)
+			}
+		})
+	}
+}
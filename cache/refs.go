@@ -602,6 +602,12 @@ func (l RefList) Release(ctx context.Context) (rerr error) {
 	return rerr
 }
 
+// Size returns the storage size of the ref's snapshot, computing it via the
+// snapshotter when it isn't cached in the metadata yet.
+func (sr *immutableRef) Size(ctx context.Context) (int64, error) {
+	return sr.cacheRecord.size(ctx)
+}
+
 func (sr *immutableRef) LayerChain() RefList {
 	chain := sr.layerChain()
 	l := RefList(make([]ImmutableRef, len(chain)))
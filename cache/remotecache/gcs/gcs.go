@@ -0,0 +1,610 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/labels"
+	"github.com/moby/buildkit/cache/remotecache"
+	"github.com/moby/buildkit/cache/remotecache/s3"
+	v1 "github.com/moby/buildkit/cache/remotecache/v1"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/compression"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/worker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	attrBucket             = "bucket"
+	attrPrefix             = "prefix"
+	attrManifestsPrefix    = "manifests_prefix"
+	attrBlobsPrefix        = "blobs_prefix"
+	attrName               = "name"
+	attrEndpointURL        = "endpoint_url"
+	attrToken              = "token"
+	attrHMACAccessKeyID    = "hmac_access_key_id"
+	attrHMACSecret         = "hmac_secret_access_key"
+	attrResumableThreshold = "resumable_threshold"
+
+	defaultEndpoint = "https://storage.googleapis.com"
+	metadataToken   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token" //nolint:gosec // not a credential
+)
+
+// Config holds the GCS cache backend configuration. It mirrors the S3
+// backend's structure with GCS-specific options.
+type Config struct {
+	Bucket             string
+	Prefix             string
+	ManifestsPrefix    string
+	BlobsPrefix        string
+	Names              []string
+	EndpointURL        string
+	Token              string
+	HMACAccessKeyID    string
+	HMACSecret         string
+	ResumableThreshold int64
+}
+
+// Option configures the GCS cache backend
+type Option func(*Config)
+
+// WithGCSCacheOptions applies the options on top of the attribute-derived
+// configuration.
+func WithGCSCacheOptions(opts ...Option) func(Config) Config {
+	return func(c Config) Config {
+		for _, o := range opts {
+			o(&c)
+		}
+		return c
+	}
+}
+
+// WithBucket sets the bucket name
+func WithBucket(bucket string) Option {
+	return func(c *Config) { c.Bucket = bucket }
+}
+
+// WithPrefix sets the object name prefix
+func WithPrefix(prefix string) Option {
+	return func(c *Config) { c.Prefix = prefix }
+}
+
+// WithEndpoint overrides the storage endpoint, e.g. for fake-gcs-server
+func WithEndpoint(endpoint string) Option {
+	return func(c *Config) { c.EndpointURL = endpoint }
+}
+
+// WithResumableThreshold sets the object size above which resumable uploads
+// are used.
+func WithResumableThreshold(size int64) Option {
+	return func(c *Config) { c.ResumableThreshold = size }
+}
+
+func getConfig(attrs map[string]string) (Config, error) {
+	bucket, ok := attrs[attrBucket]
+	if !ok {
+		bucket, ok = os.LookupEnv("GCS_BUCKET")
+		if !ok {
+			return Config{}, errors.Errorf("bucket ($GCS_BUCKET) not set for gcs cache")
+		}
+	}
+	manifestsPrefix, ok := attrs[attrManifestsPrefix]
+	if !ok {
+		manifestsPrefix = "manifests/"
+	}
+	blobsPrefix, ok := attrs[attrBlobsPrefix]
+	if !ok {
+		blobsPrefix = "blobs/"
+	}
+	names := []string{"buildkit"}
+	if name, ok := attrs[attrName]; ok {
+		if splitNames := strings.Split(name, ";"); len(splitNames) > 0 {
+			names = splitNames
+		}
+	}
+	resumableThreshold := int64(16 * 1024 * 1024)
+	if v, ok := attrs[attrResumableThreshold]; ok {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, errors.Errorf("resumable_threshold must be a number")
+		}
+		resumableThreshold = size
+	}
+	return Config{
+		Bucket:             bucket,
+		Prefix:             attrs[attrPrefix],
+		ManifestsPrefix:    manifestsPrefix,
+		BlobsPrefix:        blobsPrefix,
+		Names:              names,
+		EndpointURL:        attrs[attrEndpointURL],
+		Token:              attrs[attrToken],
+		HMACAccessKeyID:    attrs[attrHMACAccessKeyID],
+		HMACSecret:         attrs[attrHMACSecret],
+		ResumableThreshold: resumableThreshold,
+	}, nil
+}
+
+// hmacS3Attrs maps the GCS configuration onto the S3 backend attributes for
+// HMAC-key authentication, which goes through the S3-interoperable XML API.
+func hmacS3Attrs(attrs map[string]string, config Config) map[string]string {
+	endpoint := config.EndpointURL
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	out := map[string]string{
+		"bucket":            config.Bucket,
+		"region":            "auto",
+		"prefix":            config.Prefix,
+		"manifests_prefix":  config.ManifestsPrefix,
+		"blobs_prefix":      config.BlobsPrefix,
+		"endpoint_url":      endpoint,
+		"use_path_style":    "true",
+		"access_key_id":     config.HMACAccessKeyID,
+		"secret_access_key": config.HMACSecret,
+	}
+	if name, ok := attrs[attrName]; ok {
+		out["name"] = name
+	}
+	return out
+}
+
+// ResolveCacheExporterFunc for "gcs" cache exporter.
+func ResolveCacheExporterFunc() remotecache.ResolveCacheExporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Exporter, error) {
+		config, err := getConfig(attrs)
+		if err != nil {
+			return nil, err
+		}
+		if config.HMACAccessKeyID != "" {
+			return s3.ResolveCacheExporterFunc()(ctx, g, hmacS3Attrs(attrs, config))
+		}
+		client, err := newGCSClient(config)
+		if err != nil {
+			return nil, err
+		}
+		cc := v1.NewCacheChains()
+		return &exporter{CacheExporterTarget: cc, chains: cc, client: client, config: config}, nil
+	}
+}
+
+// ResolveCacheImporterFunc for "gcs" cache importer.
+func ResolveCacheImporterFunc() remotecache.ResolveCacheImporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Importer, ocispecs.Descriptor, error) {
+		config, err := getConfig(attrs)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		if config.HMACAccessKeyID != "" {
+			return s3.ResolveCacheImporterFunc()(ctx, g, hmacS3Attrs(attrs, config))
+		}
+		client, err := newGCSClient(config)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		return &importer{client: client, config: config}, ocispecs.Descriptor{}, nil
+	}
+}
+
+type exporter struct {
+	solver.CacheExporterTarget
+	chains *v1.CacheChains
+	client *gcsClient
+	config Config
+}
+
+func (*exporter) Name() string {
+	return "exporting cache to Google Cloud Storage"
+}
+
+func (e *exporter) Config() remotecache.Config {
+	return remotecache.Config{
+		Compression: compression.New(compression.Default),
+	}
+}
+
+func (e *exporter) Finalize(ctx context.Context) (map[string]string, error) {
+	cacheConfig, descs, err := e.chains.Marshal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range cacheConfig.Layers {
+		dgstPair, ok := descs[l.Blob]
+		if !ok {
+			return nil, errors.Errorf("missing blob %s", l.Blob)
+		}
+		if dgstPair.Descriptor.Annotations == nil {
+			return nil, errors.Errorf("invalid descriptor without annotations")
+		}
+		v, ok := dgstPair.Descriptor.Annotations[labels.LabelUncompressed]
+		if !ok {
+			return nil, errors.Errorf("invalid descriptor without uncompressed annotation")
+		}
+		diffID, err := digest.Parse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse uncompressed annotation")
+		}
+
+		key := e.client.blobKey(dgstPair.Descriptor.Digest)
+		exists, err := e.client.exists(ctx, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check blob presence in cache")
+		}
+		if !exists {
+			layerDone := progress.OneOff(ctx, fmt.Sprintf("writing layer %s", l.Blob))
+			dt, err := content.ReadBlob(ctx, dgstPair.Provider, dgstPair.Descriptor)
+			if err != nil {
+				return nil, layerDone(err)
+			}
+			if err := e.client.save(ctx, key, dt); err != nil {
+				return nil, layerDone(errors.Wrap(err, "error writing layer blob"))
+			}
+			layerDone(nil)
+		}
+
+		la := &v1.LayerAnnotations{
+			DiffID:    diffID,
+			Size:      dgstPair.Descriptor.Size,
+			MediaType: dgstPair.Descriptor.MediaType,
+		}
+		if v, ok := dgstPair.Descriptor.Annotations["buildkit/createdat"]; ok {
+			var t time.Time
+			if err := (&t).UnmarshalText([]byte(v)); err != nil {
+				return nil, err
+			}
+			la.CreatedAt = t.UTC()
+		}
+		cacheConfig.Layers[i].Annotations = la
+	}
+
+	dt, err := json.Marshal(cacheConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range e.config.Names {
+		if err := e.client.save(ctx, e.client.manifestKey(name), dt); err != nil {
+			return nil, errors.Wrapf(err, "error writing manifest %s", name)
+		}
+	}
+	return nil, nil
+}
+
+type importer struct {
+	client *gcsClient
+	config Config
+}
+
+func (i *importer) makeDescriptorProviderPair(l v1.CacheLayer) (*v1.DescriptorProviderPair, error) {
+	if l.Annotations == nil {
+		return nil, errors.Errorf("cache layer with missing annotations")
+	}
+	if l.Annotations.DiffID == "" {
+		return nil, errors.Errorf("cache layer with missing diffid")
+	}
+	annotations := map[string]string{}
+	annotations[labels.LabelUncompressed] = l.Annotations.DiffID.String()
+	if !l.Annotations.CreatedAt.IsZero() {
+		txt, err := l.Annotations.CreatedAt.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		annotations["buildkit/createdat"] = string(txt)
+	}
+	return &v1.DescriptorProviderPair{
+		Provider: i.client,
+		Descriptor: ocispecs.Descriptor{
+			MediaType:   l.Annotations.MediaType,
+			Digest:      l.Blob,
+			Size:        l.Annotations.Size,
+			Annotations: annotations,
+		},
+	}, nil
+}
+
+func (i *importer) load(ctx context.Context) (*v1.CacheChains, error) {
+	dt, ok, err := i.client.get(ctx, i.client.manifestKey(i.config.Names[0]))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return v1.NewCacheChains(), nil
+	}
+	var config v1.CacheConfig
+	if err := json.Unmarshal(dt, &config); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	allLayers := v1.DescriptorProvider{}
+	for _, l := range config.Layers {
+		dpp, err := i.makeDescriptorProviderPair(l)
+		if err != nil {
+			return nil, err
+		}
+		allLayers[l.Blob] = *dpp
+	}
+
+	cc := v1.NewCacheChains()
+	if err := v1.ParseConfig(config, allLayers, cc); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+func (i *importer) Resolve(ctx context.Context, _ ocispecs.Descriptor, id string, w worker.Worker) (solver.CacheManager, error) {
+	cc, err := i.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keysStorage, resultStorage, err := v1.NewCacheKeyStorage(cc, w)
+	if err != nil {
+		return nil, err
+	}
+	return solver.NewCacheManager(ctx, id, keysStorage, resultStorage), nil
+}
+
+// gcsClient talks to the GCS JSON API with bearer-token authentication
+// (explicit token or Application Default Credentials via the metadata
+// server).
+type gcsClient struct {
+	httpClient         *http.Client
+	endpoint           string
+	bucket             string
+	prefix             string
+	blobsPrefix        string
+	manifestsPrefix    string
+	resumableThreshold int64
+
+	tokenMu     sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	staticToken bool
+}
+
+func newGCSClient(config Config) (*gcsClient, error) {
+	endpoint := config.EndpointURL
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	token := config.Token
+	if token == "" {
+		token = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	return &gcsClient{
+		httpClient:         &http.Client{},
+		endpoint:           strings.TrimSuffix(endpoint, "/"),
+		bucket:             config.Bucket,
+		prefix:             config.Prefix,
+		blobsPrefix:        config.BlobsPrefix,
+		manifestsPrefix:    config.ManifestsPrefix,
+		resumableThreshold: config.ResumableThreshold,
+		token:              token,
+		staticToken:        token != "",
+	}, nil
+}
+
+func (c *gcsClient) blobKey(dgst digest.Digest) string {
+	return c.prefix + c.blobsPrefix + dgst.String()
+}
+
+func (c *gcsClient) manifestKey(name string) string {
+	return c.prefix + c.manifestsPrefix + name
+}
+
+// accessToken returns a bearer token, refreshing it from the metadata server
+// when no static token is configured (Application Default Credentials on
+// GCE/GKE, including workload identity).
+func (c *gcsClient) accessToken(ctx context.Context) (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.staticToken || (c.token != "" && time.Until(c.tokenExpiry) > time.Minute) {
+		return c.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataToken, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get token from metadata server")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("metadata server returned status %d", resp.StatusCode)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", errors.WithStack(err)
+	}
+	c.token = tok.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+func (c *gcsClient) do(req *http.Request) (*http.Response, error) {
+	token, err := c.accessToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.httpClient.Do(req)
+}
+
+func (c *gcsClient) objectURL(key string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", c.endpoint, url.PathEscape(c.bucket), url.PathEscape(key))
+}
+
+// exists checks object presence
+func (c *gcsClient) exists(ctx context.Context, key string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(key), nil)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.Errorf("unexpected status %d checking %s", resp.StatusCode, key)
+	}
+}
+
+// get downloads the object contents, reporting false when it doesn't exist
+func (c *gcsClient) get(ctx context.Context, key string) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, errors.Errorf("unexpected status %d reading %s", resp.StatusCode, key)
+	}
+	dt, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return dt, true, nil
+}
+
+// save uploads the object, using the resumable upload protocol for payloads
+// above the configured threshold.
+func (c *gcsClient) save(ctx context.Context, key string, dt []byte) error {
+	if int64(len(dt)) >= c.resumableThreshold {
+		return c.saveResumable(ctx, key, dt)
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", c.endpoint, url.PathEscape(c.bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(dt))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %d writing %s", resp.StatusCode, key)
+	}
+	return nil
+}
+
+// saveResumable initiates a resumable upload session and streams the payload
+// to the returned session URL.
+func (c *gcsClient) saveResumable(ctx context.Context, key string, dt []byte) error {
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s", c.endpoint, url.PathEscape(c.bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("X-Upload-Content-Type", "application/octet-stream")
+	req.Header.Set("X-Upload-Content-Length", strconv.Itoa(len(dt)))
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %d initiating resumable upload for %s", resp.StatusCode, key)
+	}
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return errors.Errorf("resumable upload session for %s has no location", key)
+	}
+
+	put, err := http.NewRequestWithContext(ctx, http.MethodPut, session, bytes.NewReader(dt))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	put.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = c.do(put)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return errors.Errorf("unexpected status %d completing resumable upload for %s", resp.StatusCode, key)
+	}
+	return nil
+}
+
+// ReaderAt implements content.Provider over ranged GETs
+func (c *gcsClient) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	return &readerAt{ctx: ctx, client: c, key: c.blobKey(desc.Digest), size: desc.Size}, nil
+}
+
+type readerAt struct {
+	ctx    context.Context
+	client *gcsClient
+	key    string
+	size   int64
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.client.objectURL(r.key)+"?alt=media", nil)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	resp, err := r.client.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return 0, errors.Errorf("unexpected status %d reading %s", resp.StatusCode, r.key)
+	}
+	n, err := io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *readerAt) Size() int64 {
+	return r.size
+}
+
+func (r *readerAt) Close() error {
+	return nil
+}
@@ -0,0 +1,215 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGCS implements the subset of the GCS JSON API used by gcsClient, in
+// the spirit of fake-gcs-server but embeddable in the test process.
+type fakeGCS struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	sessions map[string]string // session id -> object name
+	tokens   []string          // Authorization headers seen
+	resumed  int               // completed resumable uploads
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{
+		objects:  map[string][]byte{},
+		sessions: map[string]string{},
+	}
+}
+
+func (f *fakeGCS) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.tokens = append(f.tokens, r.Header.Get("Authorization"))
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/upload-session/"):
+			id := strings.TrimPrefix(r.URL.Path, "/upload-session/")
+			name, ok := f.sessions[id]
+			if !ok {
+				http.Error(w, "unknown session", http.StatusNotFound)
+				return
+			}
+			dt, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			f.objects[name] = dt
+			f.resumed++
+			w.WriteHeader(http.StatusOK)
+
+		case strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/"):
+			name := r.URL.Query().Get("name")
+			switch r.URL.Query().Get("uploadType") {
+			case "media":
+				dt, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				f.objects[name] = dt
+				w.WriteHeader(http.StatusOK)
+			case "resumable":
+				id := strconv.Itoa(len(f.sessions))
+				f.sessions[id] = name
+				w.Header().Set("Location", "http://"+r.Host+"/upload-session/"+id)
+				w.WriteHeader(http.StatusOK)
+			default:
+				http.Error(w, "unsupported upload type", http.StatusBadRequest)
+			}
+
+		case strings.HasPrefix(r.URL.Path, "/storage/v1/b/"):
+			parts := strings.SplitN(r.URL.Path, "/o/", 2)
+			if len(parts) != 2 {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			name, err := unescapePath(parts[1])
+			require.NoError(t, err)
+			dt, ok := f.objects[name]
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			if r.URL.Query().Get("alt") != "media" {
+				fmt.Fprintf(w, `{"name":%q,"size":"%d"}`, name, len(dt))
+				return
+			}
+			if rng := r.Header.Get("Range"); rng != "" {
+				var start, end int
+				_, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+				require.NoError(t, err)
+				if end >= len(dt) {
+					end = len(dt) - 1
+				}
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(dt[start : end+1]) //nolint:errcheck
+				return
+			}
+			w.Write(dt) //nolint:errcheck
+
+		default:
+			http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+		}
+	})
+}
+
+func unescapePath(p string) (string, error) {
+	// url.PathEscape escapes "/" as %2F
+	return strings.ReplaceAll(strings.ReplaceAll(p, "%2F", "/"), "%2f", "/"), nil
+}
+
+func newTestClient(t *testing.T, endpoint string, resumableThreshold int64) *gcsClient {
+	client, err := newGCSClient(Config{
+		Bucket:             "cache",
+		BlobsPrefix:        "blobs/",
+		ManifestsPrefix:    "manifests/",
+		Names:              []string{"buildkit"},
+		EndpointURL:        endpoint,
+		Token:              "test-token",
+		ResumableThreshold: resumableThreshold,
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func TestGCSClientSaveAndGet(t *testing.T) {
+	t.Parallel()
+	fake := newFakeGCS()
+	srv := httptest.NewServer(fake.handler(t))
+	defer srv.Close()
+
+	ctx := context.TODO()
+	client := newTestClient(t, srv.URL, 1024)
+
+	// below the threshold: simple media upload
+	small := []byte("small manifest")
+	require.NoError(t, client.save(ctx, client.manifestKey("buildkit"), small))
+	require.Equal(t, 0, fake.resumed)
+
+	dt, ok, err := client.get(ctx, client.manifestKey("buildkit"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, small, dt)
+
+	exists, err := client.exists(ctx, client.manifestKey("buildkit"))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// unknown objects report not found without an error
+	_, ok, err = client.get(ctx, client.manifestKey("other"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	exists, err = client.exists(ctx, client.manifestKey("other"))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// the bearer token is sent on every request
+	fake.mu.Lock()
+	for _, tok := range fake.tokens {
+		require.Equal(t, "Bearer test-token", tok)
+	}
+	fake.mu.Unlock()
+}
+
+func TestGCSClientResumableUpload(t *testing.T) {
+	t.Parallel()
+	fake := newFakeGCS()
+	srv := httptest.NewServer(fake.handler(t))
+	defer srv.Close()
+
+	ctx := context.TODO()
+	client := newTestClient(t, srv.URL, 16)
+
+	big := bytes.Repeat([]byte("layer-data"), 100)
+	dgst := digest.FromBytes(big)
+	require.NoError(t, client.save(ctx, client.blobKey(dgst), big))
+	require.Equal(t, 1, fake.resumed)
+
+	dt, ok, err := client.get(ctx, client.blobKey(dgst))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, big, dt)
+}
+
+func TestGCSClientReaderAt(t *testing.T) {
+	t.Parallel()
+	fake := newFakeGCS()
+	srv := httptest.NewServer(fake.handler(t))
+	defer srv.Close()
+
+	ctx := context.TODO()
+	client := newTestClient(t, srv.URL, 1024*1024)
+
+	payload := []byte("0123456789abcdef")
+	dgst := digest.FromBytes(payload)
+	require.NoError(t, client.save(ctx, client.blobKey(dgst), payload))
+
+	ra, err := client.ReaderAt(ctx, ocispecs.Descriptor{Digest: dgst, Size: int64(len(payload))})
+	require.NoError(t, err)
+	defer ra.Close()
+	require.Equal(t, int64(len(payload)), ra.Size())
+
+	buf := make([]byte, 4)
+	n, err := ra.ReadAt(buf, 10)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, []byte("abcd"), buf)
+
+	// reads past the end return EOF
+	_, err = ra.ReadAt(buf, int64(len(payload)))
+	require.Equal(t, io.EOF, err)
+}
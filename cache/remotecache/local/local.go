@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/containerd/containerd/content"
+	cerrdefs "github.com/containerd/containerd/errdefs"
 	"github.com/moby/buildkit/cache/remotecache"
 	"github.com/moby/buildkit/session"
 	sessioncontent "github.com/moby/buildkit/session/content"
@@ -21,18 +22,30 @@ const (
 	attrDest             = "dest"
 	attrImageManifest    = "image-manifest"
 	attrOCIMediatypes    = "oci-mediatypes"
+	attrIncremental      = "incremental"
 	contentStoreIDPrefix = "local:"
 )
 
 type exporter struct {
 	remotecache.Exporter
+	compressionType string
 }
 
-func (*exporter) Name() string {
-	return "exporting cache to client directory"
+func (e *exporter) Name() string {
+	name := "exporting cache to client directory"
+	if e.compressionType != "" {
+		name += " with " + e.compressionType + " compression"
+	}
+	return name
 }
 
 // ResolveCacheExporterFunc for "local" cache exporter.
+//
+// Layer compression (uncompressed, gzip, zstd, estargz) is selected through
+// the standard compression attributes parsed by compression.ParseAttributes;
+// decompression on import is handled transparently by the layer unpacking
+// path based on the blob media type, so no exporter-specific work is needed
+// for either direction.
 func ResolveCacheExporterFunc(sm *session.Manager) remotecache.ResolveCacheExporterFunc {
 	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Exporter, error) {
 		store := attrs[attrDest]
@@ -59,12 +72,26 @@ func ResolveCacheExporterFunc(sm *session.Manager) remotecache.ResolveCacheExpor
 			}
 			imageManifest = b
 		}
+		incremental := false
+		if v, ok := attrs[attrIncremental]; ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", attrIncremental)
+			}
+			incremental = b
+		}
 		csID := contentStoreIDPrefix + store
 		cs, err := getContentStore(ctx, sm, g, csID)
 		if err != nil {
 			return nil, err
 		}
-		return &exporter{remotecache.NewExporter(cs, "", ociMediatypes, imageManifest, compressionConfig)}, nil
+		if incremental {
+			cs = &incrementalStore{Store: cs}
+		}
+		return &exporter{
+			Exporter:        remotecache.NewExporter(cs, "", ociMediatypes, imageManifest, compressionConfig),
+			compressionType: compressionConfig.Type.String(),
+		}, nil
 	}
 }
 
@@ -124,3 +151,25 @@ type unlazyProvider struct {
 func (p *unlazyProvider) UnlazySession(desc ocispecs.Descriptor) session.Group {
 	return p.s
 }
+
+// incrementalStore skips re-ingesting blobs that the destination already
+// has, so that repeated exports to the same directory only transfer changed
+// layers.
+type incrementalStore struct {
+	content.Store
+}
+
+func (s *incrementalStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	var wOpts content.WriterOpts
+	for _, o := range opts {
+		if err := o(&wOpts); err != nil {
+			return nil, err
+		}
+	}
+	if wOpts.Desc.Digest != "" {
+		if _, err := s.Info(ctx, wOpts.Desc.Digest); err == nil {
+			return nil, errors.Wrapf(cerrdefs.ErrAlreadyExists, "content %v", wOpts.Desc.Digest)
+		}
+	}
+	return s.Store.Writer(ctx, opts...)
+}
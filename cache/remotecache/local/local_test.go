@@ -0,0 +1,48 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	contentlocal "github.com/containerd/containerd/content/local"
+	cerrdefs "github.com/containerd/containerd/errdefs"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrementalStoreSkipsExistingBlobs(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := contentlocal.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	dt := []byte("layer data")
+	desc := ocispecs.Descriptor{
+		Digest: digest.FromBytes(dt),
+		Size:   int64(len(dt)),
+	}
+	require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(dt), desc))
+
+	store := &incrementalStore{Store: cs}
+
+	// existing blob is refused with ErrAlreadyExists so callers skip the
+	// transfer
+	_, err = store.Writer(ctx, content.WithRef("ref"), content.WithDescriptor(desc))
+	require.Error(t, err)
+	require.True(t, errors.Is(err, cerrdefs.ErrAlreadyExists))
+
+	// unknown blobs still get a writer
+	dt2 := []byte("new layer data")
+	desc2 := ocispecs.Descriptor{
+		Digest: digest.FromBytes(dt2),
+		Size:   int64(len(dt2)),
+	}
+	w, err := store.Writer(ctx, content.WithRef("ref2"), content.WithDescriptor(desc2))
+	require.NoError(t, err)
+	_, err = w.Write(dt2)
+	require.NoError(t, err)
+	require.NoError(t, w.Commit(ctx, desc2.Size, desc2.Digest))
+}
@@ -0,0 +1,87 @@
+package ocilayout
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	contentlocal "github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/cache/remotecache"
+	"github.com/moby/buildkit/session"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	attrSrc      = "src"
+	attrTag      = "tag"
+	attrPlatform = "platform"
+)
+
+// ResolveCacheImporterFunc for "oci-layout" cache importer. It reads an OCI
+// image layout directory (per the OCI image-layout spec) from local disk and
+// uses its manifests and layer blobs as a cache source. Both single-platform
+// manifests and multi-platform indexes are supported.
+func ResolveCacheImporterFunc() remotecache.ResolveCacheImporterFunc {
+	return func(ctx context.Context, _ session.Group, attrs map[string]string) (remotecache.Importer, ocispecs.Descriptor, error) {
+		src := attrs[attrSrc]
+		if src == "" {
+			return nil, ocispecs.Descriptor{}, errors.New("oci-layout cache importer requires src")
+		}
+
+		desc, err := rootDescriptor(src, attrs[attrTag], attrs[attrPlatform])
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+
+		// an OCI layout stores blobs the same way as a containerd local
+		// content store: blobs/<alg>/<hex>
+		cs, err := contentlocal.NewStore(src)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, errors.Wrap(err, "failed to open oci layout")
+		}
+		return remotecache.NewImporter(cs), desc, nil
+	}
+}
+
+// rootDescriptor picks the manifest descriptor out of the layout's
+// index.json. A tag can select between multiple entries via the reference
+// annotation; a platform narrows down nested indexes.
+func rootDescriptor(dir, tag, platform string) (ocispecs.Descriptor, error) {
+	dt, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return ocispecs.Descriptor{}, errors.Wrap(err, "failed to read oci layout index")
+	}
+	var index ocispecs.Index
+	if err := json.Unmarshal(dt, &index); err != nil {
+		return ocispecs.Descriptor{}, errors.Wrap(err, "failed to parse oci layout index")
+	}
+	if len(index.Manifests) == 0 {
+		return ocispecs.Descriptor{}, errors.New("oci layout index has no manifests")
+	}
+
+	var matcher platforms.MatchComparer
+	if platform != "" {
+		p, err := platforms.Parse(platform)
+		if err != nil {
+			return ocispecs.Descriptor{}, errors.Wrapf(err, "invalid platform %s", platform)
+		}
+		matcher = platforms.Only(p)
+	}
+
+	for _, m := range index.Manifests {
+		if tag != "" && m.Annotations[ocispecs.AnnotationRefName] != tag {
+			continue
+		}
+		if matcher != nil && m.Platform != nil && !matcher.Match(*m.Platform) {
+			continue
+		}
+		return m, nil
+	}
+	if tag != "" || matcher != nil {
+		return ocispecs.Descriptor{}, errors.Errorf("no manifest matched tag %q platform %q in oci layout", tag, platform)
+	}
+	return index.Manifests[0], nil
+}
@@ -0,0 +1,57 @@
+package ocilayout
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func writeIndex(t *testing.T, dir string, index ocispecs.Index) {
+	t.Helper()
+	dt, err := json.Marshal(index)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.json"), dt, 0644))
+}
+
+func TestRootDescriptor(t *testing.T) {
+	dir := t.TempDir()
+
+	amd64 := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Digest:    digest.FromString("amd64"),
+		Platform:  &ocispecs.Platform{OS: "linux", Architecture: "amd64"},
+		Annotations: map[string]string{
+			ocispecs.AnnotationRefName: "latest",
+		},
+	}
+	arm64 := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Digest:    digest.FromString("arm64"),
+		Platform:  &ocispecs.Platform{OS: "linux", Architecture: "arm64"},
+		Annotations: map[string]string{
+			ocispecs.AnnotationRefName: "latest",
+		},
+	}
+	writeIndex(t, dir, ocispecs.Index{Manifests: []ocispecs.Descriptor{amd64, arm64}})
+
+	// default picks the first entry
+	desc, err := rootDescriptor(dir, "", "")
+	require.NoError(t, err)
+	require.Equal(t, amd64.Digest, desc.Digest)
+
+	// platform selection works for multi-platform indexes
+	desc, err = rootDescriptor(dir, "", "linux/arm64")
+	require.NoError(t, err)
+	require.Equal(t, arm64.Digest, desc.Digest)
+
+	// unmatched selectors fail instead of silently picking a manifest
+	_, err = rootDescriptor(dir, "", "linux/riscv64")
+	require.Error(t, err)
+	_, err = rootDescriptor(dir, "other-tag", "")
+	require.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -44,6 +45,9 @@ const (
 	attrSecretAccessKey = "secret_access_key"
 	attrSessionToken    = "session_token"
 	attrUsePathStyle    = "use_path_style"
+	attrMultipartSize   = "multipart_size"
+	attrPresignExpiry   = "presign_expiry"
+	attrUsePresignedURL = "use_presigned_urls"
 )
 
 type Config struct {
@@ -59,6 +63,15 @@ type Config struct {
 	SecretAccessKey string
 	SessionToken    string
 	UsePathStyle    bool
+	// MultipartSize is the part size for multipart uploads; objects above
+	// it are uploaded in parallel parts to avoid timeouts on large layers.
+	MultipartSize int64
+	// PresignExpiry bounds the validity of pre-signed blob URLs handed to
+	// workers without direct S3 credentials.
+	PresignExpiry time.Duration
+	// UsePresignedURLs makes the importer download blobs over plain HTTP
+	// using pre-signed GET URLs instead of authenticated S3 API calls.
+	UsePresignedURLs bool
 }
 
 func getConfig(attrs map[string]string) (Config, error) {
@@ -115,6 +128,33 @@ func getConfig(attrs map[string]string) (Config, error) {
 	sessionToken := attrs[attrSessionToken]
 
 	usePathStyle := false
+	multipartSize := int64(64 * 1024 * 1024)
+	if v, ok := attrs[attrMultipartSize]; ok {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, errors.Errorf("multipart_size must be a number")
+		}
+		multipartSize = size
+	}
+
+	presignExpiry := 15 * time.Minute
+	if v, ok := attrs[attrPresignExpiry]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Errorf("presign_expiry must be a duration")
+		}
+		presignExpiry = d
+	}
+
+	usePresignedURLs := false
+	if v, ok := attrs[attrUsePresignedURL]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, errors.Errorf("use_presigned_urls must be a boolean")
+		}
+		usePresignedURLs = b
+	}
+
 	usePathStyleStr, ok := attrs[attrUsePathStyle]
 	if ok {
 		usePathStyleUser, err := strconv.ParseBool(usePathStyleStr)
@@ -124,18 +164,21 @@ func getConfig(attrs map[string]string) (Config, error) {
 	}
 
 	return Config{
-		Bucket:          bucket,
-		Region:          region,
-		Prefix:          prefix,
-		ManifestsPrefix: manifestsPrefix,
-		BlobsPrefix:     blobsPrefix,
-		Names:           names,
-		TouchRefresh:    touchRefresh,
-		EndpointURL:     endpointURL,
-		AccessKeyID:     accessKeyID,
-		SecretAccessKey: secretAccessKey,
-		SessionToken:    sessionToken,
-		UsePathStyle:    usePathStyle,
+		Bucket:           bucket,
+		Region:           region,
+		Prefix:           prefix,
+		ManifestsPrefix:  manifestsPrefix,
+		BlobsPrefix:      blobsPrefix,
+		Names:            names,
+		TouchRefresh:     touchRefresh,
+		EndpointURL:      endpointURL,
+		AccessKeyID:      accessKeyID,
+		SecretAccessKey:  secretAccessKey,
+		SessionToken:     sessionToken,
+		UsePathStyle:     usePathStyle,
+		MultipartSize:    multipartSize,
+		PresignExpiry:    presignExpiry,
+		UsePresignedURLs: usePresignedURLs,
 	}, nil
 }
 
@@ -348,10 +391,28 @@ func (r *readerAt) Size() int64 {
 type s3Client struct {
 	*s3.Client
 	*manager.Uploader
-	bucket          string
-	prefix          string
-	blobsPrefix     string
-	manifestsPrefix string
+	presignClient    *s3.PresignClient
+	presignExpiry    time.Duration
+	usePresignedURLs bool
+	httpClient       *http.Client
+	bucket           string
+	prefix           string
+	blobsPrefix      string
+	manifestsPrefix  string
+}
+
+// presignBlobURL generates a pre-signed GET URL for a blob so workers
+// without direct S3 credentials can download layers.
+func (s3Client *s3Client) presignBlobURL(ctx context.Context, dgst digest.Digest) (string, error) {
+	key := s3Client.blobKey(dgst)
+	req, err := s3Client.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s3Client.bucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(s3Client.presignExpiry))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to presign blob URL")
+	}
+	return req.URL, nil
 }
 
 func newS3Client(ctx context.Context, config Config) (*s3Client, error) {
@@ -369,13 +430,23 @@ func newS3Client(ctx context.Context, config Config) (*s3Client, error) {
 		}
 	})
 
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		if config.MultipartSize > 0 {
+			u.PartSize = config.MultipartSize
+		}
+	})
+
 	return &s3Client{
-		Client:          client,
-		Uploader:        manager.NewUploader(client),
-		bucket:          config.Bucket,
-		prefix:          config.Prefix,
-		blobsPrefix:     config.BlobsPrefix,
-		manifestsPrefix: config.ManifestsPrefix,
+		Client:           client,
+		Uploader:         uploader,
+		presignClient:    s3.NewPresignClient(client),
+		presignExpiry:    config.PresignExpiry,
+		usePresignedURLs: config.UsePresignedURLs,
+		httpClient:       &http.Client{},
+		bucket:           config.Bucket,
+		prefix:           config.Prefix,
+		blobsPrefix:      config.BlobsPrefix,
+		manifestsPrefix:  config.ManifestsPrefix,
 	}, nil
 }
 
@@ -459,11 +530,36 @@ func (s3Client *s3Client) touch(ctx context.Context, key string) error {
 
 func (s3Client *s3Client) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
 	readerAtCloser := toReaderAtCloser(func(offset int64) (io.ReadCloser, error) {
+		if s3Client.usePresignedURLs {
+			return s3Client.getPresignedReader(ctx, desc.Digest)
+		}
 		return s3Client.getReader(ctx, s3Client.blobKey(desc.Digest))
 	})
 	return &readerAt{ReaderAtCloser: readerAtCloser, size: desc.Size}, nil
 }
 
+// getPresignedReader downloads a blob over plain HTTP using a pre-signed
+// URL, so no S3 credentials are needed for the transfer itself.
+func (s3Client *s3Client) getPresignedReader(ctx context.Context, dgst digest.Digest) (io.ReadCloser, error) {
+	url, err := s3Client.presignBlobURL(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := s3Client.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download blob via presigned URL")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("unexpected status %d downloading blob %s via presigned URL", resp.StatusCode, dgst)
+	}
+	return resp.Body, nil
+}
+
 func (s3Client *s3Client) manifestKey(name string) string {
 	return s3Client.prefix + s3Client.manifestsPrefix + name
 }
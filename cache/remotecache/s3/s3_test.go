@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConfig(t *testing.T) {
+	t.Setenv("AWS_BUCKET", "")
+	t.Setenv("AWS_REGION", "")
+
+	base := map[string]string{
+		"bucket": "cache",
+		"region": "eu-west-1",
+	}
+
+	config, err := getConfig(base)
+	require.NoError(t, err)
+	require.Equal(t, int64(64*1024*1024), config.MultipartSize)
+	require.Equal(t, 15*time.Minute, config.PresignExpiry)
+	require.False(t, config.UsePresignedURLs)
+
+	attrs := map[string]string{
+		"bucket":             "cache",
+		"region":             "eu-west-1",
+		"multipart_size":     "1048576",
+		"presign_expiry":     "1h",
+		"use_presigned_urls": "true",
+	}
+	config, err = getConfig(attrs)
+	require.NoError(t, err)
+	require.Equal(t, int64(1048576), config.MultipartSize)
+	require.Equal(t, time.Hour, config.PresignExpiry)
+	require.True(t, config.UsePresignedURLs)
+
+	for _, bad := range []map[string]string{
+		{"bucket": "cache", "region": "r", "multipart_size": "not-a-number"},
+		{"bucket": "cache", "region": "r", "presign_expiry": "soon"},
+		{"bucket": "cache", "region": "r", "use_presigned_urls": "maybe"},
+	} {
+		_, err := getConfig(bad)
+		require.Error(t, err)
+	}
+}
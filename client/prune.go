@@ -19,6 +19,7 @@ func (c *Client) Prune(ctx context.Context, ch chan UsageInfo, opts ...PruneOpti
 		Filter:       info.Filter,
 		KeepDuration: int64(info.KeepDuration),
 		KeepBytes:    int64(info.KeepBytes),
+		DryRun:       info.DryRun,
 	}
 	if info.All {
 		req.All = true
@@ -63,6 +64,8 @@ type PruneInfo struct {
 	All          bool          `json:"all"`
 	KeepDuration time.Duration `json:"keepDuration"`
 	KeepBytes    int64         `json:"keepBytes"`
+	// DryRun only reports the removal candidates without deleting them
+	DryRun bool `json:"dryRun"`
 }
 
 type pruneOptionFunc func(*PruneInfo)
@@ -75,6 +78,14 @@ var PruneAll = pruneOptionFunc(func(pi *PruneInfo) {
 	pi.All = true
 })
 
+// WithDryRun only reports the records that would be removed without
+// deleting them.
+func WithDryRun() PruneOption {
+	return pruneOptionFunc(func(pi *PruneInfo) {
+		pi.DryRun = true
+	})
+}
+
 func WithKeepOpt(duration time.Duration, bytes int64) PruneOption {
 	return pruneOptionFunc(func(pi *PruneInfo) {
 		pi.KeepDuration = duration
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/pkg/errors"
+)
+
+// WarmCacheInfo describes a single platform warmed by WarmCache
+type WarmCacheInfo struct {
+	Platform string
+	Done     bool
+}
+
+// WarmCache asks the daemon to pre-pull the layers of the given image into
+// its cache, so subsequent builds on the same base image start with cache
+// hits. The returned slice has one entry per warmed platform. Depth controls
+// how many manifest history levels to warm; zero warms the full image.
+func (c *Client) WarmCache(ctx context.Context, ref string, platforms []string, depth int64) ([]WarmCacheInfo, error) {
+	stream, err := controlapi.NewCacheWarmingClient(c.conn).WarmCache(ctx, &controlapi.WarmCacheRequest{
+		Ref:       ref,
+		Platforms: platforms,
+		Depth:     depth,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call warm cache")
+	}
+	var out []WarmCacheInfo
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, errors.Wrap(err, "failed to warm cache")
+		}
+		out = append(out, WarmCacheInfo{Platform: resp.Platform, Done: resp.Done})
+	}
+}
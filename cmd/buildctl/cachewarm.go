@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var cacheCommand = cli.Command{
+	Name:  "cache",
+	Usage: "manage build cache",
+	Subcommands: []cli.Command{
+		cacheWarmCommand,
+	},
+}
+
+var cacheWarmCommand = cli.Command{
+	Name:      "warm",
+	Usage:     "pre-populate the build cache with the layers of an image",
+	ArgsUsage: "<ref>",
+	Action:    cacheWarm,
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "platform",
+			Usage: "Warm the cache for the given platform(s)",
+		},
+		cli.Int64Flag{
+			Name:  "depth",
+			Usage: "Number of manifest history levels to warm (0 warms the full image)",
+		},
+	},
+}
+
+func cacheWarm(clicontext *cli.Context) error {
+	ref := clicontext.Args().First()
+	if ref == "" {
+		return errors.New("image reference is required for cache warm")
+	}
+
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	warmed, err := c.WarmCache(bccommon.CommandContext(clicontext), ref, clicontext.StringSlice("platform"), clicontext.Int64("depth"))
+	for _, w := range warmed {
+		fmt.Fprintf(clicontext.App.Writer, "warmed %s (%s)\n", ref, w.Platform)
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/moby/buildkit/frontend/dockerfile/linter"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var lintCommand = cli.Command{
+	Name:      "lint",
+	Usage:     "apply lint auto-fixes to a Dockerfile",
+	ArgsUsage: "<path>",
+	Action:    lintFix,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "fix",
+			Usage: "Rewrite the Dockerfile with all available auto-fixes applied",
+		},
+		cli.BoolFlag{
+			Name:  "check",
+			Usage: "Exit with a non-zero status when auto-fixes would change the file",
+		},
+	},
+}
+
+func lintFix(clicontext *cli.Context) error {
+	path := clicontext.Args().First()
+	if path == "" {
+		return errors.New("path to a Dockerfile is required")
+	}
+	if !clicontext.Bool("fix") && !clicontext.Bool("check") {
+		return errors.New("one of --fix or --check is required; full linting runs through the frontend.lint subrequest of a build")
+	}
+
+	dt, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fixed, err := linter.NewFormatter().Format(dt)
+	if err != nil {
+		return err
+	}
+
+	if clicontext.Bool("check") {
+		if string(fixed) != string(dt) {
+			return errors.Errorf("%s is not formatted, run buildctl lint --fix %s", path, path)
+		}
+		return nil
+	}
+
+	if string(fixed) == string(dt) {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, fixed, fi.Mode()); err != nil {
+		return err
+	}
+	fmt.Fprintf(clicontext.App.Writer, "fixed %s\n", path)
+	return nil
+}
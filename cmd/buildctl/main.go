@@ -106,6 +106,8 @@ func main() {
 		pruneCommand,
 		pruneHistoriesCommand,
 		buildCommand,
+		cacheCommand,
+		lintCommand,
 		debugCommand,
 		dialStdioCommand,
 	}
@@ -33,6 +33,10 @@ var pruneCommand = cli.Command{
 			Name:  "all",
 			Usage: "Include internal/frontend references",
 		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only list the records that would be removed without deleting anything",
+		},
 		cli.BoolFlag{
 			Name:  "verbose, v",
 			Usage: "Verbose output",
@@ -110,6 +114,9 @@ func prune(clicontext *cli.Context) error {
 		}
 	}
 
+	if clicontext.Bool("dry-run") {
+		opts = append(opts, client.WithDryRun())
+	}
 	err = c.Prune(bccommon.CommandContext(clicontext), ch, opts...)
 	close(ch)
 	<-printed
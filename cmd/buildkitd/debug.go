@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/moby/buildkit/util/bklog"
@@ -13,6 +14,37 @@ import (
 	"golang.org/x/net/trace"
 )
 
+// lateDebugHandlers holds handlers registered after the debug server
+// started, e.g. ones that need the controller
+var lateDebugHandlers struct {
+	mu       sync.Mutex
+	handlers map[string]http.Handler
+}
+
+// registerDebugHandler mounts a handler on the debug server. It can be
+// called before or after setupDebugHandlers.
+func registerDebugHandler(path string, h http.Handler) {
+	lateDebugHandlers.mu.Lock()
+	defer lateDebugHandlers.mu.Unlock()
+	if lateDebugHandlers.handlers == nil {
+		lateDebugHandlers.handlers = map[string]http.Handler{}
+	}
+	lateDebugHandlers.handlers[path] = h
+}
+
+func lateDebugHandler(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lateDebugHandlers.mu.Lock()
+		h := lateDebugHandlers.handlers[path]
+		lateDebugHandlers.mu.Unlock()
+		if h == nil {
+			http.Error(w, "handler not initialized yet", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 func setupDebugHandlers(addr string) error {
 	m := http.NewServeMux()
 	m.Handle("/debug/vars", expvar.Handler())
@@ -30,6 +62,7 @@ func setupDebugHandlers(addr string) error {
 	}))
 
 	m.Handle("/metrics", promhttp.Handler())
+	m.Handle("/debug/graph.dot", lateDebugHandler("/debug/graph.dot"))
 
 	// setting debugaddr is opt-in. permission is defined by listener address
 	trace.AuthRequest = func(_ *http.Request) (bool, bool) {
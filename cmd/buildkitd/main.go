@@ -25,9 +25,11 @@ import (
 	"github.com/gofrs/flock"
 	"github.com/moby/buildkit/cache/remotecache"
 	"github.com/moby/buildkit/cache/remotecache/azblob"
+	gcsremotecache "github.com/moby/buildkit/cache/remotecache/gcs"
 	"github.com/moby/buildkit/cache/remotecache/gha"
 	inlineremotecache "github.com/moby/buildkit/cache/remotecache/inline"
 	localremotecache "github.com/moby/buildkit/cache/remotecache/local"
+	ocilayoutremotecache "github.com/moby/buildkit/cache/remotecache/ocilayout"
 	registryremotecache "github.com/moby/buildkit/cache/remotecache/registry"
 	s3remotecache "github.com/moby/buildkit/cache/remotecache/s3"
 	"github.com/moby/buildkit/client"
@@ -327,6 +329,7 @@ func main() {
 			return err
 		}
 		defer controller.Close()
+		registerDebugHandler("/debug/graph.dot", controller.GraphDOTHandler())
 
 		healthv1.RegisterHealthServer(server, health.NewServer())
 		controller.Register(server)
@@ -785,14 +788,17 @@ func newController(c *cli.Context, cfg *config.Config) (*control.Controller, err
 		"inline":   inlineremotecache.ResolveCacheExporterFunc(),
 		"gha":      gha.ResolveCacheExporterFunc(),
 		"s3":       s3remotecache.ResolveCacheExporterFunc(),
+		"gcs":      gcsremotecache.ResolveCacheExporterFunc(),
 		"azblob":   azblob.ResolveCacheExporterFunc(),
 	}
 	remoteCacheImporterFuncs := map[string]remotecache.ResolveCacheImporterFunc{
-		"registry": registryremotecache.ResolveCacheImporterFunc(sessionManager, w.ContentStore(), resolverFn),
-		"local":    localremotecache.ResolveCacheImporterFunc(sessionManager),
-		"gha":      gha.ResolveCacheImporterFunc(),
-		"s3":       s3remotecache.ResolveCacheImporterFunc(),
-		"azblob":   azblob.ResolveCacheImporterFunc(),
+		"registry":   registryremotecache.ResolveCacheImporterFunc(sessionManager, w.ContentStore(), resolverFn),
+		"local":      localremotecache.ResolveCacheImporterFunc(sessionManager),
+		"gha":        gha.ResolveCacheImporterFunc(),
+		"s3":         s3remotecache.ResolveCacheImporterFunc(),
+		"gcs":        gcsremotecache.ResolveCacheImporterFunc(),
+		"oci-layout": ocilayoutremotecache.ResolveCacheImporterFunc(),
+		"azblob":     azblob.ResolveCacheImporterFunc(),
 	}
 	return control.NewController(control.Opt{
 		SessionManager:            sessionManager,
@@ -3,6 +3,7 @@ package control
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -10,6 +11,7 @@ import (
 
 	contentapi "github.com/containerd/containerd/api/services/content/v1"
 	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/services/content/contentserver"
 	"github.com/distribution/reference"
 	"github.com/hashicorp/go-multierror"
@@ -26,6 +28,7 @@ import (
 	"github.com/moby/buildkit/exporter/util/epoch"
 	"github.com/moby/buildkit/frontend"
 	"github.com/moby/buildkit/frontend/attestations"
+	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/grpchijack"
 	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
@@ -139,8 +142,15 @@ func (c *Controller) Close() error {
 	return rerr
 }
 
+// GraphDOTHandler serves the solver's active build graph in Graphviz DOT
+// format for the debug server.
+func (c *Controller) GraphDOTHandler() http.Handler {
+	return c.solver.GraphDOTHandler()
+}
+
 func (c *Controller) Register(server *grpc.Server) {
 	controlapi.RegisterControlServer(server, c)
+	controlapi.RegisterCacheWarmingServer(server, c)
 	c.gatewayForwarder.Register(server)
 	tracev1.RegisterTraceServiceServer(server, c)
 
@@ -216,6 +226,7 @@ func (c *Controller) Prune(req *controlapi.PruneRequest, stream controlapi.Contr
 					All:          req.All,
 					KeepDuration: time.Duration(req.KeepDuration),
 					KeepBytes:    req.KeepBytes,
+					DryRun:       req.DryRun,
 				})
 			})
 		}(w)
@@ -235,7 +246,7 @@ func (c *Controller) Prune(req *controlapi.PruneRequest, stream controlapi.Contr
 			}
 		}()
 		for r := range ch {
-			didPrune = true
+			didPrune = !req.DryRun
 			if err := stream.Send(&controlapi.UsageRecord{
 				// TODO: add worker info
 				ID:          r.ID,
@@ -337,6 +348,48 @@ func translateLegacySolveRequest(req *controlapi.SolveRequest) {
 	}
 }
 
+// WarmCache pre-pulls the layers of an image into the worker cache by
+// solving an image source without an exporter, so subsequent builds using
+// the same base image start with cache hits. One response is streamed per
+// warmed platform.
+func (c *Controller) WarmCache(req *controlapi.WarmCacheRequest, stream controlapi.CacheWarming_WarmCacheServer) error {
+	if req.Ref == "" {
+		return errors.New("image reference is required to warm the cache")
+	}
+	if req.Depth != 0 {
+		return errors.Errorf("depth-limited cache warming is not implemented, set depth to 0 to warm the full image")
+	}
+	platformList := req.Platforms
+	if len(platformList) == 0 {
+		platformList = []string{platforms.DefaultString()}
+	}
+	ctx := stream.Context()
+	for _, p := range platformList {
+		platform, err := platforms.Parse(p)
+		if err != nil {
+			return errors.Wrapf(err, "invalid platform %s", p)
+		}
+		def, err := llb.Image(req.Ref, llb.Platform(platform)).Marshal(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Solve(ctx, &controlapi.SolveRequest{
+			Ref:        identity.NewID(),
+			Definition: def.ToPB(),
+			Internal:   true,
+		}); err != nil {
+			return errors.Wrapf(err, "failed to warm cache for %s (%s)", req.Ref, platforms.Format(platform))
+		}
+		if err := stream.Send(&controlapi.WarmCacheResponse{
+			Platform: platforms.Format(platform),
+			Done:     true,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Controller) Solve(ctx context.Context, req *controlapi.SolveRequest) (*controlapi.SolveResponse, error) {
 	atomic.AddInt64(&c.buildCount, 1)
 	defer atomic.AddInt64(&c.buildCount, -1)
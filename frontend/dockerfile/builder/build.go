@@ -2,8 +2,10 @@ package builder
 
 import (
 	"context"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containerd/containerd/platforms"
 	"github.com/moby/buildkit/client/llb"
@@ -31,8 +33,78 @@ const (
 	// Don't forget to update frontend documentation if you add
 	// a new build-arg: frontend/dockerfile/docs/reference.md
 	keySyntaxArg = "build-arg:BUILDKIT_SYNTAX"
+
+	// lint configuration, passed as frontend options (--opt)
+	keyLintExperimental   = "lint-experimental"
+	keyLintNetworkAccess  = "lint-network-access"
+	keyLintPullLayers     = "lint-pull-layers"
+	keyLintPullMetadata   = "lint-pull-metadata"
+	keyLintSeverityError  = "lint-severity-error"
+	keyLintEnvAllowlist   = "lint-env-allowlist"
+	keyLintPipeAllowlist  = "lint-pipe-allowlist"
+	keyLintMinHCInterval  = "lint-min-healthcheck-interval"
+	keyLintMaxExposeRange = "lint-max-expose-port-range"
 )
 
+// applyLintOpts wires the lint configuration frontend options into the
+// converter options. Parse failures are returned so typos don't silently
+// disable a check.
+func applyLintOpts(opts map[string]string, convertOpt *dockerfile2llb.ConvertOpt) error {
+	parseBool := func(key string) (bool, error) {
+		v, ok := opts[key]
+		if !ok {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid value %s for %s", v, key)
+		}
+		return b, nil
+	}
+
+	var err error
+	if convertOpt.LintExperimental, err = parseBool(keyLintExperimental); err != nil {
+		return err
+	}
+	if convertOpt.LintRunNetworkAccess, err = parseBool(keyLintNetworkAccess); err != nil {
+		return err
+	}
+	if convertOpt.LintPullLayers, err = parseBool(keyLintPullLayers); err != nil {
+		return err
+	}
+	if convertOpt.LintPullMetadata, err = parseBool(keyLintPullMetadata); err != nil {
+		return err
+	}
+	if v, ok := opts[keyLintSeverityError]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value %s for %s", v, keyLintSeverityError)
+		}
+		convertOpt.LintSeverityError = &b
+	}
+	if v, ok := opts[keyLintEnvAllowlist]; ok {
+		convertOpt.LintEnvAllowlist = strings.Split(v, ",")
+	}
+	if v, ok := opts[keyLintPipeAllowlist]; ok {
+		convertOpt.LintPipeAllowlist = strings.Split(v, ",")
+	}
+	if v, ok := opts[keyLintMinHCInterval]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value %s for %s", v, keyLintMinHCInterval)
+		}
+		convertOpt.LintMinHealthcheckInterval = d
+	}
+	if v, ok := opts[keyLintMaxExposeRange]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value %s for %s", v, keyLintMaxExposeRange)
+		}
+		convertOpt.LintMaxExposePortRange = n
+	}
+	return nil
+}
+
 func Build(ctx context.Context, c client.Client) (_ *client.Result, err error) {
 	bc, err := dockerui.NewClient(c)
 	if err != nil {
@@ -84,6 +156,9 @@ func Build(ctx context.Context, c client.Client) (_ *client.Result, err error) {
 			src.Warn(ctx, msg, warnOpts(location, [][]byte{[]byte(description)}, url))
 		},
 	}
+	if err := applyLintOpts(opts, &convertOpt); err != nil {
+		return nil, err
+	}
 
 	if res, ok, err := bc.HandleSubrequest(ctx, dockerui.RequestHandler{
 		Outline: func(ctx context.Context) (*outline.Outline, error) {
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -65,6 +66,38 @@ type ConvertOpt struct {
 	MetaResolver   llb.ImageMetaResolver
 	LLBCaps        *apicaps.CapSet
 	Warn           linter.LintWarnFunc
+	// LintRunNetworkAccess enables the opt-in RunNetworkAccess lint rule
+	// used for auditing Dockerfiles for offline-build compatibility.
+	LintRunNetworkAccess bool
+	// LintPullLayers enables lint rules that would need to inspect base
+	// image layers. Only the static subset of those checks is currently
+	// implemented.
+	LintPullLayers bool
+	// LintPullMetadata enables lint rules that were designed around base
+	// image metadata, such as CopyDestinationExists. Base image manifests
+	// are not fetched yet: only the statically detectable subset (overwrites
+	// within the same stage) is implemented.
+	LintPullMetadata bool
+	// LintExperimental evaluates experimental lint rules as well. Their
+	// violations are reported through the experimental warnings channel.
+	LintExperimental bool
+	// LintSeverityError controls whether violations of error-severity lint
+	// rules fail the build. Unset means enabled.
+	LintSeverityError *bool
+	// LintEnvAllowlist extends the set of ENV names that are exempt from
+	// the EnvInsteadOfArg rule because they are intentionally
+	// runtime-visible.
+	LintEnvAllowlist []string
+	// LintPipeAllowlist extends the commands that are considered safe on
+	// the right-hand side of a pipe for the RunPipefailMissing rule.
+	LintPipeAllowlist []string
+	// LintMinHealthcheckInterval overrides the minimum HEALTHCHECK interval
+	// enforced by the HealthcheckInterval rule. Zero selects the default of
+	// five seconds.
+	LintMinHealthcheckInterval time.Duration
+	// LintMaxExposePortRange overrides the widest EXPOSE port range allowed
+	// by the ExposePortRange rule. Zero selects the default of 100 ports.
+	LintMaxExposePortRange int
 }
 
 type SBOMTargets struct {
@@ -75,10 +108,17 @@ type SBOMTargets struct {
 }
 
 func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (st *llb.State, img, baseImg *dockerspec.DockerOCIImage, sbom *SBOMTargets, err error) {
+	var lintErrors []string
+	if failOnLintErrors(&opt) {
+		opt.Warn = collectLintErrors(&lintErrors, opt.Warn)
+	}
 	ds, err := toDispatchState(ctx, dt, opt)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
+	if len(lintErrors) > 0 {
+		return nil, nil, nil, nil, errors.Errorf("lint violations with error severity: %s", strings.Join(lintErrors, "; "))
+	}
 
 	sbom = &SBOMTargets{
 		Core:   ds.state,
@@ -114,11 +154,16 @@ func Dockefile2Outline(ctx context.Context, dt []byte, opt ConvertOpt) (*outline
 func DockerfileLint(ctx context.Context, dt []byte, opt ConvertOpt) (*lint.LintResults, error) {
 	results := &lint.LintResults{}
 	sourceIndex := results.AddSource(opt.SourceMap)
+	failOnErrors := failOnLintErrors(&opt)
 	opt.Warn = func(rulename, description, url, fmtmsg string, location []parser.Range) {
 		results.AddWarning(rulename, description, url, fmtmsg, sourceIndex, location)
 	}
 	_, err := toDispatchState(ctx, dt, opt)
 
+	if err == nil && failOnErrors && len(results.Errors) > 0 {
+		err = errors.Errorf("lint found %d violations with error severity", len(results.Errors))
+	}
+
 	var errLoc *parser.ErrorLocation
 	if err != nil {
 		buildErr := &lint.BuildError{
@@ -218,6 +263,11 @@ func toDispatchState(ctx context.Context, dt []byte, opt ConvertOpt) (*dispatchS
 		}
 	}
 
+	opt.Warn = suppressWarnings(dockerfile, opt.Warn)
+	if !opt.LintExperimental {
+		opt.Warn = dropExperimentalWarnings(opt.Warn)
+	}
+
 	validateCommandCasing(dockerfile, opt.Warn)
 
 	proxyEnv := proxyEnvFromBuildArgs(opt.BuildArgs)
@@ -227,6 +277,23 @@ func toDispatchState(ctx context.Context, dt []byte, opt ConvertOpt) (*dispatchS
 		return nil, err
 	}
 	validateStageNames(stages, opt.Warn)
+	validateStageReferences(stages, opt.Warn)
+	validateInsecureFromSchemes(stages, opt.Warn)
+	validateFromDigests(stages, opt.Warn)
+	validateArgCasing(metaArgs, stages, opt.Warn)
+	validateUnusedArgs(metaArgs, stages, opt.Warn)
+	validateUndeclaredVars(metaArgs, stages, opt.Warn)
+	validateCopyChownPattern(stages, opt.Warn)
+	validatePlatformMismatch(stages, platformOpt, opt.Warn)
+	validateHealthcheckIntervals(stages, opt.LintMinHealthcheckInterval, opt.Warn)
+	validateExposePortRanges(stages, opt.LintMaxExposePortRange, opt.Warn)
+	validateBindMountOverCopy(stages, opt.Warn)
+	validateEnvInsteadOfArg(stages, opt.LintEnvAllowlist, opt.Warn)
+	validateMultipleHealthchecks(stages, opt.Warn)
+	validateShellJsonForm(stages, opt.Warn)
+	validateConsecutiveRuns(stages, opt.Warn)
+	validateLatestTags(dockerfile, stages, opt.Warn)
+	validateSyntaxFeatures(dt, stages, opt.Warn)
 
 	shlex := shell.NewLex(dockerfile.EscapeToken)
 	outline := newOutlineCapture()
@@ -611,6 +678,11 @@ func toDispatchState(ctx context.Context, dt []byte, opt ConvertOpt) (*dispatchS
 			cgroupParent:      opt.CgroupParent,
 			llbCaps:           opt.LLBCaps,
 			sourceMap:         opt.SourceMap,
+			lintWarn:          opt.Warn,
+			lintNetworkAccess: opt.LintRunNetworkAccess,
+			lintPullLayers:    opt.LintPullLayers,
+			lintPullMetadata:  opt.LintPullMetadata,
+			lintPipeAllowlist: opt.LintPipeAllowlist,
 		}
 
 		if err = dispatchOnBuildTriggers(d, d.image.Config.OnBuild, opt); err != nil {
@@ -746,6 +818,11 @@ type dispatchOpt struct {
 	cgroupParent      string
 	llbCaps           *apicaps.CapSet
 	sourceMap         *llb.SourceMap
+	lintWarn          linter.LintWarnFunc
+	lintNetworkAccess bool
+	lintPullLayers    bool
+	lintPullMetadata  bool
+	lintPipeAllowlist []string
 }
 
 func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
@@ -809,6 +886,11 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
 			})
 		}
 		if err == nil {
+			if opt.lintPullMetadata {
+				validateCopyDestination(d, c.SourcesAndDest, c.Location(), opt.lintWarn)
+			}
+			validateWholeContextCopy(d, c.SourcesAndDest, c.Location(), opt.lintWarn)
+			validateAddUsed(c, opt.lintWarn)
 			for _, src := range c.SourcePaths {
 				if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
 					d.ctxPaths[path.Join("/", filepath.ToSlash(src))] = struct{}{}
@@ -816,7 +898,7 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
 			}
 		}
 	case *instructions.LabelCommand:
-		err = dispatchLabel(d, c)
+		err = dispatchLabel(d, c, opt.lintWarn)
 	case *instructions.OnbuildCommand:
 		err = dispatchOnbuild(d, c)
 	case *instructions.CmdCommand:
@@ -860,7 +942,11 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
 			opt:             opt,
 		})
 		if err == nil {
+			if opt.lintPullMetadata {
+				validateCopyDestination(d, c.SourcesAndDest, c.Location(), opt.lintWarn)
+			}
 			if len(cmd.sources) == 0 {
+				validateWholeContextCopy(d, c.SourcesAndDest, c.Location(), opt.lintWarn)
 				for _, src := range c.SourcePaths {
 					d.ctxPaths[path.Join("/", filepath.ToSlash(src))] = struct{}{}
 				}
@@ -893,6 +979,10 @@ type dispatchState struct {
 	commands  []command
 	// ctxPaths marks the paths this dispatchState uses from the build context.
 	ctxPaths map[string]struct{}
+	// copiedDests marks file destinations already written by COPY/ADD in this stage.
+	copiedDests map[string]struct{}
+	// copiedWholeContext is set once the full build context was copied into this stage.
+	copiedWholeContext bool
 	// paths marks the paths that are used by this dispatchState.
 	paths          map[string]struct{}
 	ignoreCache    bool
@@ -994,6 +1084,22 @@ func dispatchRun(d *dispatchState, c *instructions.RunCommand, proxy *llb.ProxyE
 
 	customname := c.String()
 
+	validateSecretMountPaths(c, dopt.lintWarn)
+	validateSecretMountModes(c, dopt.lintWarn)
+	validateRunSetE(c, dopt.lintWarn)
+	validateRunWithoutShell(c, dopt.lintWarn)
+	validateRunThirdPartyRepos(c, dopt.lintWarn)
+	validateRunTmpDirUsage(c, dopt.lintWarn)
+	validateRunPythonVirtualenv(c, dopt.lintWarn)
+	validateRunDownloadVerification(c, dopt.lintWarn)
+	validateRunPipefail(c, dopt.lintPipeAllowlist, dopt.lintWarn)
+	if dopt.lintPullLayers {
+		validateRunInterpreters(c, dopt.lintWarn)
+	}
+	if dopt.lintNetworkAccess {
+		validateRunNetworkAccess(c, dopt.lintWarn)
+	}
+
 	// Run command can potentially access any file. Mark the full filesystem as used.
 	d.paths["/"] = struct{}{}
 
@@ -1129,6 +1235,13 @@ func dispatchWorkdir(d *dispatchState, c *instructions.WorkdirCommand, commit bo
 		return errors.Wrap(err, "normalizing workdir")
 	}
 
+	// c.Path has gone through variable expansion at this point, so anything
+	// that is still relative really resolves against the previous workdir
+	if opt != nil && c.Path != "" && !path.IsAbs(filepath.ToSlash(c.Path)) && !strings.HasPrefix(c.Path, "$") {
+		msg := linter.RuleWorkdirRelativePath.Format(c.Path, system.ToSlash(wd, d.platform.OS))
+		linter.RuleWorkdirRelativePath.Run(opt.lintWarn, c.Location(), msg)
+	}
+
 	// NormalizeWorkdir returns paths with platform specific separators. For Windows
 	// this will be of the form: \some\path, which is needed later when we pass it to
 	// HCS.
@@ -1418,18 +1531,29 @@ func dispatchMaintainer(d *dispatchState, c *instructions.MaintainerCommand) err
 	return commitToHistory(&d.image, fmt.Sprintf("MAINTAINER %v", c.Maintainer), false, nil, d.epoch)
 }
 
-func dispatchLabel(d *dispatchState, c *instructions.LabelCommand) error {
+func dispatchLabel(d *dispatchState, c *instructions.LabelCommand, warn linter.LintWarnFunc) error {
 	commitMessage := bytes.NewBufferString("LABEL")
 	if d.image.Config.Labels == nil {
 		d.image.Config.Labels = make(map[string]string, len(c.Labels))
 	}
 	for _, v := range c.Labels {
+		if v.Value == "" && !labelExplicitlyEmpty(c.String(), v.Key) {
+			msg := linter.RuleLabelValueEmpty.Format(v.Key)
+			linter.RuleLabelValueEmpty.Run(warn, c.Location(), msg)
+		}
 		d.image.Config.Labels[v.Key] = v.Value
 		commitMessage.WriteString(" " + v.String())
 	}
 	return commitToHistory(&d.image, commitMessage.String(), false, nil, d.epoch)
 }
 
+// labelExplicitlyEmpty reports whether the original instruction sets the
+// label to an explicit empty string ("" or ”), which is intentional as
+// opposed to a variable expansion that produced nothing.
+func labelExplicitlyEmpty(code, key string) bool {
+	return strings.Contains(code, key+`=""`) || strings.Contains(code, key+`=''`)
+}
+
 func dispatchOnbuild(d *dispatchState, c *instructions.OnbuildCommand) error {
 	d.image.Config.OnBuild = append(d.image.Config.OnBuild, c.Expression)
 	return nil
@@ -2016,6 +2140,1382 @@ var reservedStageNames = map[string]struct{}{
 	"scratch": {},
 }
 
+var varRefRegexp = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// failOnLintErrors reports whether error-severity lint violations should
+// fail the build; unset LintSeverityError means enabled
+func failOnLintErrors(opt *ConvertOpt) bool {
+	return opt.LintSeverityError == nil || *opt.LintSeverityError
+}
+
+// collectLintErrors wraps a warn callback to also record the messages of
+// error-severity rule violations
+func collectLintErrors(out *[]string, warn linter.LintWarnFunc) linter.LintWarnFunc {
+	if warn == nil {
+		warn = func(string, string, string, string, []parser.Range) {}
+	}
+	return func(rulename, description, url, fmtmsg string, location []parser.Range) {
+		if linter.Severity(rulename) == linter.SeverityError {
+			*out = append(*out, fmtmsg)
+		}
+		warn(rulename, description, url, fmtmsg, location)
+	}
+}
+
+// dropExperimentalWarnings filters out violations of experimental rules
+// unless experimental linting was requested.
+func dropExperimentalWarnings(warn linter.LintWarnFunc) linter.LintWarnFunc {
+	return func(rulename, description, url, fmtmsg string, location []parser.Range) {
+		if linter.IsExperimental(rulename) {
+			return
+		}
+		warn(rulename, description, url, fmtmsg, location)
+	}
+}
+
+var noqaRegexp = regexp.MustCompile(`noqa:\s*([A-Za-z0-9_,\s]+)`)
+
+// suppressWarnings wraps a lint warn function so that rule violations on
+// instructions annotated with a '# noqa: RuleName' comment are dropped.
+// Multiple rules can be suppressed with comma-separated names.
+func suppressWarnings(dockerfile *parser.Result, warn linter.LintWarnFunc) linter.LintWarnFunc {
+	suppressions := map[int]map[string]struct{}{}
+	for _, node := range dockerfile.AST.Children {
+		for _, c := range node.PrevComment {
+			m := noqaRegexp.FindStringSubmatch(c)
+			if m == nil {
+				continue
+			}
+			rules := suppressions[node.StartLine]
+			if rules == nil {
+				rules = map[string]struct{}{}
+				suppressions[node.StartLine] = rules
+			}
+			for _, name := range strings.Split(m[1], ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					rules[name] = struct{}{}
+				}
+			}
+		}
+	}
+	if len(suppressions) == 0 {
+		return warn
+	}
+	return func(rulename, description, url, fmtmsg string, location []parser.Range) {
+		for _, loc := range location {
+			if rules, ok := suppressions[loc.Start.Line]; ok {
+				if _, ok := rules[rulename]; ok {
+					return
+				}
+			}
+		}
+		warn(rulename, description, url, fmtmsg, location)
+	}
+}
+
+// validateLatestTags flags FROM references without an explicit tag or digest
+// (or with the floating 'latest' tag), which make builds non-reproducible.
+// Stage references and scratch are skipped, and a stage can opt out with a
+// leading '# lint:ignore LatestTag' comment.
+func validateLatestTags(dockerfile *parser.Result, stages []instructions.Stage, warn linter.LintWarnFunc) {
+	suppressed := map[int]struct{}{}
+	for _, node := range dockerfile.AST.Children {
+		for _, c := range node.PrevComment {
+			if strings.Contains(c, "lint:ignore LatestTag") {
+				suppressed[node.StartLine] = struct{}{}
+			}
+		}
+	}
+
+	stageNames := map[string]struct{}{}
+	for _, st := range stages {
+		if st.Name != "" {
+			stageNames[strings.ToLower(st.Name)] = struct{}{}
+		}
+	}
+	for _, st := range stages {
+		base := st.BaseName
+		if strings.EqualFold(base, "scratch") || strings.ContainsRune(base, '$') {
+			continue
+		}
+		if _, ok := stageNames[strings.ToLower(base)]; ok {
+			continue
+		}
+		if len(st.Location) > 0 {
+			if _, ok := suppressed[st.Location[0].Start.Line]; ok {
+				continue
+			}
+		}
+		named, err := reference.ParseNormalizedNamed(base)
+		if err != nil {
+			continue
+		}
+		if _, ok := named.(reference.Digested); ok {
+			continue
+		}
+		if tagged, ok := named.(reference.Tagged); ok && tagged.Tag() != "latest" {
+			continue
+		}
+		msg := linter.RuleLatestTag.Format(base)
+		linter.RuleLatestTag.Run(warn, st.Location, msg)
+	}
+}
+
+const defaultMaxExposePortRange = 100
+
+// validateExposePortRanges flags EXPOSE instructions with very wide port
+// ranges and ports exposed more than once in the same stage.
+func validateExposePortRanges(stages []instructions.Stage, maxRange int, warn linter.LintWarnFunc) {
+	if maxRange <= 0 {
+		maxRange = defaultMaxExposePortRange
+	}
+	for _, st := range stages {
+		seen := map[string]struct{}{}
+		for _, cmd := range st.Commands {
+			c, ok := cmd.(*instructions.ExposeCommand)
+			if !ok {
+				continue
+			}
+			for _, port := range c.Ports {
+				if strings.ContainsRune(port, '$') {
+					continue
+				}
+				portSpec, _, _ := strings.Cut(port, "/")
+				if lo, hi, ok := strings.Cut(portSpec, "-"); ok {
+					loN, err1 := strconv.Atoi(lo)
+					hiN, err2 := strconv.Atoi(hi)
+					if err1 == nil && err2 == nil && hiN-loN+1 > maxRange {
+						msg := linter.RuleExposePortRange.Format(fmt.Sprintf("range %s spans %d ports, list the specific ports instead", portSpec, hiN-loN+1))
+						linter.RuleExposePortRange.Run(warn, c.Location(), msg)
+					}
+				}
+				if _, ok := seen[port]; ok {
+					msg := linter.RuleExposePortRange.Format(fmt.Sprintf("port %s is exposed more than once in this stage", port))
+					linter.RuleExposePortRange.Run(warn, c.Location(), msg)
+					continue
+				}
+				seen[port] = struct{}{}
+			}
+		}
+	}
+}
+
+const defaultMinHealthcheckInterval = 5 * time.Second
+
+// validateHealthcheckIntervals flags HEALTHCHECK instructions whose interval
+// is unreasonably short or shorter than their timeout, in which case the
+// check is always killed mid-run.
+func validateHealthcheckIntervals(stages []instructions.Stage, minInterval time.Duration, warn linter.LintWarnFunc) {
+	if minInterval <= 0 {
+		minInterval = defaultMinHealthcheckInterval
+	}
+	for _, st := range stages {
+		for _, cmd := range st.Commands {
+			c, ok := cmd.(*instructions.HealthCheckCommand)
+			if !ok || c.Health == nil {
+				continue
+			}
+			interval := c.Health.Interval
+			if interval > 0 && interval < minInterval {
+				msg := linter.RuleHealthcheckInterval.Format(fmt.Sprintf("interval %v is shorter than the minimum of %v and causes excessive load", interval, minInterval))
+				linter.RuleHealthcheckInterval.Run(warn, c.Location(), msg)
+			}
+			if timeout := c.Health.Timeout; timeout > 0 && interval > 0 && timeout > interval {
+				msg := linter.RuleHealthcheckInterval.Format(fmt.Sprintf("timeout %v exceeds interval %v, the check will always be killed mid-run", timeout, interval))
+				linter.RuleHealthcheckInterval.Run(warn, c.Location(), msg)
+			}
+		}
+	}
+}
+
+// validatePlatformMismatch warns when the build targets a platform that
+// differs from the build host and a FROM instruction doesn't pass an
+// explicit --platform, so the base image would resolve against the build
+// platform by default in older builders.
+func validatePlatformMismatch(stages []instructions.Stage, pOpt *platformOpt, warn linter.LintWarnFunc) {
+	if pOpt.implicitTarget {
+		return
+	}
+	crossBuild := true
+	for _, bp := range pOpt.buildPlatforms {
+		if platforms.Only(bp).Match(pOpt.targetPlatform) {
+			crossBuild = false
+			break
+		}
+	}
+	if !crossBuild {
+		return
+	}
+	stageNames := map[string]struct{}{}
+	for _, st := range stages {
+		if st.Name != "" {
+			stageNames[strings.ToLower(st.Name)] = struct{}{}
+		}
+	}
+	for _, st := range stages {
+		if st.Platform != "" || strings.EqualFold(st.BaseName, "scratch") {
+			continue
+		}
+		if _, ok := stageNames[strings.ToLower(st.BaseName)]; ok {
+			continue
+		}
+		msg := linter.RuleFromPlatformMismatch.Format(st.BaseName, platforms.Format(pOpt.targetPlatform))
+		linter.RuleFromPlatformMismatch.Run(warn, st.Location, msg)
+	}
+}
+
+var chownRegexp = regexp.MustCompile(`\bch(?:own|mod)\s+(?:-[A-Za-z]+\s+)*(\S+)\s+(\S+)`)
+
+// validateCopyChownPattern detects a COPY directly followed by a RUN chown
+// or chmod on the same destination (exact or path-prefix match), which
+// creates an avoidable extra layer compared to COPY --chown.
+func validateCopyChownPattern(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	for _, st := range stages {
+		for i, cmd := range st.Commands {
+			c, ok := cmd.(*instructions.CopyCommand)
+			if !ok || c.Chown != "" || i+1 >= len(st.Commands) {
+				continue
+			}
+			dest := path.Clean(c.DestPath)
+			if dest == "" || dest == "." {
+				continue
+			}
+			run, ok := st.Commands[i+1].(*instructions.RunCommand)
+			if !ok {
+				continue
+			}
+			script := strings.Join(run.CmdLine, " ")
+			for _, m := range chownRegexp.FindAllStringSubmatch(script, -1) {
+				target := path.Clean(m[2])
+				if target != dest && !strings.HasPrefix(dest+"/", target+"/") && !strings.HasPrefix(target+"/", dest+"/") {
+					continue
+				}
+				msg := linter.RuleCopyChownPattern.Format(dest, m[1])
+				linter.RuleCopyChownPattern.Run(warn, c.Location(), msg)
+				break
+			}
+		}
+	}
+}
+
+// builtinBuildVars are variables that are always available during a build
+// without an explicit declaration: predefined proxy args, platform args and
+// environment conventionally present in base images.
+var builtinBuildVars = map[string]struct{}{
+	"PATH": {}, "HOME": {}, "HOSTNAME": {}, "TERM": {}, "LANG": {}, "PWD": {},
+	"HTTP_PROXY": {}, "http_proxy": {}, "HTTPS_PROXY": {}, "https_proxy": {},
+	"FTP_PROXY": {}, "ftp_proxy": {}, "NO_PROXY": {}, "no_proxy": {}, "ALL_PROXY": {}, "all_proxy": {},
+	"TARGETPLATFORM": {}, "TARGETOS": {}, "TARGETARCH": {}, "TARGETVARIANT": {}, "TARGETSTAGE": {},
+	"BUILDPLATFORM": {}, "BUILDOS": {}, "BUILDARCH": {}, "BUILDVARIANT": {},
+}
+
+// validateUndeclaredVars reports $VAR expansions in RUN, ENV and LABEL
+// instructions where the variable was not declared as an ARG or set as an
+// ENV earlier in the stage (or inherited from a local base stage).
+// Variables assigned inside the RUN script itself are skipped.
+func validateUndeclaredVars(metaArgs []instructions.ArgCommand, stages []instructions.Stage, warn linter.LintWarnFunc) {
+	metaDeclared := map[string]struct{}{}
+	for _, cmd := range metaArgs {
+		for _, kv := range cmd.Args {
+			metaDeclared[kv.Key] = struct{}{}
+		}
+	}
+
+	stageIdx := map[string]int{}
+	for i, st := range stages {
+		if st.Name != "" {
+			stageIdx[strings.ToLower(st.Name)] = i
+		}
+	}
+
+	// declaredIn computes the set of variables visible at the end of a stage
+	declCache := map[int]map[string]struct{}{}
+	var declaredIn func(i int, depth int) map[string]struct{}
+	declaredIn = func(i int, depth int) map[string]struct{} {
+		if d, ok := declCache[i]; ok {
+			return d
+		}
+		decl := map[string]struct{}{}
+		if depth < len(stages) {
+			if j, ok := stageIdx[strings.ToLower(stages[i].BaseName)]; ok && j != i {
+				for k := range declaredIn(j, depth+1) {
+					decl[k] = struct{}{}
+				}
+			}
+		}
+		for _, cmd := range stages[i].Commands {
+			switch c := cmd.(type) {
+			case *instructions.ArgCommand:
+				for _, kv := range c.Args {
+					decl[kv.Key] = struct{}{}
+				}
+			case *instructions.EnvCommand:
+				for _, kv := range c.Env {
+					decl[kv.Key] = struct{}{}
+				}
+			}
+		}
+		declCache[i] = decl
+		return decl
+	}
+
+	for i, st := range stages {
+		declared := map[string]struct{}{}
+		for k := range metaDeclared {
+			declared[k] = struct{}{}
+		}
+		if j, ok := stageIdx[strings.ToLower(st.BaseName)]; ok && j != i {
+			for k := range declaredIn(j, 0) {
+				declared[k] = struct{}{}
+			}
+		}
+
+		check := func(text string, rule linter.LinterRule[func(string) string], loc []parser.Range, selfAssigns string) {
+			for _, m := range varRefRegexp.FindAllStringSubmatch(text, -1) {
+				name := m[1]
+				if _, ok := declared[name]; ok {
+					continue
+				}
+				if _, ok := builtinBuildVars[name]; ok {
+					continue
+				}
+				if selfAssigns != "" && strings.Contains(selfAssigns, name+"=") {
+					continue
+				}
+				msg := rule.Format(name)
+				rule.Run(warn, loc, msg)
+			}
+		}
+
+		for _, cmd := range st.Commands {
+			switch c := cmd.(type) {
+			case *instructions.ArgCommand:
+				for _, kv := range c.Args {
+					declared[kv.Key] = struct{}{}
+				}
+			case *instructions.EnvCommand:
+				for _, kv := range c.Env {
+					check(kv.Value, linter.RuleUndeclaredArgInEnv, c.Location(), "")
+					declared[kv.Key] = struct{}{}
+				}
+			case *instructions.LabelCommand:
+				for _, kv := range c.Labels {
+					check(kv.Value, linter.RuleUndeclaredArgInLabel, c.Location(), "")
+				}
+			case *instructions.RunCommand:
+				script := strings.Join(c.CmdLine, " ")
+				for _, f := range c.Files {
+					script += "\n" + f.Data
+				}
+				check(script, linter.RuleUndeclaredArgInRun, c.Location(), script)
+			}
+		}
+	}
+}
+
+// validateConsecutiveRuns flags groups of directly consecutive shell-form
+// RUN instructions in a stage, each of which produces its own layer.
+func validateConsecutiveRuns(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	for _, st := range stages {
+		var group []*instructions.RunCommand
+		flush := func() {
+			if len(group) >= 2 {
+				start := group[0].Location()[0].Start.Line
+				end := group[len(group)-1].Location()[0].End.Line
+				msg := linter.RuleConsecutiveRun.Format(start, end)
+				linter.RuleConsecutiveRun.Run(warn, group[0].Location(), msg)
+			}
+			group = group[:0]
+		}
+		for _, cmd := range st.Commands {
+			if c, ok := cmd.(*instructions.RunCommand); ok && c.PrependShell && len(c.Files) == 0 {
+				group = append(group, c)
+				continue
+			}
+			flush()
+		}
+		flush()
+	}
+}
+
+// MergeConsecutiveRuns returns the shell command that results from chaining
+// the given RUN instructions with '&&'. It is used by the --merge-runs
+// auto-fix.
+func MergeConsecutiveRuns(runs []*instructions.RunCommand) string {
+	parts := make([]string, 0, len(runs))
+	for _, c := range runs {
+		parts = append(parts, strings.Join(c.CmdLine, " "))
+	}
+	return strings.Join(parts, " && ")
+}
+
+// validateShellJsonForm flags shell-form CMD and ENTRYPOINT instructions,
+// which run through 'sh -c' and therefore don't receive signals directly.
+// An empty CMD [] is a valid signal passthrough and is not flagged.
+func validateShellJsonForm(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	for _, st := range stages {
+		for _, cmd := range st.Commands {
+			var name string
+			var shellForm bool
+			var cmdLine []string
+			switch c := cmd.(type) {
+			case *instructions.CmdCommand:
+				name, shellForm, cmdLine = "CMD", c.PrependShell, c.CmdLine
+			case *instructions.EntrypointCommand:
+				name, shellForm, cmdLine = "ENTRYPOINT", c.PrependShell, c.CmdLine
+			default:
+				continue
+			}
+			if !shellForm || len(cmdLine) == 0 {
+				continue
+			}
+			suggested, err := json.Marshal(strings.Fields(strings.Join(cmdLine, " ")))
+			if err != nil {
+				continue
+			}
+			msg := linter.RuleShellJsonForm.Format(name, strings.Join(cmdLine, " "), string(suggested))
+			linter.RuleShellJsonForm.Run(warn, cmd.Location(), msg)
+		}
+	}
+}
+
+// validateMultipleHealthchecks flags redundant HEALTHCHECK instructions.
+// Only the last HEALTHCHECK in a stage takes effect, so any earlier ones are
+// dead weight. The check counts per stage: multi-stage builds can declare
+// one per stage.
+func validateMultipleHealthchecks(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	for _, st := range stages {
+		firstLine := -1
+		for _, cmd := range st.Commands {
+			c, ok := cmd.(*instructions.HealthCheckCommand)
+			if !ok {
+				continue
+			}
+			if firstLine < 0 {
+				if loc := c.Location(); len(loc) > 0 {
+					firstLine = loc[0].Start.Line
+				}
+				continue
+			}
+			msg := linter.RuleMultipleHealthcheck.Format(firstLine)
+			linter.RuleMultipleHealthcheck.Run(warn, c.Location(), msg)
+		}
+	}
+}
+
+// runtimeEnvNames are ENV names that are conventionally runtime-visible and
+// never flagged by the EnvInsteadOfArg rule.
+var runtimeEnvNames = map[string]struct{}{
+	"PATH": {}, "HOME": {}, "LANG": {}, "LC_ALL": {}, "TZ": {}, "TERM": {},
+}
+
+// validateEnvInsteadOfArg warns about ENV variables that are only referenced
+// by RUN instructions in their stage: they permanently grow the image config
+// without being useful at runtime, which is what ARG is for.
+func validateEnvInsteadOfArg(stages []instructions.Stage, allowlist []string, warn linter.LintWarnFunc) {
+	exempt := map[string]struct{}{}
+	for k := range runtimeEnvNames {
+		exempt[k] = struct{}{}
+	}
+	for _, k := range allowlist {
+		exempt[k] = struct{}{}
+	}
+
+	for _, st := range stages {
+		type envDecl struct {
+			cmd  *instructions.EnvCommand
+			name string
+		}
+		var decls []envDecl
+		usedInRun := map[string]struct{}{}
+		usedElsewhere := map[string]struct{}{}
+
+		for _, cmd := range st.Commands {
+			switch c := cmd.(type) {
+			case *instructions.EnvCommand:
+				for _, kv := range c.Env {
+					if _, ok := exempt[kv.Key]; !ok {
+						decls = append(decls, envDecl{cmd: c, name: kv.Key})
+					}
+					// references in the values of later ENV declarations
+					for _, m := range varRefRegexp.FindAllStringSubmatch(kv.Value, -1) {
+						usedElsewhere[m[1]] = struct{}{}
+					}
+				}
+			case *instructions.RunCommand:
+				for _, m := range varRefRegexp.FindAllStringSubmatch(c.String(), -1) {
+					usedInRun[m[1]] = struct{}{}
+				}
+			default:
+				if str, ok := cmd.(fmt.Stringer); ok {
+					for _, m := range varRefRegexp.FindAllStringSubmatch(str.String(), -1) {
+						usedElsewhere[m[1]] = struct{}{}
+					}
+				}
+			}
+		}
+
+		for _, d := range decls {
+			if _, ok := usedInRun[d.name]; !ok {
+				continue
+			}
+			if _, ok := usedElsewhere[d.name]; ok {
+				continue
+			}
+			msg := linter.RuleEnvInsteadOfArg.Format(d.name)
+			linter.RuleEnvInsteadOfArg.Run(warn, d.cmd.Location(), msg)
+		}
+	}
+}
+
+// validateBindMountOverCopy detects the COPY-then-RUN pattern where the
+// copied path is used by the directly following RUN instruction and never
+// referenced again in the stage, suggesting a build-only bind mount instead
+// of a layer-producing copy.
+func validateBindMountOverCopy(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	for _, st := range stages {
+		for i, cmd := range st.Commands {
+			c, ok := cmd.(*instructions.CopyCommand)
+			if !ok || i+1 >= len(st.Commands) {
+				continue
+			}
+			dest := c.DestPath
+			if dest == "" || dest == "." || dest == "/" {
+				continue
+			}
+			run, ok := st.Commands[i+1].(*instructions.RunCommand)
+			if !ok || !strings.Contains(run.String(), dest) {
+				continue
+			}
+			referencedLater := false
+			for _, later := range st.Commands[i+2:] {
+				if str, ok := later.(fmt.Stringer); ok && strings.Contains(str.String(), dest) {
+					referencedLater = true
+					break
+				}
+			}
+			if referencedLater {
+				continue
+			}
+			msg := linter.RuleRunBindMountOverCopy.Format(dest)
+			linter.RuleRunBindMountOverCopy.Run(warn, c.Location(), msg)
+		}
+	}
+}
+
+// validateUnusedArgs warns about ARGs that are declared but never referenced
+// in any later instruction. Args declared before the first FROM are not
+// flagged when they are only used in FROM lines.
+func validateUnusedArgs(metaArgs []instructions.ArgCommand, stages []instructions.Stage, warn linter.LintWarnFunc) {
+	type argDecl struct {
+		cmd  instructions.Command
+		name string
+	}
+	var decls []argDecl
+	used := map[string]struct{}{}
+
+	markRefs := func(text string) {
+		for _, m := range varRefRegexp.FindAllStringSubmatch(text, -1) {
+			used[m[1]] = struct{}{}
+		}
+	}
+
+	for i := range metaArgs {
+		cmd := &metaArgs[i]
+		for _, kv := range cmd.Args {
+			decls = append(decls, argDecl{cmd: cmd, name: kv.Key})
+			if kv.Value != nil {
+				markRefs(*kv.Value)
+			}
+		}
+	}
+	for _, st := range stages {
+		markRefs(st.BaseName)
+		if st.Platform != "" {
+			markRefs(st.Platform)
+		}
+		for _, cmd := range st.Commands {
+			if c, ok := cmd.(*instructions.ArgCommand); ok {
+				for _, kv := range c.Args {
+					decls = append(decls, argDecl{cmd: c, name: kv.Key})
+					if kv.Value != nil {
+						markRefs(*kv.Value)
+					}
+				}
+				continue
+			}
+			if str, ok := cmd.(fmt.Stringer); ok {
+				markRefs(str.String())
+			}
+		}
+	}
+
+	for _, d := range decls {
+		if _, ok := used[d.name]; ok {
+			continue
+		}
+		msg := linter.RuleUnusedArg.Format(d.name)
+		linter.RuleUnusedArg.Run(warn, d.cmd.Location(), msg)
+	}
+}
+
+// validateFromDigests checks pinned digests in FROM references against the
+// OCI digest format so that truncated or malformed digests fail at lint time
+// instead of with an unhelpful resolution error.
+func validateFromDigests(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	for _, st := range stages {
+		name, dgstStr, ok := strings.Cut(st.BaseName, "@")
+		if !ok || name == "" || strings.ContainsRune(dgstStr, '$') {
+			// unpinned reference, or digest built from a build arg that
+			// is not resolvable here
+			continue
+		}
+		if _, err := digest.Parse(dgstStr); err != nil {
+			msg := linter.RuleFromDigestFormat.Format(dgstStr, err.Error())
+			linter.RuleFromDigestFormat.Run(warn, st.Location, msg)
+		}
+	}
+}
+
+// validateInsecureFromSchemes warns when a FROM reference explicitly uses
+// the unencrypted http scheme.
+func validateInsecureFromSchemes(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	for _, st := range stages {
+		if strings.HasPrefix(strings.ToLower(st.BaseName), "http://") {
+			msg := linter.RuleFromSchemeInsecure.Format(st.BaseName)
+			linter.RuleFromSchemeInsecure.Run(warn, st.Location, msg)
+		}
+	}
+}
+
+// validateArgCasing warns when ARG names across the Dockerfile use mixed
+// casing. It mirrors validateCommandCasing but applies to variable names,
+// where the convention is uppercase.
+func validateArgCasing(metaArgs []instructions.ArgCommand, stages []instructions.Stage, warn linter.LintWarnFunc) {
+	type argDecl struct {
+		name     string
+		location []parser.Range
+	}
+	var args []argDecl
+	for _, cmd := range metaArgs {
+		for _, kv := range cmd.Args {
+			args = append(args, argDecl{name: kv.Key, location: cmd.Location()})
+		}
+	}
+	for _, st := range stages {
+		for _, cmd := range st.Commands {
+			if c, ok := cmd.(*instructions.ArgCommand); ok {
+				for _, kv := range c.Args {
+					args = append(args, argDecl{name: kv.Key, location: c.Location()})
+				}
+			}
+		}
+	}
+
+	var lowerCount, upperCount int
+	for _, a := range args {
+		if strings.ToUpper(a.name) == a.name {
+			upperCount++
+		} else if strings.ToLower(a.name) == a.name {
+			lowerCount++
+		}
+	}
+	if lowerCount == 0 || upperCount == 0 {
+		return
+	}
+
+	correctCasing := "uppercase"
+	if lowerCount > upperCount {
+		correctCasing = "lowercase"
+	}
+	for _, a := range args {
+		if correctCasing == "uppercase" && strings.ToUpper(a.name) != a.name ||
+			correctCasing == "lowercase" && strings.ToLower(a.name) != a.name {
+			msg := linter.RuleSelfConsistentArgCasing.Format(a.name, correctCasing)
+			linter.RuleSelfConsistentArgCasing.Run(warn, a.location, msg)
+		}
+	}
+}
+
+// validateStageReferences detects cycles in the stage reference graph built
+// from FROM, COPY --from and RUN --mount=from before the build starts, where
+// they would otherwise surface as confusing resolution errors deep in the
+// solver. The first cycle found is reported with its full path.
+func validateStageReferences(stages []instructions.Stage, warn linter.LintWarnFunc) {
+	idx := map[string]int{}
+	for i, st := range stages {
+		if st.Name != "" {
+			idx[strings.ToLower(st.Name)] = i
+		}
+	}
+
+	deps := make([][]int, len(stages))
+	for i, st := range stages {
+		add := func(name string) {
+			if j, ok := idx[strings.ToLower(name)]; ok {
+				deps[i] = append(deps[i], j)
+			}
+		}
+		add(st.BaseName)
+		for _, cmd := range st.Commands {
+			switch c := cmd.(type) {
+			case *instructions.CopyCommand:
+				if c.From != "" {
+					add(c.From)
+				}
+			case *instructions.RunCommand:
+				for _, m := range instructions.GetMounts(c) {
+					if m.From != "" {
+						add(m.From)
+					}
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		inStack
+		done
+	)
+	state := make([]int, len(stages))
+	var visit func(i int, path []int) []int
+	visit = func(i int, path []int) []int {
+		if state[i] == done {
+			return nil
+		}
+		if state[i] == inStack {
+			// trim the path down to the cycle
+			for j, p := range path {
+				if p == i {
+					return append(path[j:], i)
+				}
+			}
+			return append(path, i)
+		}
+		state[i] = inStack
+		for _, d := range deps[i] {
+			if cycle := visit(d, append(path, i)); cycle != nil {
+				return cycle
+			}
+		}
+		state[i] = done
+		return nil
+	}
+
+	for i := range stages {
+		cycle := visit(i, nil)
+		if cycle == nil {
+			continue
+		}
+		names := make([]string, len(cycle))
+		for j, c := range cycle {
+			names[j] = stages[c].Name
+			if names[j] == "" {
+				names[j] = stages[c].BaseName
+			}
+		}
+		msg := linter.RuleFromSelfReference.Format(strings.Join(names, " -> "))
+		linter.RuleFromSelfReference.Run(warn, stages[cycle[0]].Location, msg)
+		return
+	}
+}
+
+// syntaxFeature describes an instruction feature together with the minimal
+// dockerfile 1.x syntax minor version that supports it.
+type syntaxFeature struct {
+	name  string
+	minor int
+}
+
+// validateSyntaxFeatures warns when the Dockerfile declares an explicit
+// `# syntax=docker/dockerfile:1.N` version but uses features introduced in a
+// newer syntax release, which would break the build in older builders.
+func validateSyntaxFeatures(dt []byte, stages []instructions.Stage, warn linter.LintWarnFunc) {
+	syntax, _, _, ok := parser.DetectSyntax(dt)
+	if !ok {
+		return
+	}
+	declared, ok := syntaxMinorVersion(syntax)
+	if !ok {
+		return
+	}
+	for _, st := range stages {
+		for _, cmd := range st.Commands {
+			for _, f := range commandSyntaxFeatures(cmd) {
+				if f.minor > declared {
+					msg := linter.RuleFromNewerThanTarget.Format(f.name, fmt.Sprintf("1.%d", f.minor))
+					linter.RuleFromNewerThanTarget.Run(warn, cmd.Location(), msg)
+				}
+			}
+		}
+	}
+}
+
+// syntaxMinorVersion extracts N from a syntax reference pinned to a 1.N
+// release, e.g. "docker/dockerfile:1.2". Unpinned or non-1.x references
+// return false.
+func syntaxMinorVersion(ref string) (int, bool) {
+	i := strings.LastIndex(ref, ":")
+	if i < 0 {
+		return 0, false
+	}
+	tag := strings.TrimPrefix(ref[i+1:], "1.")
+	if tag == ref[i+1:] {
+		return 0, false
+	}
+	if j := strings.IndexByte(tag, '.'); j >= 0 {
+		tag = tag[:j]
+	}
+	n, err := strconv.Atoi(tag)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func commandSyntaxFeatures(cmd instructions.Command) (fs []syntaxFeature) {
+	switch c := cmd.(type) {
+	case *instructions.RunCommand:
+		if len(instructions.GetMounts(c)) > 0 {
+			fs = append(fs, syntaxFeature{"RUN --mount", 2})
+		}
+		if len(c.Files) > 0 {
+			fs = append(fs, syntaxFeature{"heredoc syntax", 4})
+		}
+	case *instructions.CopyCommand:
+		if c.Link {
+			fs = append(fs, syntaxFeature{"COPY --link", 4})
+		}
+		if len(c.SourceContents) > 0 {
+			fs = append(fs, syntaxFeature{"heredoc syntax", 4})
+		}
+		if c.Parents {
+			fs = append(fs, syntaxFeature{"COPY --parents", 7})
+		}
+		if len(c.ExcludePatterns) > 0 {
+			fs = append(fs, syntaxFeature{"COPY --exclude", 7})
+		}
+	case *instructions.AddCommand:
+		if c.Link {
+			fs = append(fs, syntaxFeature{"ADD --link", 4})
+		}
+		if len(c.SourceContents) > 0 {
+			fs = append(fs, syntaxFeature{"heredoc syntax", 4})
+		}
+		if c.KeepGitDir {
+			fs = append(fs, syntaxFeature{"ADD --keep-git-dir", 5})
+		}
+		if c.Checksum != "" {
+			fs = append(fs, syntaxFeature{"ADD --checksum", 6})
+		}
+		if len(c.ExcludePatterns) > 0 {
+			fs = append(fs, syntaxFeature{"ADD --exclude", 7})
+		}
+	}
+	return fs
+}
+
+var pipefailRegexp = regexp.MustCompile(`set\s+-o\s+pipefail`)
+
+// safePipeTargets are commands that are commonly piped into purely for
+// output shaping, where the pipe hiding the exit code is harmless.
+var safePipeTargets = []string{"tee", "head", "tail", "less", "more"}
+
+// validateRunPipefail warns when a shell-form RUN uses a pipe without
+// 'set -o pipefail' or 'set -e', which hides failures of every command but
+// the last one in the pipeline.
+func validateRunPipefail(c *instructions.RunCommand, allowlist []string, warn linter.LintWarnFunc) {
+	if !c.PrependShell {
+		return
+	}
+	script := strings.Join(c.CmdLine, " ")
+	for _, f := range c.Files {
+		script += "\n" + f.Data
+	}
+	if pipefailRegexp.MatchString(script) || setERegexp.MatchString(script) {
+		return
+	}
+	target, ok := pipeTarget(script)
+	if !ok {
+		return
+	}
+	for _, s := range append(append([]string{}, safePipeTargets...), allowlist...) {
+		if target == s {
+			return
+		}
+	}
+	snippet := script
+	if len(snippet) > 80 {
+		snippet = snippet[:77] + "..."
+	}
+	msg := linter.RuleRunPipefailMissing.Format(snippet)
+	linter.RuleRunPipefailMissing.Run(warn, c.Location(), msg)
+}
+
+// pipeTarget returns the first word after the last unquoted single '|' in
+// cmd, reporting false when the command contains no pipe. Doubled pipes
+// (logical or) are not pipes.
+func pipeTarget(cmd string) (string, bool) {
+	var inSingle, inDouble bool
+	idx := -1
+	rs := []rune(cmd)
+	for i := 0; i < len(rs); i++ {
+		switch rs[i] {
+		case '\\':
+			if !inSingle {
+				i++
+			}
+		case '\'':
+			if !inDouble {
+				inSingle = !inDouble
+			}
+		case '"':
+			if !inSingle {
+				inDouble = !inDouble
+			}
+		case '|':
+			if inSingle || inDouble {
+				continue
+			}
+			if i+1 < len(rs) && rs[i+1] == '|' {
+				i++
+				continue
+			}
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return "", false
+	}
+	fields := strings.Fields(string(rs[idx+1:]))
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+var setERegexp = regexp.MustCompile(`(^|\n)\s*set\s+(-[a-zA-Z]*e[a-zA-Z]*|-o\s+errexit)\b`)
+
+// validateRunSetE suggests `set -e` (or `&&` chaining) when a shell-form RUN
+// separates commands with `;`, which silently ignores failures of all but the
+// last command.
+func validateRunSetE(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	if !c.PrependShell {
+		return
+	}
+	var scripts []string
+	if len(c.Files) == 0 {
+		scripts = append(scripts, strings.Join(c.CmdLine, " "))
+	} else {
+		// heredocs: the shell runs the inline file contents
+		for _, f := range c.Files {
+			scripts = append(scripts, f.Data)
+		}
+	}
+	for _, script := range scripts {
+		if !hasUnquotedSemicolon(script) || setERegexp.MatchString(script) {
+			continue
+		}
+		msg := linter.RuleRunSetE.Format()
+		linter.RuleRunSetE.Run(warn, c.Location(), msg)
+		return
+	}
+}
+
+// hasUnquotedSemicolon reports whether s contains a single `;` separator
+// outside of quotes. Doubled semicolons (case statement terminators) are
+// ignored.
+func hasUnquotedSemicolon(s string) bool {
+	var inSingle, inDouble bool
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		switch rs[i] {
+		case '\\':
+			if !inSingle {
+				i++
+			}
+		case '\'':
+			if !inDouble {
+				inSingle = !inSingle
+			}
+		case '"':
+			if !inSingle {
+				inDouble = !inDouble
+			}
+		case ';':
+			if inSingle || inDouble {
+				continue
+			}
+			if i+1 < len(rs) && rs[i+1] == ';' {
+				i++
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// validateRunInterpreters checks shebang lines in RUN heredocs. Interpreters
+// with relative or otherwise unusable paths always fail at build time.
+// Verifying that an absolute interpreter path actually exists in the base
+// image would require pulling its layers and is not implemented; the rule is
+// gated behind LintPullLayers together with that future work.
+func validateRunInterpreters(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	for _, f := range c.Files {
+		if !strings.HasPrefix(f.Data, "#!") {
+			continue
+		}
+		line, _, _ := strings.Cut(f.Data[2:], "\n")
+		fields := strings.Fields(strings.TrimSpace(line))
+		if len(fields) == 0 {
+			continue
+		}
+		interpreter := fields[0]
+		if !path.IsAbs(interpreter) || strings.Contains(interpreter, "\\") {
+			msg := linter.RuleRunInterpreterMissing.Format(interpreter)
+			linter.RuleRunInterpreterMissing.Run(warn, c.Location(), msg)
+		}
+	}
+}
+
+// checksumVerifyCommands mark a download as verified when they appear in the
+// same RUN instruction.
+var checksumVerifyCommands = []string{
+	"sha256sum -c", "sha512sum -c", "sha1sum -c", "md5sum -c", "shasum",
+	"gpg --verify", "gpgv", "cosign verify",
+}
+
+// validateRunDownloadVerification warns when wget or curl downloads a file
+// in a RUN instruction without any checksum or signature verification step in
+// the same instruction.
+func validateRunDownloadVerification(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	script := strings.Join(c.CmdLine, " ")
+	for _, f := range c.Files {
+		script += "\n" + f.Data
+	}
+	for _, v := range checksumVerifyCommands {
+		if strings.Contains(script, v) {
+			return
+		}
+	}
+	for _, cmd := range splitShellCommands(script) {
+		downloader := ""
+		if strings.HasPrefix(cmd, "wget ") || cmd == "wget" {
+			downloader = "wget"
+		} else if strings.HasPrefix(cmd, "curl ") && (strings.Contains(cmd, " -O") || strings.Contains(cmd, " -o ") || strings.Contains(cmd, "--output")) {
+			downloader = "curl"
+		}
+		if downloader == "" {
+			continue
+		}
+		msg := linter.RuleRunWgetVerify.Format(downloader)
+		linter.RuleRunWgetVerify.Run(warn, c.Location(), msg)
+		return
+	}
+}
+
+var venvActivateRegexp = regexp.MustCompile(`(\.|source)\s+\S*bin/activate`)
+
+// validateRunPythonVirtualenv warns when pip installs packages in a RUN
+// instruction without an activated virtualenv, a virtualenv-scoped pip path
+// or the --user flag.
+func validateRunPythonVirtualenv(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	script := strings.Join(c.CmdLine, " ")
+	for _, f := range c.Files {
+		script += "\n" + f.Data
+	}
+	if venvActivateRegexp.MatchString(script) {
+		return
+	}
+	for _, cmd := range splitShellCommands(script) {
+		if !strings.HasPrefix(cmd, "pip ") && !strings.HasPrefix(cmd, "pip3 ") {
+			continue
+		}
+		if !strings.Contains(cmd, " install") || strings.Contains(cmd, "--user") {
+			continue
+		}
+		msg := linter.RuleRunPythonVirtualenv.Format()
+		linter.RuleRunPythonVirtualenv.Run(warn, c.Location(), msg)
+		return
+	}
+}
+
+var tmpCleanupRegexp = regexp.MustCompile(`rm\s+(-[a-zA-Z]+\s+)*/(var/)?tmp`)
+
+// validateRunTmpDirUsage warns when a RUN instruction writes into /tmp but
+// does not clean it up in the same instruction, which keeps the temporary
+// files in the layer. A tmpfs mount on /tmp avoids the problem entirely.
+func validateRunTmpDirUsage(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	for _, m := range instructions.GetMounts(c) {
+		if m.Type == instructions.MountTypeTmpfs && path.Join("/", m.Target) == "/tmp" {
+			return
+		}
+	}
+	script := strings.Join(c.CmdLine, " ")
+	for _, f := range c.Files {
+		script += "\n" + f.Data
+	}
+	if !strings.Contains(script, "/tmp/") {
+		return
+	}
+	if tmpCleanupRegexp.MatchString(script) {
+		return
+	}
+	msg := linter.RuleRunTmpDirSize.Format()
+	linter.RuleRunTmpDirSize.Run(warn, c.Location(), msg)
+}
+
+// thirdPartyRepoCommands are command prefixes that enable unofficial package
+// repositories (COPR, PPA) inside the image.
+var thirdPartyRepoCommands = []string{
+	"dnf copr enable", "yum copr enable", "add-apt-repository ppa:",
+}
+
+// validateRunThirdPartyRepos notes RUN commands that enable third-party
+// package repositories, which bypass the distribution's vetting.
+func validateRunThirdPartyRepos(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	script := strings.Join(c.CmdLine, " ")
+	for _, f := range c.Files {
+		script += "\n" + f.Data
+	}
+	for _, cmd := range splitShellCommands(script) {
+		for _, rc := range thirdPartyRepoCommands {
+			if strings.HasPrefix(cmd, rc) {
+				msg := linter.RuleRunDnfCopr.Format(strings.TrimSuffix(rc, ":"))
+				linter.RuleRunDnfCopr.Run(warn, c.Location(), msg)
+			}
+		}
+	}
+}
+
+// shellBinaries are binaries commonly used as the explicit shell in
+// exec-form instructions.
+var shellBinaries = map[string]struct{}{
+	"/bin/sh": {}, "/bin/bash": {}, "/usr/bin/sh": {}, "/usr/bin/bash": {},
+	"sh": {}, "bash": {}, "cmd.exe": {}, "cmd": {}, "powershell": {}, "pwsh": {},
+}
+
+// validateRunWithoutShell notes exec-form RUN instructions that don't invoke
+// a shell explicitly. This is often intentional, but it is a common source of
+// confusion because shell features silently do not work.
+func validateRunWithoutShell(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	if c.PrependShell || len(c.CmdLine) == 0 {
+		return
+	}
+	if _, ok := shellBinaries[c.CmdLine[0]]; ok {
+		return
+	}
+	msg := linter.RuleRunWithoutShell.Format(c.CmdLine[0])
+	linter.RuleRunWithoutShell.Run(warn, c.Location(), msg)
+}
+
+// networkCommands are well-known commands (or command prefixes) that access
+// the network and will fail in air-gapped build environments.
+var networkCommands = []string{
+	"curl", "wget", "git clone", "git fetch", "git pull",
+	"apt-get update", "apt-get install", "apt update", "apt install",
+	"apk add", "pip install", "pip3 install", "npm install", "npm ci",
+	"yarn install", "go get", "go mod download", "dnf install", "yum install",
+	"gem install", "composer install", "cargo fetch",
+}
+
+// validateRunNetworkAccess reports commands in a RUN instruction that are
+// known to access the network. The rule is opt-in and intended for auditing
+// Dockerfiles before submitting them to network-restricted builders.
+func validateRunNetworkAccess(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	var script string
+	if c.PrependShell {
+		script = strings.Join(c.CmdLine, " ")
+	} else if len(c.CmdLine) > 0 {
+		script = strings.Join(c.CmdLine, " ")
+	}
+	for _, f := range c.Files {
+		script += "\n" + f.Data
+	}
+	for _, cmd := range splitShellCommands(script) {
+		for _, nc := range networkCommands {
+			if cmd == nc || strings.HasPrefix(cmd, nc+" ") {
+				msg := linter.RuleRunNetworkAccess.Format(nc)
+				linter.RuleRunNetworkAccess.Run(warn, c.Location(), msg)
+			}
+		}
+	}
+}
+
+// splitShellCommands crudely splits a shell script into individual commands
+// on unquoted separators (&&, ||, ;, |, newlines).
+func splitShellCommands(script string) []string {
+	var cmds []string
+	var cur strings.Builder
+	var inSingle, inDouble bool
+	flush := func() {
+		if c := strings.TrimSpace(cur.String()); c != "" {
+			cmds = append(cmds, c)
+		}
+		cur.Reset()
+	}
+	rs := []rune(script)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch r {
+		case '\\':
+			cur.WriteRune(r)
+			if !inSingle && i+1 < len(rs) {
+				i++
+				cur.WriteRune(rs[i])
+			}
+			continue
+		case '\'':
+			if !inDouble {
+				inSingle = !inSingle
+			}
+		case '"':
+			if !inSingle {
+				inDouble = !inDouble
+			}
+		}
+		if !inSingle && !inDouble {
+			switch r {
+			case ';', '\n':
+				flush()
+				continue
+			case '&', '|':
+				flush()
+				if i+1 < len(rs) && (rs[i+1] == '&' || rs[i+1] == '|') {
+					i++
+				}
+				continue
+			}
+		}
+		cur.WriteRune(r)
+	}
+	flush()
+	return cmds
+}
+
+// worldReadableDirs are directories that are conventionally readable by all
+// users of the image. Secrets mounted below them are exposed to any process.
+var worldReadableDirs = []string{"/tmp", "/var/tmp", "/etc", "/usr/share"}
+
+// validateSecretMountModes warns when a secret mount sets a mode with group
+// or other permission bits, making the secret readable by every container
+// user. The default mode (0600) is not flagged.
+func validateSecretMountModes(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	for _, m := range instructions.GetMounts(c) {
+		if m.Type != instructions.MountTypeSecret || m.Mode == nil {
+			continue
+		}
+		if *m.Mode&0o077 == 0 {
+			continue
+		}
+		secretID := m.CacheID
+		if m.Source != "" {
+			secretID = m.Source
+		}
+		if secretID == "" && m.Target != "" {
+			secretID = path.Base(m.Target)
+		}
+		msg := linter.RuleSecretMountPermissions.Format(secretID, fmt.Sprintf("0%o", *m.Mode))
+		linter.RuleSecretMountPermissions.Run(warn, c.Location(), msg)
+	}
+}
+
+// validateSecretMountPaths warns when a secret mount targets a path inside a
+// world-readable directory instead of a restricted location like /run/secrets.
+func validateSecretMountPaths(c *instructions.RunCommand, warn linter.LintWarnFunc) {
+	for _, m := range instructions.GetMounts(c) {
+		if m.Type != instructions.MountTypeSecret || m.Target == "" {
+			continue
+		}
+		target := path.Join("/", filepath.ToSlash(m.Target))
+		for _, dir := range worldReadableDirs {
+			if target == dir || strings.HasPrefix(target, dir+"/") {
+				secretID := m.CacheID
+				if m.Source != "" {
+					secretID = m.Source
+				}
+				if secretID == "" {
+					secretID = path.Base(target)
+				}
+				msg := linter.RuleSecretMountPath.Format(secretID, target)
+				linter.RuleSecretMountPath.Run(warn, c.Location(), msg)
+				break
+			}
+		}
+	}
+}
+
+// archiveSuffixes are source suffixes that trigger ADD's implicit
+// extraction, making ADD the right instruction.
+var archiveSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tar.xz", ".txz", ".tbz2", ".zip", ".gz", ".bz2", ".xz"}
+
+// validateAddUsed suggests COPY when an ADD instruction only copies local
+// non-archive files and so doesn't use any of ADD's implicit behavior.
+func validateAddUsed(c *instructions.AddCommand, warn linter.LintWarnFunc) {
+	if c.Checksum != "" || c.KeepGitDir {
+		return
+	}
+	for _, src := range c.SourcePaths {
+		lower := strings.ToLower(src)
+		if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "git@") {
+			return
+		}
+		for _, suffix := range archiveSuffixes {
+			if strings.HasSuffix(lower, suffix) {
+				return
+			}
+		}
+	}
+	if len(c.SourcePaths) == 0 {
+		return
+	}
+	msg := linter.RuleAddUsed.Format(c.SourcePaths[0])
+	linter.RuleAddUsed.Run(warn, c.Location(), msg)
+}
+
+// validateWholeContextCopy warns when an instruction copies the entire build
+// context into a stage that already received a full context copy.
+func validateWholeContextCopy(d *dispatchState, c instructions.SourcesAndDest, location []parser.Range, warn linter.LintWarnFunc) {
+	whole := false
+	for _, src := range c.SourcePaths {
+		if p := path.Join("/", filepath.ToSlash(src)); p == "/" {
+			whole = true
+			break
+		}
+	}
+	if !whole {
+		return
+	}
+	if d.copiedWholeContext {
+		msg := linter.RuleCopyBuildContext.Format()
+		linter.RuleCopyBuildContext.Run(warn, location, msg)
+	}
+	d.copiedWholeContext = true
+}
+
+// validateCopyDestination warns when a copy destination was already written to
+// by an earlier COPY/ADD in the same stage. Only exact file destinations are
+// compared. The CopyDestinationExists rule was designed to also consult the
+// base image manifest; until manifest fetching is implemented the rule is
+// gated behind LintPullMetadata and covers the same-stage overwrite subset
+// only.
+func validateCopyDestination(d *dispatchState, c instructions.SourcesAndDest, location []parser.Range, warn linter.LintWarnFunc) {
+	dest := c.DestPath
+	if dest == "" || strings.HasSuffix(dest, "/") || strings.HasSuffix(dest, ".") {
+		return
+	}
+	dest = path.Join("/", filepath.ToSlash(dest))
+	if d.copiedDests == nil {
+		d.copiedDests = map[string]struct{}{}
+	} else if _, ok := d.copiedDests[dest]; ok {
+		msg := linter.RuleCopyDestinationExists.Format(dest)
+		linter.RuleCopyDestinationExists.Run(warn, location, msg)
+	}
+	d.copiedDests[dest] = struct{}{}
+}
+
 func validateStageNames(stages []instructions.Stage, warn linter.LintWarnFunc) {
 	stageNames := make(map[string]struct{})
 	for _, stage := range stages {
@@ -0,0 +1,488 @@
+package dockerfile2llb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/linter"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func parseRunCommand(t *testing.T, df string) *instructions.RunCommand {
+	t.Helper()
+	res, err := parser.Parse(strings.NewReader(df))
+	require.NoError(t, err)
+	stages, _, err := instructions.Parse(res.AST, nil)
+	require.NoError(t, err)
+	require.Len(t, stages, 1)
+	for _, cmd := range stages[0].Commands {
+		if c, ok := cmd.(*instructions.RunCommand); ok {
+			// expand mount options the way dispatch() does before linting
+			require.NoError(t, c.Expand(func(word string) (string, error) {
+				return word, nil
+			}))
+			return c
+		}
+	}
+	t.Fatal("no RUN command found")
+	return nil
+}
+
+func TestValidateSecretMountModes(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		mode     string
+		expected int
+	}{
+		{"mode=0600", 0},
+		{"mode=0644", 1},
+		{"mode=0640", 1},
+		{"mode=0777", 1},
+		{"", 0}, // default mode
+	} {
+		name := tc.mode
+		if name == "" {
+			name = "default"
+		}
+		t.Run(name, func(t *testing.T) {
+			opt := ""
+			if tc.mode != "" {
+				opt = "," + tc.mode
+			}
+			df := "FROM scratch\nRUN --mount=type=secret,id=mysecret" + opt + " true\n"
+			c := parseRunCommand(t, df)
+
+			var warnings []string
+			validateSecretMountModes(c, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleSecretMountPermissions.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+			if tc.expected > 0 {
+				require.Contains(t, warnings[0], "mysecret")
+			}
+		})
+	}
+}
+
+func TestValidateAddUsed(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"local file", "FROM scratch\nADD f1 /dst/\n", 1},
+		{"url", "FROM scratch\nADD https://example.com/f1 /dst/\n", 0},
+		{"tar", "FROM scratch\nADD f1.tar /dst/\n", 0},
+		{"tgz", "FROM scratch\nADD f1.tgz /dst/\n", 0},
+		{"tar.bz2", "FROM scratch\nADD f1.tar.bz2 /dst/\n", 0},
+		{"tar.xz", "FROM scratch\nADD f1.tar.xz /dst/\n", 0},
+		{"zip", "FROM scratch\nADD f1.zip /dst/\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var add *instructions.AddCommand
+			for _, cmd := range stages[0].Commands {
+				if c, ok := cmd.(*instructions.AddCommand); ok {
+					add = c
+				}
+			}
+			require.NotNil(t, add)
+
+			var warnings []string
+			validateAddUsed(add, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleAddUsed.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestValidateBindMountOverCopy(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{
+			"copy only used by next run",
+			"FROM scratch\nCOPY requirements.txt /req.txt\nRUN pip install -r /req.txt\n",
+			1,
+		},
+		{
+			"copy referenced later",
+			"FROM scratch\nCOPY requirements.txt /req.txt\nRUN pip install -r /req.txt\nRUN cat /req.txt\n",
+			0,
+		},
+		{
+			"copy not used by next run",
+			"FROM scratch\nCOPY requirements.txt /req.txt\nRUN echo hello\n",
+			0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateBindMountOverCopy(stages, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleRunBindMountOverCopy.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestValidateMultipleHealthchecks(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{
+			"single stage single healthcheck",
+			"FROM scratch\nHEALTHCHECK CMD check\n",
+			0,
+		},
+		{
+			"single stage duplicate healthcheck",
+			"FROM scratch\nHEALTHCHECK CMD one\nHEALTHCHECK CMD two\n",
+			1,
+		},
+		{
+			"one healthcheck per stage",
+			"FROM scratch AS a\nHEALTHCHECK CMD one\nFROM scratch AS b\nHEALTHCHECK CMD two\n",
+			0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateMultipleHealthchecks(stages, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleMultipleHealthcheck.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestValidateShellJsonForm(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"shell form cmd", "FROM scratch\nCMD my-app --flag\n", 1},
+		{"json form cmd", "FROM scratch\nCMD [\"my-app\", \"--flag\"]\n", 0},
+		{"shell form entrypoint", "FROM scratch\nENTRYPOINT my-app\n", 1},
+		{"json form entrypoint", "FROM scratch\nENTRYPOINT [\"my-app\"]\n", 0},
+		{"empty cmd", "FROM scratch\nCMD []\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateShellJsonForm(stages, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleShellJsonForm.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestValidateLatestTags(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"no tag", "FROM ubuntu\n", 1},
+		{"latest tag", "FROM ubuntu:latest\n", 1},
+		{"pinned tag", "FROM ubuntu:22.04\n", 0},
+		{"digest", "FROM ubuntu@sha256:6e9f67fa63b0323e9a1e587fd71c561ba48a034504fb804fd26fd8800039835d\n", 0},
+		{"scratch", "FROM scratch\n", 0},
+		{"stage reference", "FROM ubuntu:22.04 AS base\nFROM base\n", 0},
+		{"suppressed", "# lint:ignore LatestTag\nFROM ubuntu\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateLatestTags(res, stages, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleLatestTag.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestSuppressWarnings(t *testing.T) {
+	t.Parallel()
+	df := "FROM scratch\n# noqa: RuleA, RuleB\nRUN true\n"
+	res, err := parser.Parse(strings.NewReader(df))
+	require.NoError(t, err)
+
+	var got []string
+	warn := suppressWarnings(res, func(rulename, _, _, _ string, _ []parser.Range) {
+		got = append(got, rulename)
+	})
+
+	runLoc := []parser.Range{{Start: parser.Position{Line: 3}, End: parser.Position{Line: 3}}}
+	fromLoc := []parser.Range{{Start: parser.Position{Line: 1}, End: parser.Position{Line: 1}}}
+
+	warn("RuleA", "", "", "", runLoc)  // suppressed
+	warn("RuleB", "", "", "", runLoc)  // suppressed
+	warn("RuleC", "", "", "", runLoc)  // not in the noqa list
+	warn("RuleA", "", "", "", fromLoc) // different instruction
+
+	require.Equal(t, []string{"RuleC", "RuleA"}, got)
+}
+
+func TestValidateRunPipefail(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"pipe without pipefail", "FROM scratch\nRUN curl -s example.com | sh\n", 1},
+		{"pipe with pipefail", "FROM scratch\nRUN set -o pipefail && curl -s example.com | sh\n", 0},
+		{"pipe with set -e", "FROM scratch\nRUN set -e; curl -s example.com | sh\n", 0},
+		{"logical or", "FROM scratch\nRUN true || false\n", 0},
+		{"safe pipe target", "FROM scratch\nRUN dmesg | tail\n", 0},
+		{"no pipe", "FROM scratch\nRUN echo hello\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := parseRunCommand(t, tc.df)
+
+			var warnings []string
+			validateRunPipefail(c, nil, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleRunPipefailMissing.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestValidateConsecutiveRuns(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"two consecutive runs", "FROM scratch\nRUN one\nRUN two\n", 1},
+		{"separated by copy", "FROM scratch\nRUN one\nCOPY f /f\nRUN two\n", 0},
+		{"single run", "FROM scratch\nRUN one\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateConsecutiveRuns(stages, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleConsecutiveRun.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestMergeConsecutiveRuns(t *testing.T) {
+	t.Parallel()
+	df := "FROM scratch\nRUN one\nRUN two\n"
+	res, err := parser.Parse(strings.NewReader(df))
+	require.NoError(t, err)
+	stages, _, err := instructions.Parse(res.AST, nil)
+	require.NoError(t, err)
+
+	var runs []*instructions.RunCommand
+	for _, cmd := range stages[0].Commands {
+		if c, ok := cmd.(*instructions.RunCommand); ok {
+			runs = append(runs, c)
+		}
+	}
+	require.Equal(t, "one && two", MergeConsecutiveRuns(runs))
+}
+
+func TestValidateUndeclaredVars(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected []string
+	}{
+		{
+			"undeclared in run",
+			"FROM scratch\nRUN echo $FOO\n",
+			[]string{"UndeclaredArgInRun"},
+		},
+		{
+			"declared arg",
+			"FROM scratch\nARG FOO\nRUN echo $FOO\n",
+			nil,
+		},
+		{
+			"declared env",
+			"FROM scratch\nENV FOO=bar\nRUN echo $FOO\n",
+			nil,
+		},
+		{
+			"forward reference",
+			"FROM scratch\nRUN echo $FOO\nARG FOO\n",
+			[]string{"UndeclaredArgInRun"},
+		},
+		{
+			"meta arg used in stage",
+			"ARG FOO\nFROM scratch\nRUN echo $FOO\n",
+			nil,
+		},
+		{
+			"inherited from base stage",
+			"FROM scratch AS base\nENV FOO=bar\nFROM base\nRUN echo $FOO\n",
+			nil,
+		},
+		{
+			"undeclared in env and label",
+			"FROM scratch\nENV BAR=$MISSING\nLABEL version=$ALSOMISSING\n",
+			[]string{"UndeclaredArgInEnv", "UndeclaredArgInLabel"},
+		},
+		{
+			"shell local assignment",
+			"FROM scratch\nRUN FOO=1; echo $FOO\n",
+			nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, metaArgs, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var got []string
+			validateUndeclaredVars(metaArgs, stages, func(rulename, _, _, _ string, _ []parser.Range) {
+				got = append(got, rulename)
+			})
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestValidateCopyChownPattern(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"exact match", "FROM scratch\nCOPY src /app\nRUN chown -R user:group /app\n", 1},
+		{"prefix match", "FROM scratch\nCOPY src /app\nRUN chown user:group /app/bin\n", 1},
+		{"non-consecutive", "FROM scratch\nCOPY src /app\nRUN echo hi\nRUN chown -R user:group /app\n", 0},
+		{"unrelated path", "FROM scratch\nCOPY src /app\nRUN chown -R user:group /other\n", 0},
+		{"already chowned copy", "FROM scratch\nCOPY --chown=user:group src /app\nRUN chown -R user:group /app\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateCopyChownPattern(stages, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleCopyChownPattern.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestValidateHealthcheckIntervals(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"short interval", "FROM scratch\nHEALTHCHECK --interval=1s CMD check\n", 1},
+		{"timeout exceeds interval", "FROM scratch\nHEALTHCHECK --interval=10s --timeout=20s CMD check\n", 1},
+		{"both violations", "FROM scratch\nHEALTHCHECK --interval=2s --timeout=4s CMD check\n", 2},
+		{"reasonable", "FROM scratch\nHEALTHCHECK --interval=30s --timeout=5s CMD check\n", 0},
+		{"defaults", "FROM scratch\nHEALTHCHECK CMD check\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateHealthcheckIntervals(stages, 0, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleHealthcheckInterval.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
+
+func TestValidateExposePortRanges(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		df       string
+		expected int
+	}{
+		{"full range", "FROM scratch\nEXPOSE 1-65535\n", 1},
+		{"small range", "FROM scratch\nEXPOSE 8000-8010\n", 0},
+		{"duplicate port", "FROM scratch\nEXPOSE 8080\nEXPOSE 8080\n", 1},
+		{"duplicate across stages ok", "FROM scratch AS a\nEXPOSE 8080\nFROM scratch AS b\nEXPOSE 8080\n", 0},
+		{"single port", "FROM scratch\nEXPOSE 8080\n", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parser.Parse(strings.NewReader(tc.df))
+			require.NoError(t, err)
+			stages, _, err := instructions.Parse(res.AST, nil)
+			require.NoError(t, err)
+
+			var warnings []string
+			validateExposePortRanges(stages, 0, func(rulename, _, _, msg string, _ []parser.Range) {
+				require.Equal(t, linter.RuleExposePortRange.Name, rulename)
+				warnings = append(warnings, msg)
+			})
+			require.Len(t, warnings, tc.expected)
+		})
+	}
+}
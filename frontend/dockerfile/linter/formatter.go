@@ -0,0 +1,170 @@
+package linter
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Fixer rewrites source lines to resolve violations of one rule. It
+// receives the parsed file and the full line slice and returns the updated
+// lines. Fixers must be idempotent: applying them to already-fixed input has
+// to produce identical output. The file is re-parsed between fixers, so a
+// fixer may add or remove lines.
+type Fixer func(result *parser.Result, lines []string) []string
+
+// Formatter applies auto-fixes for lint rules to a Dockerfile. Only rules
+// with a registered Fixer are rewritten; everything else is left untouched.
+type Formatter struct {
+	fixers []Fixer
+}
+
+// NewFormatter returns a formatter with the default fixers: instruction
+// keyword casing (SelfConsistentCommandCasing), FROM/AS keyword casing
+// (FromAsCasing) and merging of directly consecutive shell-form RUN
+// instructions (ConsecutiveRun). Callers that want a subset can construct
+// the Formatter with WithFixer instead.
+func NewFormatter() *Formatter {
+	return &Formatter{
+		fixers: []Fixer{CommandCasingFixer, FromAsCasingFixer, ConsecutiveRunFixer},
+	}
+}
+
+// WithFixer appends an additional fixer
+func (f *Formatter) WithFixer(fx Fixer) *Formatter {
+	f.fixers = append(f.fixers, fx)
+	return f
+}
+
+// Format parses the Dockerfile and applies all fixers in order. The output
+// is idempotent: formatting the result again produces the same bytes.
+func (f *Formatter) Format(dt []byte) ([]byte, error) {
+	hasTrailingNewline := bytes.HasSuffix(dt, []byte("\n"))
+	lines := strings.Split(string(dt), "\n")
+
+	for _, fx := range f.fixers {
+		result, err := parser.Parse(strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			return nil, err
+		}
+		lines = fx(result, lines)
+	}
+
+	out := strings.Join(lines, "\n")
+	if hasTrailingNewline && !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return []byte(out), nil
+}
+
+// CommandCasingFixer uppercases instruction keywords
+// (SelfConsistentCommandCasing)
+func CommandCasingFixer(result *parser.Result, lines []string) []string {
+	for _, node := range result.AST.Children {
+		li := node.StartLine - 1
+		if li < 0 || li >= len(lines) {
+			continue
+		}
+		line := lines[li]
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(trimmed)]
+		keyword, rest, found := strings.Cut(trimmed, " ")
+		if !strings.EqualFold(keyword, node.Value) {
+			continue
+		}
+		if !found {
+			lines[li] = indent + strings.ToUpper(keyword)
+			continue
+		}
+		lines[li] = indent + strings.ToUpper(keyword) + " " + rest
+	}
+	return lines
+}
+
+// FromAsCasingFixer matches the casing of the 'as' keyword to the 'from'
+// keyword (FromAsCasing)
+func FromAsCasingFixer(result *parser.Result, lines []string) []string {
+	for _, node := range result.AST.Children {
+		if !strings.EqualFold(node.Value, "from") {
+			continue
+		}
+		li := node.StartLine - 1
+		if li < 0 || li >= len(lines) {
+			continue
+		}
+		fields := strings.Fields(lines[li])
+		for i, w := range fields {
+			if i == 0 || !strings.EqualFold(w, "as") {
+				continue
+			}
+			if fields[0] == strings.ToLower(fields[0]) {
+				fields[i] = "as"
+			} else {
+				fields[i] = "AS"
+			}
+		}
+		lines[li] = strings.Join(fields, " ")
+	}
+	return lines
+}
+
+// ConsecutiveRunFixer joins groups of directly consecutive single-line
+// shell-form RUN instructions with '&&' (ConsecutiveRun)
+func ConsecutiveRunFixer(result *parser.Result, lines []string) []string {
+	type runLine struct {
+		line int // 0-based
+		cmd  string
+	}
+	var group []runLine
+	drop := map[int]struct{}{}
+
+	flush := func() {
+		if len(group) >= 2 {
+			cmds := make([]string, len(group))
+			for i, r := range group {
+				cmds[i] = r.cmd
+			}
+			first := group[0].line
+			trimmed := strings.TrimLeft(lines[first], " \t")
+			indent := lines[first][:len(lines[first])-len(trimmed)]
+			keyword, _, _ := strings.Cut(trimmed, " ")
+			lines[first] = indent + keyword + " " + strings.Join(cmds, " && ")
+			for _, r := range group[1:] {
+				drop[r.line] = struct{}{}
+			}
+		}
+		group = group[:0]
+	}
+
+	for _, node := range result.AST.Children {
+		isSingleLineRun := strings.EqualFold(node.Value, "run") &&
+			node.StartLine == node.EndLine &&
+			node.Next != nil &&
+			!node.Attributes["json"]
+		if isSingleLineRun {
+			li := node.StartLine - 1
+			if li >= 0 && li < len(lines) {
+				trimmed := strings.TrimLeft(lines[li], " \t")
+				if _, cmd, ok := strings.Cut(trimmed, " "); ok {
+					group = append(group, runLine{line: li, cmd: cmd})
+					continue
+				}
+			}
+		}
+		flush()
+	}
+	flush()
+
+	if len(drop) == 0 {
+		return lines
+	}
+	out := make([]string, 0, len(lines)-len(drop))
+	for i, l := range lines {
+		if _, ok := drop[i]; ok {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
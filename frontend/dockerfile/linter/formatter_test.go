@@ -0,0 +1,39 @@
+package linter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatter(t *testing.T) {
+	dt := []byte(`from ubuntu:22.04 AS base
+run apt-get update
+RUN apt-get install -y curl
+copy f1 /f1
+`)
+	f := NewFormatter()
+	out, err := f.Format(dt)
+	require.NoError(t, err)
+
+	expected := `FROM ubuntu:22.04 AS base
+RUN apt-get update && apt-get install -y curl
+COPY f1 /f1
+`
+	require.Equal(t, expected, string(out))
+
+	// formatting is idempotent
+	out2, err := f.Format(out)
+	require.NoError(t, err)
+	require.Equal(t, string(out), string(out2))
+}
+
+func TestFormatterLeavesExecFormAlone(t *testing.T) {
+	dt := []byte(`FROM scratch
+RUN ["echo", "one"]
+RUN ["echo", "two"]
+`)
+	out, err := NewFormatter().Format(dt)
+	require.NoError(t, err)
+	require.Equal(t, string(dt), string(out))
+}
@@ -7,11 +7,68 @@ import (
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
 )
 
+// RuleSeverity classifies how serious a rule violation is. The zero value is
+// SeverityWarning, which matches the historical behavior of all rules.
+type RuleSeverity int
+
+const (
+	SeverityWarning RuleSeverity = iota
+	SeverityError
+	SeverityInfo
+)
+
+func (s RuleSeverity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityInfo:
+		return "info"
+	default:
+		return "warning"
+	}
+}
+
+// ruleMeta holds the static per-rule attributes looked up by name. The maps
+// are populated once from the rule definitions in init and read-only
+// afterwards.
+var (
+	ruleSeverities    = map[string]RuleSeverity{}
+	experimentalRules = map[string]bool{}
+)
+
+func registerRuleMeta(name string, severity RuleSeverity, experimental bool) {
+	ruleSeverities[name] = severity
+	experimentalRules[name] = experimental
+}
+
+// Severity returns the severity of the rule with the given name, defaulting
+// to SeverityWarning for unknown rules.
+func Severity(ruleName string) RuleSeverity {
+	return ruleSeverities[ruleName]
+}
+
+// IsExperimental reports whether the rule with the given name is marked
+// experimental.
+func IsExperimental(ruleName string) bool {
+	return experimentalRules[ruleName]
+}
+
 type LinterRule[F any] struct {
 	Name        string
 	Description string
 	URL         string
-	Format      F
+	Severity    RuleSeverity
+	// Experimental rules may produce false positives and are only evaluated
+	// when experimental linting is requested. Their violations are reported
+	// through a separate channel.
+	Experimental bool
+	Format       F
+}
+
+// WithSeverity returns a copy of the rule with the severity overridden
+func (rule LinterRule[F]) WithSeverity(s RuleSeverity) LinterRule[F] {
+	rule.Severity = s
+	return rule
 }
 
 func (rule LinterRule[F]) Run(warn LintWarnFunc, location []parser.Range, txt ...string) {
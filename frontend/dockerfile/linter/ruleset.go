@@ -70,4 +70,311 @@ var (
 			return fmt.Sprintf("FROM argument '%s' is not declared", baseArg)
 		},
 	}
+	RuleExposePortRange = LinterRule[func(string) string]{
+		Name:        "ExposePortRange",
+		Description: "Very large EXPOSE port ranges bloat the image metadata without being meaningful",
+		Format: func(problem string) string {
+			return fmt.Sprintf("EXPOSE %s", problem)
+		},
+	}
+	RuleHealthcheckInterval = LinterRule[func(string) string]{
+		Name:        "HealthcheckInterval",
+		Description: "HEALTHCHECK intervals should be long enough to avoid excessive load and longer than the timeout",
+		Format: func(problem string) string {
+			return fmt.Sprintf("HEALTHCHECK %s", problem)
+		},
+	}
+	RuleFromPlatformMismatch = LinterRule[func(string, string) string]{
+		Name:        "FromPlatformMismatch",
+		Description: "Cross-platform builds should state --platform explicitly on FROM to avoid pulling base images for the wrong platform",
+		Format: func(image, targetPlatform string) string {
+			return fmt.Sprintf("Base image %q has no explicit --platform while building for %s", image, targetPlatform)
+		},
+	}
+	RuleCopyChownPattern = LinterRule[func(string, string) string]{
+		Name:        "CopyChownPattern",
+		Description: "Changing ownership in a RUN after COPY creates an extra layer, use COPY --chown instead",
+		Format: func(dest, owner string) string {
+			return fmt.Sprintf("Use COPY --chown=%s instead of a separate RUN chown for %q", owner, dest)
+		},
+	}
+	RuleUndeclaredArgInRun = LinterRule[func(string) string]{
+		Name:        "UndeclaredArgInRun",
+		Description: "Variables expanded in RUN must be declared as ARG or set as ENV before use",
+		Format: func(argName string) string {
+			return fmt.Sprintf("Variable '%s' used in RUN is not declared", argName)
+		},
+	}
+	RuleUndeclaredArgInEnv = LinterRule[func(string) string]{
+		Name:        "UndeclaredArgInEnv",
+		Description: "Variables expanded in ENV must be declared as ARG or set as ENV before use",
+		Format: func(argName string) string {
+			return fmt.Sprintf("Variable '%s' used in ENV is not declared", argName)
+		},
+	}
+	RuleUndeclaredArgInLabel = LinterRule[func(string) string]{
+		Name:        "UndeclaredArgInLabel",
+		Description: "Variables expanded in LABEL must be declared as ARG or set as ENV before use",
+		Format: func(argName string) string {
+			return fmt.Sprintf("Variable '%s' used in LABEL is not declared", argName)
+		},
+	}
+	RuleConsecutiveRun = LinterRule[func(int, int) string]{
+		Name:        "ConsecutiveRun",
+		Description: "Consecutive RUN instructions create separate layers and could be merged with '&&'",
+		Format: func(startLine, endLine int) string {
+			return fmt.Sprintf("RUN instructions on lines %d-%d could be merged into one", startLine, endLine)
+		},
+	}
+	RuleRunPipefailMissing = LinterRule[func(string) string]{
+		Name:        "RunPipefailMissing",
+		Description: "Pipes in RUN instructions hide failures of all but the last command unless pipefail is set",
+		Format: func(command string) string {
+			return fmt.Sprintf("RUN command %q uses a pipe without 'set -o pipefail' or 'set -e'", command)
+		},
+	}
+	RuleLatestTag = LinterRule[func(string) string]{
+		Name:        "LatestTag",
+		Description: "Base images should be pinned to a tag or digest for reproducible builds",
+		Format: func(ref string) string {
+			return fmt.Sprintf("Base image %q uses an implicit or 'latest' tag, pin a version or digest", ref)
+		},
+	}
+	RuleShellJsonForm = LinterRule[func(string, string, string) string]{
+		Name:        "ShellJsonForm",
+		Description: "Shell-form CMD and ENTRYPOINT wrap the command in 'sh -c', which breaks signal handling",
+		Format: func(instruction, current, suggested string) string {
+			return fmt.Sprintf("%s %s should use JSON array form, e.g. %s %s", instruction, current, instruction, suggested)
+		},
+	}
+	RuleWorkdirRelativePath = LinterRule[func(string, string) string]{
+		Name:        "WorkdirRelativePath",
+		Description: "Relative WORKDIR paths are resolved against the previous WORKDIR, which is often surprising",
+		Format: func(relPath, resolved string) string {
+			return fmt.Sprintf("WORKDIR %q is relative and resolves to %q", relPath, resolved)
+		},
+	}
+	RuleMultipleHealthcheck = LinterRule[func(int) string]{
+		Name:        "MultipleHealthcheck",
+		Description: "Each HEALTHCHECK overrides the previous one, so only the last takes effect",
+		Format: func(firstLine int) string {
+			return fmt.Sprintf("HEALTHCHECK overrides the one declared on line %d", firstLine)
+		},
+	}
+	RuleEnvInsteadOfArg = LinterRule[func(string) string]{
+		Name:        "EnvInsteadOfArg",
+		Severity:    SeverityInfo,
+		Description: "ENV variables that are only used at build time should be declared as ARG",
+		Format: func(envName string) string {
+			return fmt.Sprintf("ENV '%s' is only referenced by RUN instructions, use ARG to avoid keeping it in the image config", envName)
+		},
+	}
+	RuleRunBindMountOverCopy = LinterRule[func(string) string]{
+		Name:        "RunBindMountOverCopy",
+		Description: "Files that are only needed during a single RUN instruction can be bind-mounted instead of copied",
+		Format: func(dest string) string {
+			return fmt.Sprintf("Path %q is only used by the following RUN instruction, consider RUN --mount=type=bind instead of COPY", dest)
+		},
+	}
+	RuleAddUsed = LinterRule[func(string) string]{
+		Name:        "AddUsed",
+		Description: "COPY is preferred over ADD when no remote fetching or archive extraction is needed",
+		Format: func(source string) string {
+			return fmt.Sprintf("ADD of local file %q has no extraction or fetch behavior, use COPY instead", source)
+		},
+	}
+	RuleSecretMountPermissions = LinterRule[func(string, string) string]{
+		Name:        "SecretMountPermissions",
+		Description: "Secret mounts should not be readable by group or other users",
+		Format: func(secretID, mode string) string {
+			return fmt.Sprintf("Secret %q is mounted with world- or group-readable mode %s", secretID, mode)
+		},
+	}
+	RuleUnusedArg = LinterRule[func(string) string]{
+		Name:        "UnusedArg",
+		Description: "Declared ARGs should be referenced",
+		Format: func(argName string) string {
+			return fmt.Sprintf("ARG '%s' is declared but never used", argName)
+		},
+	}
+	RuleRunInterpreterMissing = LinterRule[func(string) string]{
+		Name:        "RunInterpreterMissing",
+		Severity:    SeverityError,
+		Description: "The interpreter in a heredoc shebang must be present in the image for the RUN instruction to work",
+		Format: func(interpreter string) string {
+			return fmt.Sprintf("Interpreter %q from the heredoc shebang is not a usable path, the RUN instruction will fail", interpreter)
+		},
+	}
+	RuleFromDigestFormat = LinterRule[func(string, string) string]{
+		Name:        "FromDigestFormat",
+		Severity:    SeverityError,
+		Description: "Digests in FROM references must follow the OCI digest format",
+		Format: func(dgst, reason string) string {
+			return fmt.Sprintf("Digest %q is malformed: %s", dgst, reason)
+		},
+	}
+	RuleRunWgetVerify = LinterRule[func(string) string]{
+		Name:        "RunWgetVerify",
+		Description: "Downloads in RUN instructions should be verified with a checksum or signature",
+		Format: func(command string) string {
+			return fmt.Sprintf("Download with '%s' is not verified, add a checksum check (e.g. sha256sum -c) or use a package manager", command)
+		},
+	}
+	RuleCopyBuildContext = LinterRule[func() string]{
+		Name:        "CopyBuildContext",
+		Description: "Copying the entire build context more than once into the same stage is redundant",
+		Format: func() string {
+			return "The entire build context was already copied into this stage, this copy is redundant"
+		},
+	}
+	RuleRunPythonVirtualenv = LinterRule[func() string]{
+		Name:        "RunPythonVirtualenv",
+		Severity:    SeverityInfo,
+		Description: "Installing Python packages system-wide pollutes the base image's Python environment",
+		Format: func() string {
+			return "pip install without an activated virtualenv installs packages system-wide, use a virtualenv or 'pip install --user'"
+		},
+	}
+	RuleRunTmpDirSize = LinterRule[func() string]{
+		Name:        "RunTmpDirSize",
+		Severity:    SeverityInfo,
+		Description: "Files written to /tmp without cleanup in the same RUN instruction inflate the layer size",
+		Format: func() string {
+			return "RUN writes to /tmp without cleaning up, consider --mount=type=tmpfs,target=/tmp or removing the files in the same instruction"
+		},
+	}
+	RuleLabelValueEmpty = LinterRule[func(string) string]{
+		Name:        "LabelValueEmpty",
+		Description: "Empty label values are usually the result of a failed variable expansion",
+		Format: func(labelKey string) string {
+			return fmt.Sprintf("Value for label %q is empty, was a variable expansion left empty?", labelKey)
+		},
+	}
+	RuleFromSchemeInsecure = LinterRule[func(string) string]{
+		Name:        "FromSchemeInsecure",
+		Description: "Base image references should not use the unencrypted http scheme",
+		Format: func(ref string) string {
+			return fmt.Sprintf("Base image %q is pulled over insecure HTTP, use HTTPS or configure TLS for the registry", ref)
+		},
+	}
+	RuleRunDnfCopr = LinterRule[func(string) string]{
+		Name:         "RunDnfCopr",
+		Severity:     SeverityInfo,
+		Experimental: true,
+		Description:  "Third-party package repositories are not vetted by the distribution and should be audited",
+		Format: func(command string) string {
+			return fmt.Sprintf("Command '%s' enables a third-party package repository, audit its contents before use", command)
+		},
+	}
+	RuleRunWithoutShell = LinterRule[func(string) string]{
+		Name:        "RunWithoutShell",
+		Severity:    SeverityInfo,
+		Description: "Exec-form RUN bypasses the shell, so shell features like variable expansion and chaining do not work",
+		Format: func(command string) string {
+			return fmt.Sprintf("Exec-form RUN with %q does not run in a shell, '$VAR', globbing and '&&' will not work", command)
+		},
+	}
+	RuleSelfConsistentArgCasing = LinterRule[func(string, string) string]{
+		Name:        "SelfConsistentArgCasing",
+		Description: "ARG names within the Dockerfile should use consistent casing",
+		Format: func(argName, correctCasing string) string {
+			return fmt.Sprintf("ARG '%s' should match the casing of the ARG majority (%s)", argName, correctCasing)
+		},
+	}
+	RuleRunNetworkAccess = LinterRule[func(string) string]{
+		Name:         "RunNetworkAccess",
+		Severity:     SeverityInfo,
+		Experimental: true,
+		Description:  "RUN instructions that access the network may fail in air-gapped build environments",
+		Format: func(command string) string {
+			return fmt.Sprintf("Command '%s' accesses the network", command)
+		},
+	}
+	RuleFromSelfReference = LinterRule[func(string) string]{
+		Name:        "FromSelfReference",
+		Severity:    SeverityError,
+		Description: "Stages must not reference themselves, directly or through a cycle",
+		Format: func(cyclePath string) string {
+			return fmt.Sprintf("Circular stage reference: %s", cyclePath)
+		},
+	}
+	RuleFromNewerThanTarget = LinterRule[func(string, string) string]{
+		Name:        "FromNewerThanTarget",
+		Description: "The Dockerfile uses features newer than the declared syntax version",
+		Format: func(feature, minVersion string) string {
+			return fmt.Sprintf("%s requires dockerfile syntax %s or higher, which is newer than the declared syntax version", feature, minVersion)
+		},
+	}
+	RuleRunSetE = LinterRule[func() string]{
+		Name:        "RunSetE",
+		Severity:    SeverityInfo,
+		Description: "Commands chained with ';' continue when an earlier command fails; use '&&' or start the command with 'set -e'",
+		Format: func() string {
+			return "Chaining commands with ';' ignores failures, use '&&' or add 'set -e' as the first command"
+		},
+	}
+	RuleSecretMountPath = LinterRule[func(string, string) string]{
+		Name:        "SecretMountPath",
+		Description: "Secrets should not be mounted under world-readable paths",
+		Format: func(secretID, target string) string {
+			return fmt.Sprintf("Secret %q is mounted to world-readable path %q, consider a restricted path like /run/secrets/", secretID, target)
+		},
+	}
+	RuleCopyDestinationExists = LinterRule[func(string) string]{
+		Name:        "CopyDestinationExists",
+		Severity:    SeverityInfo,
+		Description: "The destination path was already copied to earlier in the stage, which will be overwritten",
+		Format: func(destPath string) string {
+			return fmt.Sprintf("Destination path %q was already copied to and will be overwritten", destPath)
+		},
+	}
 )
+
+// the severity/experimental registry is populated up front so lookups by
+// rule name are valid before any rule has fired
+func init() {
+	registerRuleMeta(RuleStageNameCasing.Name, RuleStageNameCasing.Severity, RuleStageNameCasing.Experimental)
+	registerRuleMeta(RuleFromAsCasing.Name, RuleFromAsCasing.Severity, RuleFromAsCasing.Experimental)
+	registerRuleMeta(RuleNoEmptyContinuations.Name, RuleNoEmptyContinuations.Severity, RuleNoEmptyContinuations.Experimental)
+	registerRuleMeta(RuleSelfConsistentCommandCasing.Name, RuleSelfConsistentCommandCasing.Severity, RuleSelfConsistentCommandCasing.Experimental)
+	registerRuleMeta(RuleFileConsistentCommandCasing.Name, RuleFileConsistentCommandCasing.Severity, RuleFileConsistentCommandCasing.Experimental)
+	registerRuleMeta(RuleDuplicateStageName.Name, RuleDuplicateStageName.Severity, RuleDuplicateStageName.Experimental)
+	registerRuleMeta(RuleReservedStageName.Name, RuleReservedStageName.Severity, RuleReservedStageName.Experimental)
+	registerRuleMeta(RuleMaintainerDeprecated.Name, RuleMaintainerDeprecated.Severity, RuleMaintainerDeprecated.Experimental)
+	registerRuleMeta(RuleUndeclaredArgInFrom.Name, RuleUndeclaredArgInFrom.Severity, RuleUndeclaredArgInFrom.Experimental)
+	registerRuleMeta(RuleExposePortRange.Name, RuleExposePortRange.Severity, RuleExposePortRange.Experimental)
+	registerRuleMeta(RuleHealthcheckInterval.Name, RuleHealthcheckInterval.Severity, RuleHealthcheckInterval.Experimental)
+	registerRuleMeta(RuleFromPlatformMismatch.Name, RuleFromPlatformMismatch.Severity, RuleFromPlatformMismatch.Experimental)
+	registerRuleMeta(RuleCopyChownPattern.Name, RuleCopyChownPattern.Severity, RuleCopyChownPattern.Experimental)
+	registerRuleMeta(RuleUndeclaredArgInRun.Name, RuleUndeclaredArgInRun.Severity, RuleUndeclaredArgInRun.Experimental)
+	registerRuleMeta(RuleUndeclaredArgInEnv.Name, RuleUndeclaredArgInEnv.Severity, RuleUndeclaredArgInEnv.Experimental)
+	registerRuleMeta(RuleUndeclaredArgInLabel.Name, RuleUndeclaredArgInLabel.Severity, RuleUndeclaredArgInLabel.Experimental)
+	registerRuleMeta(RuleConsecutiveRun.Name, RuleConsecutiveRun.Severity, RuleConsecutiveRun.Experimental)
+	registerRuleMeta(RuleRunPipefailMissing.Name, RuleRunPipefailMissing.Severity, RuleRunPipefailMissing.Experimental)
+	registerRuleMeta(RuleLatestTag.Name, RuleLatestTag.Severity, RuleLatestTag.Experimental)
+	registerRuleMeta(RuleShellJsonForm.Name, RuleShellJsonForm.Severity, RuleShellJsonForm.Experimental)
+	registerRuleMeta(RuleWorkdirRelativePath.Name, RuleWorkdirRelativePath.Severity, RuleWorkdirRelativePath.Experimental)
+	registerRuleMeta(RuleMultipleHealthcheck.Name, RuleMultipleHealthcheck.Severity, RuleMultipleHealthcheck.Experimental)
+	registerRuleMeta(RuleEnvInsteadOfArg.Name, RuleEnvInsteadOfArg.Severity, RuleEnvInsteadOfArg.Experimental)
+	registerRuleMeta(RuleRunBindMountOverCopy.Name, RuleRunBindMountOverCopy.Severity, RuleRunBindMountOverCopy.Experimental)
+	registerRuleMeta(RuleAddUsed.Name, RuleAddUsed.Severity, RuleAddUsed.Experimental)
+	registerRuleMeta(RuleSecretMountPermissions.Name, RuleSecretMountPermissions.Severity, RuleSecretMountPermissions.Experimental)
+	registerRuleMeta(RuleUnusedArg.Name, RuleUnusedArg.Severity, RuleUnusedArg.Experimental)
+	registerRuleMeta(RuleRunInterpreterMissing.Name, RuleRunInterpreterMissing.Severity, RuleRunInterpreterMissing.Experimental)
+	registerRuleMeta(RuleFromDigestFormat.Name, RuleFromDigestFormat.Severity, RuleFromDigestFormat.Experimental)
+	registerRuleMeta(RuleRunWgetVerify.Name, RuleRunWgetVerify.Severity, RuleRunWgetVerify.Experimental)
+	registerRuleMeta(RuleCopyBuildContext.Name, RuleCopyBuildContext.Severity, RuleCopyBuildContext.Experimental)
+	registerRuleMeta(RuleRunPythonVirtualenv.Name, RuleRunPythonVirtualenv.Severity, RuleRunPythonVirtualenv.Experimental)
+	registerRuleMeta(RuleRunTmpDirSize.Name, RuleRunTmpDirSize.Severity, RuleRunTmpDirSize.Experimental)
+	registerRuleMeta(RuleLabelValueEmpty.Name, RuleLabelValueEmpty.Severity, RuleLabelValueEmpty.Experimental)
+	registerRuleMeta(RuleFromSchemeInsecure.Name, RuleFromSchemeInsecure.Severity, RuleFromSchemeInsecure.Experimental)
+	registerRuleMeta(RuleRunDnfCopr.Name, RuleRunDnfCopr.Severity, RuleRunDnfCopr.Experimental)
+	registerRuleMeta(RuleRunWithoutShell.Name, RuleRunWithoutShell.Severity, RuleRunWithoutShell.Experimental)
+	registerRuleMeta(RuleSelfConsistentArgCasing.Name, RuleSelfConsistentArgCasing.Severity, RuleSelfConsistentArgCasing.Experimental)
+	registerRuleMeta(RuleRunNetworkAccess.Name, RuleRunNetworkAccess.Severity, RuleRunNetworkAccess.Experimental)
+	registerRuleMeta(RuleFromSelfReference.Name, RuleFromSelfReference.Severity, RuleFromSelfReference.Experimental)
+	registerRuleMeta(RuleFromNewerThanTarget.Name, RuleFromNewerThanTarget.Severity, RuleFromNewerThanTarget.Experimental)
+	registerRuleMeta(RuleRunSetE.Name, RuleRunSetE.Severity, RuleRunSetE.Experimental)
+	registerRuleMeta(RuleSecretMountPath.Name, RuleSecretMountPath.Severity, RuleSecretMountPath.Experimental)
+	registerRuleMeta(RuleCopyDestinationExists.Name, RuleCopyDestinationExists.Severity, RuleCopyDestinationExists.Experimental)
+}
@@ -149,11 +149,11 @@ func (c *BridgeClient) wrapSolveError(solveErr error) error {
 	)
 	if errors.As(solveErr, &ee) {
 		var err error
-		inputIDs, err = c.registerResultIDs(ee.Inputs...)
+		inputIDs, err = c.registerResultIDs(ee.Inputs()...)
 		if err != nil {
 			return err
 		}
-		mountIDs, err = c.registerResultIDs(ee.Mounts...)
+		mountIDs, err = c.registerResultIDs(ee.Mounts()...)
 		if err != nil {
 			return err
 		}
@@ -651,11 +651,11 @@ func (lbf *llbBridgeForwarder) wrapSolveError(solveErr error) error {
 	)
 	if errors.As(solveErr, &ee) {
 		var err error
-		inputIDs, err = lbf.registerResultIDs(ee.Inputs...)
+		inputIDs, err = lbf.registerResultIDs(ee.Inputs()...)
 		if err != nil {
 			return err
 		}
-		mountIDs, err = lbf.registerResultIDs(ee.Mounts...)
+		mountIDs, err = lbf.registerResultIDs(ee.Mounts()...)
 		if err != nil {
 			return err
 		}
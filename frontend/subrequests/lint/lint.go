@@ -8,6 +8,7 @@ import (
 	"sort"
 
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/linter"
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
 	"github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/frontend/subrequests"
@@ -36,6 +37,7 @@ type Warning struct {
 	Description string      `json:"description,omitempty"`
 	URL         string      `json:"url,omitempty"`
 	Detail      string      `json:"detail,omitempty"`
+	Severity    string      `json:"severity,omitempty"`
 	Location    pb.Location `json:"location,omitempty"`
 }
 
@@ -48,6 +50,12 @@ type LintResults struct {
 	Warnings []Warning        `json:"warnings"`
 	Sources  []*pb.SourceInfo `json:"sources"`
 	Error    *BuildError      `json:"buildError,omitempty"`
+	// Errors holds violations of rules with error severity, which fail the
+	// build unless severity enforcement is disabled.
+	Errors []Warning `json:"errors,omitempty"`
+	// ExperimentalWarnings holds violations of experimental rules so they
+	// are not mixed in with stable warnings.
+	ExperimentalWarnings []Warning `json:"experimentalWarnings,omitempty"`
 }
 
 func (results *LintResults) AddSource(sourceMap *llb.SourceMap) int {
@@ -84,13 +92,23 @@ func (results *LintResults) AddWarning(rulename, description, url, fmtmsg string
 		SourceIndex: int32(sourceIndex),
 		Ranges:      sourceLocation,
 	}
-	results.Warnings = append(results.Warnings, Warning{
+	w := Warning{
 		RuleName:    rulename,
 		Description: description,
 		URL:         url,
 		Detail:      fmtmsg,
+		Severity:    linter.Severity(rulename).String(),
 		Location:    pbLocation,
-	})
+	}
+	if linter.IsExperimental(rulename) {
+		results.ExperimentalWarnings = append(results.ExperimentalWarnings, w)
+		return
+	}
+	if linter.Severity(rulename) == linter.SeverityError {
+		results.Errors = append(results.Errors, w)
+		return
+	}
+	results.Warnings = append(results.Warnings, w)
 }
 
 func (results *LintResults) ToResult() (*client.Result, error) {
@@ -107,10 +125,19 @@ func (results *LintResults) ToResult() (*client.Result, error) {
 	}
 	res.AddMeta("result.txt", b.Bytes())
 
+	sarif, err := results.ToSARIF()
+	if err != nil {
+		return nil, err
+	}
+	res.AddMeta("result.sarif", sarif)
+
 	status := 0
 	if len(results.Warnings) > 0 {
 		status = 1
 	}
+	if len(results.Errors) > 0 {
+		status = 2
+	}
 	res.AddMeta("result.statuscode", []byte(fmt.Sprintf("%d", status)))
 
 	res.AddMeta("version", []byte(SubrequestLintDefinition.Version))
@@ -0,0 +1,152 @@
+package lint
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// SARIF 2.1.0 document structure, limited to the fields emitted for lint
+// results. See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifDocument struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID               string        `json:"id"`
+	ShortDescription *sarifMessage `json:"shortDescription,omitempty"`
+	HelpURI          string        `json:"helpUri,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarifLevel maps lint severities to SARIF levels
+func sarifLevel(severity string) string {
+	switch severity {
+	case "error":
+		return "error"
+	case "info":
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// ToSARIF serializes the lint results as a SARIF 2.1.0 document compatible
+// with code scanning integrations. Error-severity and experimental
+// violations are included alongside the stable warnings; experimental rules
+// map to the "note" level through their severity.
+func (results *LintResults) ToSARIF() ([]byte, error) {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{Name: "buildkit-lint"},
+		},
+		Results: []sarifResult{},
+	}
+
+	all := make([]Warning, 0, len(results.Errors)+len(results.Warnings)+len(results.ExperimentalWarnings))
+	all = append(all, results.Errors...)
+	all = append(all, results.Warnings...)
+	all = append(all, results.ExperimentalWarnings...)
+
+	seenRules := map[string]struct{}{}
+	for _, w := range all {
+		if _, ok := seenRules[w.RuleName]; !ok {
+			seenRules[w.RuleName] = struct{}{}
+			rule := sarifRule{ID: w.RuleName, HelpURI: w.URL}
+			if w.Description != "" {
+				rule.ShortDescription = &sarifMessage{Text: w.Description}
+			}
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+		}
+
+		res := sarifResult{
+			RuleID:  w.RuleName,
+			Level:   sarifLevel(w.Severity),
+			Message: sarifMessage{Text: w.Detail},
+		}
+		uri := ""
+		if int(w.Location.SourceIndex) < len(results.Sources) && results.Sources[w.Location.SourceIndex] != nil {
+			uri = results.Sources[w.Location.SourceIndex].Filename
+		}
+		for _, r := range w.Location.Ranges {
+			res.Locations = append(res.Locations, sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: uri},
+					Region: sarifRegion{
+						StartLine:   int(r.Start.Line),
+						StartColumn: int(r.Start.Character),
+						EndLine:     int(r.End.Line),
+						EndColumn:   int(r.End.Character),
+					},
+				},
+			})
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	return json.MarshalIndent(sarifDocument{
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+}
+
+// PrintSARIF writes the JSON-encoded lint results from dt to w in SARIF
+// format, mirroring PrintLintViolations for the human-readable output.
+func PrintSARIF(dt []byte, w io.Writer) error {
+	var results LintResults
+	if err := json.Unmarshal(dt, &results); err != nil {
+		return err
+	}
+	out, err := results.ToSARIF()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
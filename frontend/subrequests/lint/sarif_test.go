@@ -0,0 +1,78 @@
+package lint
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToSARIF(t *testing.T) {
+	results := &LintResults{
+		Sources: []*pb.SourceInfo{{Filename: "Dockerfile"}},
+		Warnings: []Warning{
+			{
+				RuleName:    "StageNameCasing",
+				Description: "Stage names should be lowercase",
+				Detail:      "Stage name 'Bad' should be lowercase",
+				Severity:    "warning",
+				Location: pb.Location{
+					SourceIndex: 0,
+					Ranges:      []*pb.Range{{Start: pb.Position{Line: 3, Character: 1}, End: pb.Position{Line: 3, Character: 10}}},
+				},
+			},
+		},
+		Errors: []Warning{
+			{
+				RuleName: "FromDigestFormat",
+				Detail:   "Digest is malformed",
+				Severity: "error",
+			},
+		},
+		ExperimentalWarnings: []Warning{
+			{
+				RuleName: "RunNetworkAccess",
+				Detail:   "Command 'curl' accesses the network",
+				Severity: "info",
+			},
+		},
+	}
+
+	dt, err := results.ToSARIF()
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(dt, &doc))
+	require.Equal(t, "2.1.0", doc["version"])
+	require.Contains(t, doc["$schema"], "sarif-schema-2.1.0")
+
+	runs := doc["runs"].([]interface{})
+	require.Len(t, runs, 1)
+	run := runs[0].(map[string]interface{})
+
+	sarifResults := run["results"].([]interface{})
+	require.Len(t, sarifResults, 3)
+
+	// every result carries the fields required by the SARIF 2.1.0 schema
+	levels := map[string]string{}
+	for _, r := range sarifResults {
+		res := r.(map[string]interface{})
+		require.NotEmpty(t, res["ruleId"])
+		require.Contains(t, []string{"error", "warning", "note"}, res["level"])
+		require.NotEmpty(t, res["message"].(map[string]interface{})["text"])
+		levels[res["ruleId"].(string)] = res["level"].(string)
+	}
+	require.Equal(t, "error", levels["FromDigestFormat"])
+	require.Equal(t, "warning", levels["StageNameCasing"])
+	require.Equal(t, "note", levels["RunNetworkAccess"])
+
+	warn := sarifResults[1].(map[string]interface{})
+	loc := warn["locations"].([]interface{})[0].(map[string]interface{})
+	phys := loc["physicalLocation"].(map[string]interface{})
+	require.Equal(t, "Dockerfile", phys["artifactLocation"].(map[string]interface{})["uri"])
+	require.Equal(t, float64(3), phys["region"].(map[string]interface{})["startLine"])
+
+	rules := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})["rules"].([]interface{})
+	require.Len(t, rules, 3)
+}
@@ -0,0 +1,40 @@
+package solver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheManagerInvalidation(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	cm := NewInMemoryCacheManager()
+	hook, ok := WithInvalidationHook(cm)
+	require.True(t, ok)
+
+	k := NewCacheKey(digest.FromString("op"), digest.FromString("vtx"), 0)
+	_, err := cm.Save(k, &dummyResult{id: "res0", value: "content"}, time.Now())
+	require.NoError(t, err)
+
+	recs, err := cm.Records(ctx, k)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+
+	// invalidation makes the next lookup miss without deleting the data
+	require.NoError(t, hook.Invalidate(ctx, []*CacheKey{k}))
+	recs, err = cm.Records(ctx, k)
+	require.NoError(t, err)
+	require.Empty(t, recs)
+
+	// saving a fresh result clears the stale mark
+	_, err = cm.Save(k, &dummyResult{id: "res1", value: "content"}, time.Now())
+	require.NoError(t, err)
+	recs, err = cm.Records(ctx, k)
+	require.NoError(t, err)
+	require.NotEmpty(t, recs)
+}
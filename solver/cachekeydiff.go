@@ -0,0 +1,62 @@
+package solver
+
+import (
+	"fmt"
+)
+
+// DiffCacheKeys recursively compares two cache key trees and returns a
+// human-readable list of differing fields, e.g.
+// "dep[1][0].digest: sha256:abc... vs sha256:def...". It is meant for
+// debugging why a vertex that previously hit the cache now misses. Nil keys
+// compare as empty.
+func DiffCacheKeys(a, b *CacheKey) []string {
+	return diffCacheKeys(a, b, "")
+}
+
+func diffCacheKeys(a, b *CacheKey, prefix string) []string {
+	if a == nil || b == nil {
+		if a != b {
+			return []string{fmt.Sprintf("%skey: %s vs %s", prefix, cacheKeyID(a), cacheKeyID(b))}
+		}
+		return nil
+	}
+
+	var diffs []string
+	if a.Digest() != b.Digest() {
+		diffs = append(diffs, fmt.Sprintf("%sdigest: %s vs %s", prefix, a.Digest(), b.Digest()))
+	}
+	if a.Output() != b.Output() {
+		diffs = append(diffs, fmt.Sprintf("%soutput: %d vs %d", prefix, a.Output(), b.Output()))
+	}
+	if a.vtx != b.vtx {
+		diffs = append(diffs, fmt.Sprintf("%svtx: %s vs %s", prefix, a.vtx, b.vtx))
+	}
+
+	aDeps, bDeps := a.Deps(), b.Deps()
+	if len(aDeps) != len(bDeps) {
+		diffs = append(diffs, fmt.Sprintf("%sdeps: %d inputs vs %d inputs", prefix, len(aDeps), len(bDeps)))
+		return diffs
+	}
+	for i := range aDeps {
+		if len(aDeps[i]) != len(bDeps[i]) {
+			diffs = append(diffs, fmt.Sprintf("%sdep[%d]: %d keys vs %d keys", prefix, i, len(aDeps[i]), len(bDeps[i])))
+			continue
+		}
+		for j := range aDeps[i] {
+			da, db := aDeps[i][j], bDeps[i][j]
+			depPrefix := fmt.Sprintf("%sdep[%d][%d].", prefix, i, j)
+			if da.Selector != db.Selector {
+				diffs = append(diffs, fmt.Sprintf("%sselector: %s vs %s", depPrefix, da.Selector, db.Selector))
+			}
+			diffs = append(diffs, diffCacheKeys(da.CacheKey.CacheKey, db.CacheKey.CacheKey, depPrefix)...)
+		}
+	}
+	return diffs
+}
+
+func cacheKeyID(k *CacheKey) string {
+	if k == nil {
+		return "<nil>"
+	}
+	return k.ID
+}
@@ -0,0 +1,74 @@
+package solver
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCacheKeys(t *testing.T) {
+	depA := NewCacheKey(digest.FromString("dep-a"), digest.FromString("vtx-dep"), 0)
+	depB := NewCacheKey(digest.FromString("dep-b"), digest.FromString("vtx-dep"), 0)
+
+	a := NewCacheKey(digest.FromString("op"), digest.FromString("vtx"), 0)
+	a.deps = [][]CacheKeyWithSelector{{{CacheKey: ExportableCacheKey{CacheKey: depA}}}}
+	b := NewCacheKey(digest.FromString("op"), digest.FromString("vtx"), 0)
+	b.deps = [][]CacheKeyWithSelector{{{CacheKey: ExportableCacheKey{CacheKey: depB}}}}
+
+	// identical keys produce no diff
+	require.Empty(t, DiffCacheKeys(a, a))
+
+	diffs := DiffCacheKeys(a, b)
+	require.Len(t, diffs, 1)
+	require.Contains(t, diffs[0], "dep[0][0].digest:")
+	require.Contains(t, diffs[0], digest.FromString("dep-a").String())
+	require.Contains(t, diffs[0], digest.FromString("dep-b").String())
+
+	// top-level digest changes are reported too
+	c := NewCacheKey(digest.FromString("other-op"), digest.FromString("vtx"), 0)
+	diffs = DiffCacheKeys(a, c)
+	require.Contains(t, diffs[0], "digest:")
+}
+
+func TestCacheDiffDebugTracksPreviousKeys(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+	// simulate BUILDKIT_CACHE_DIFF=1
+	s.prevCacheKeys = &sync.Map{}
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	res, err := j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v0", cacheKeySeed: "seed0", value: "result0", ignoreCache: true}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+	require.NoError(t, j0.Discard())
+
+	v := vtx(vtxOpt{name: "v0", cacheKeySeed: "seed0", value: "result0"})
+	prev, ok := s.prevCacheKeys.Load(v.Digest())
+	require.True(t, ok)
+	firstKey := prev.(*CacheKey)
+
+	// a changed cache seed for the same vertex digest records the new key
+	// (and logs the diff against the previous one)
+	j1, err := s.NewJob("job1")
+	require.NoError(t, err)
+	defer j1.Discard()
+	_, err = j1.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v0", cacheKeySeed: "seed1", value: "result1", ignoreCache: true}),
+	})
+	require.NoError(t, err)
+
+	prev, ok = s.prevCacheKeys.Load(v.Digest())
+	require.True(t, ok)
+	require.NotEmpty(t, DiffCacheKeys(firstKey, prev.(*CacheKey)))
+}
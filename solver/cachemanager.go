@@ -39,6 +39,55 @@ type cacheManager struct {
 
 	backend CacheKeyStorage
 	results CacheResultStorage
+
+	// stale marks cache key ids whose records were invalidated externally.
+	// Stale records are skipped (not deleted) until a new result is saved
+	// for the key.
+	staleMu sync.Mutex
+	stale   map[string]struct{}
+}
+
+// CacheInvalidationHook invalidates specific cache entries, e.g. when a
+// source file changed without a rebuild.
+type CacheInvalidationHook interface {
+	Invalidate(ctx context.Context, keys []*CacheKey) error
+}
+
+// WithInvalidationHook returns the invalidation hook of a cache manager so
+// external systems (like the file watcher in util/cacheinvalidation) can
+// mark entries stale. It reports false for managers that don't support
+// invalidation, e.g. combined or remote managers.
+func WithInvalidationHook(cm CacheManager) (CacheInvalidationHook, bool) {
+	hook, ok := cm.(CacheInvalidationHook)
+	return hook, ok
+}
+
+// Invalidate marks the records for the given cache keys as stale. The
+// underlying data isn't deleted; the next Records lookup simply misses until
+// a fresh result is saved for the key.
+func (c *cacheManager) Invalidate(ctx context.Context, keys []*CacheKey) error {
+	c.staleMu.Lock()
+	defer c.staleMu.Unlock()
+	if c.stale == nil {
+		c.stale = map[string]struct{}{}
+	}
+	for _, k := range keys {
+		c.stale[c.getID(k)] = struct{}{}
+	}
+	return nil
+}
+
+func (c *cacheManager) isStale(id string) bool {
+	c.staleMu.Lock()
+	defer c.staleMu.Unlock()
+	_, ok := c.stale[id]
+	return ok
+}
+
+func (c *cacheManager) clearStale(id string) {
+	c.staleMu.Lock()
+	delete(c.stale, id)
+	c.staleMu.Unlock()
 }
 
 func (c *cacheManager) ReleaseUnreferenced(ctx context.Context) error {
@@ -149,6 +198,10 @@ func (c *cacheManager) Records(ctx context.Context, ck *CacheKey) (rrecs []*Cach
 		lg.WithError(rerr).WithField("return_records", rrercsField).Trace("cache manager")
 	}()
 
+	if c.isStale(c.getID(ck)) {
+		return []*CacheRecord{}, nil
+	}
+
 	outs := make([]*CacheRecord, 0)
 	if err := c.backend.WalkResults(c.getID(ck), func(r CacheResult) error {
 		if c.results.Exists(ctx, r.ID) {
@@ -316,6 +369,7 @@ func (c *cacheManager) Save(k *CacheKey, r Result, createdAt time.Time) (rck *Ex
 	if err != nil {
 		return nil, err
 	}
+	c.clearStale(c.getID(k))
 	if err := c.backend.AddResult(c.getID(k), res); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,67 @@
+package solver
+
+import (
+	"context"
+
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CacheReporter receives structured notifications about the cache hit/miss
+// decisions made by the edge state machine. It replaces ad-hoc debug logging
+// for cache analysis tooling.
+type CacheReporter interface {
+	// ReportHit is called when an edge result is loaded from cache.
+	ReportHit(v Vertex, k *CacheKey, backend string)
+	// ReportMiss is called when an edge executes its op because no cache
+	// record matched.
+	ReportMiss(v Vertex, k *CacheKey, backend string)
+}
+
+// LoggingCacheReporter logs every cache decision
+type LoggingCacheReporter struct{}
+
+func (LoggingCacheReporter) ReportHit(v Vertex, k *CacheKey, backend string) {
+	bklog.G(context.TODO()).
+		WithField("vertex_name", v.Name()).
+		WithField("vertex_digest", v.Digest()).
+		WithField("backend", backend).
+		Debug("cache hit")
+}
+
+func (LoggingCacheReporter) ReportMiss(v Vertex, k *CacheKey, backend string) {
+	bklog.G(context.TODO()).
+		WithField("vertex_name", v.Name()).
+		WithField("vertex_digest", v.Digest()).
+		WithField("backend", backend).
+		Debug("cache miss")
+}
+
+// PrometheusCacheReporter increments labeled counters for every cache decision
+type PrometheusCacheReporter struct {
+	hits   *prometheus.CounterVec
+	misses *prometheus.CounterVec
+}
+
+func NewPrometheusCacheReporter(r prometheus.Registerer) *PrometheusCacheReporter {
+	p := &PrometheusCacheReporter{
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "buildkit_solver_cache_hits_total",
+			Help: "Number of edge results loaded from cache.",
+		}, []string{"backend"}),
+		misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "buildkit_solver_cache_misses_total",
+			Help: "Number of edge results that had to be executed.",
+		}, []string{"backend"}),
+	}
+	r.MustRegister(p.hits, p.misses)
+	return p
+}
+
+func (p *PrometheusCacheReporter) ReportHit(v Vertex, k *CacheKey, backend string) {
+	p.hits.WithLabelValues(backend).Inc()
+}
+
+func (p *PrometheusCacheReporter) ReportMiss(v Vertex, k *CacheKey, backend string) {
+	p.misses.WithLabelValues(backend).Inc()
+}
@@ -91,8 +91,32 @@ type edge struct {
 	keysDidChange bool
 	index         *edgeIndex
 
+	// mergedIgnoreCache is set when an ignore-cache edge was merged into
+	// this edge, which downgrades it to ignore-cache behavior
+	mergedIgnoreCache bool
+
 	secondaryExporters []expDep
 
+	// lastDispatchTime and queuedAt are only accessed under the scheduler
+	// queue mutex and only maintained when the corresponding scheduler
+	// option is configured
+	lastDispatchTime time.Time
+	queuedAt         time.Time
+
+	cacheReporter    CacheReporter
+	resultComparator ResultComparator
+	resultHistory    *resultHistory
+	prevCacheKeys    *sync.Map
+	resultStore      ResultStore
+
+	// completionNotified tracks whether the scheduler's edge completion
+	// callback already fired for this edge
+	completionNotified bool
+
+	// dispatchCount is incremented on every dispatch; used by the deadlock
+	// detector to observe progress. Only accessed under the scheduler mutex.
+	dispatchCount int
+
 	failedOnce sync.Once
 	debug      bool
 }
@@ -192,6 +216,22 @@ func (e *edge) commitOptions() ([]*CacheKey, []CachedResult) {
 	return []*CacheKey{k}, results
 }
 
+// estimateCost scores the edge for priority scheduling without any extra
+// lookups: the cost is SchedulerWeight*100 plus 10 per dependency that has
+// not completed yet plus 1 per open dependency request. Edges closer to the
+// critical path (more incomplete deps, more open requests) score higher than
+// leaves. It reads dispatch-loop-owned state and must only be called while
+// the scheduler's dispatch mutex is held.
+func (e *edge) estimateCost() int64 {
+	incomplete := int64(len(e.edge.Vertex.Inputs()))
+	for _, d := range e.deps {
+		if d.state == edgeStatusComplete {
+			incomplete--
+		}
+	}
+	return int64(e.edge.Vertex.Options().SchedulerWeight)*100 + incomplete*10 + int64(len(e.depRequests))
+}
+
 // isComplete returns true if edge state is final and will never change
 func (e *edge) isComplete() bool {
 	return e.err != nil || e.result != nil
@@ -223,7 +263,7 @@ func (e *edge) probeCache(d *dep, depKeys []CacheKeyWithSelector) bool {
 	if len(depKeys) == 0 {
 		return false
 	}
-	if e.op.IgnoreCache() {
+	if e.op.IgnoreCache() || e.mergedIgnoreCache {
 		return false
 	}
 	keys, err := e.op.Cache().Query(depKeys, d.index, e.cacheMap.Digest, e.edge.Index)
@@ -751,7 +791,11 @@ func (e *edge) respondToIncoming(incoming []pipe.Sender, allPipes []pipe.Receive
 	}
 
 	if allIncomingCanComplete && e.hasActiveOutgoing {
-		// cancel all current requests
+		// cancel all current requests. This is also the path that propagates
+		// cancellation to in-flight work when every incoming request has been
+		// cancelled: allIncomingCanComplete stays true in that case, so the
+		// outgoing pipes (including function requests driving the exec) get
+		// cancelled here instead of running to completion in the background.
 		for _, p := range allPipes {
 			p.Cancel()
 		}
@@ -800,6 +844,8 @@ func (e *edge) respondToIncoming(incoming []pipe.Sender, allPipes []pipe.Receive
 // that need to complete to continue processing the edge
 func (e *edge) createInputRequests(desiredState edgeStatusType, f *pipeFactory, force bool) bool {
 	addedNew := false
+	var batch []batchedInputRequest
+	var batchDeps []*dep
 
 	// initialize deps state
 	if e.deps == nil {
@@ -881,13 +927,15 @@ func (e *edge) createInputRequests(desiredState edgeStatusType, f *pipeFactory,
 						Debug("add input request")
 				}
 
-				req := f.NewInputRequest(e.edge.Vertex.Inputs()[int(dep.index)], &edgeRequest{
-					currentState: dep.edgeState,
-					desiredState: desiredStateDep,
-					currentKeys:  len(dep.keys),
+				batch = append(batch, batchedInputRequest{
+					edge: e.edge.Vertex.Inputs()[int(dep.index)],
+					req: &edgeRequest{
+						currentState: dep.edgeState,
+						desiredState: desiredStateDep,
+						currentKeys:  len(dep.keys),
+					},
 				})
-				e.depRequests[req] = dep
-				dep.req = req
+				batchDeps = append(batchDeps, dep)
 				addedNew = true
 			}
 		} else if e.debug {
@@ -905,16 +953,39 @@ func (e *edge) createInputRequests(desiredState edgeStatusType, f *pipeFactory,
 		if dep.state == edgeStatusComplete && dep.slowCacheReq == nil && (e.slowCacheFunc(dep) != nil || e.preprocessFunc(dep) != nil) && e.cacheMap != nil {
 			pfn := e.preprocessFunc(dep)
 			fn := e.slowCacheFunc(dep)
+			pred := e.cacheMap.Deps[int(dep.index)].ComputeDigestPredicateFunc
 			res := dep.result
-			func(pfn PreprocessFunc, fn ResultBasedCacheFunc, res Result, index Index) {
+			func(pfn PreprocessFunc, fn ResultBasedCacheFunc, pred ConditionalSlowCacheFunc, res Result, index Index) {
 				dep.slowCacheReq = f.NewFuncRequest(func(ctx context.Context) (interface{}, error) {
+					if pred != nil && fn != nil {
+						ok, err := pred(ctx, res)
+						if err != nil {
+							return nil, errors.Wrap(err, "failed to evaluate slow cache predicate")
+						}
+						if !ok {
+							// treat as no slow-cache key for this input
+							if pfn == nil {
+								return digest.Digest(""), nil
+							}
+							fn = nil
+						}
+					}
 					v, err := e.op.CalcSlowCache(ctx, index, pfn, fn, res)
 					return v, errors.Wrap(err, "failed to compute cache key")
 				})
-			}(pfn, fn, res, dep.index)
+			}(pfn, fn, pred, res, dep.index)
 			addedNew = true
 		}
 	}
+
+	// issue all dependency lookups at once so every distinct target edge is
+	// only signalled a single time
+	if len(batch) > 0 {
+		for i, req := range f.NewBatchedRequest(batch) {
+			e.depRequests[req] = batchDeps[i]
+			batchDeps[i].req = req
+		}
+	}
 	return addedNew
 }
 
@@ -961,6 +1032,14 @@ func (e *edge) loadCache(ctx context.Context) (interface{}, error) {
 	rec := getBestResult(recs)
 	e.cacheRecordsLoaded[rec.ID] = struct{}{}
 
+	if r := e.cacheReporter; r != nil {
+		backend := ""
+		if rec.cacheManager != nil {
+			backend = rec.cacheManager.ID()
+		}
+		r.ReportHit(e.edge.Vertex, rec.key, backend)
+	}
+
 	bklog.G(ctx).Debugf("load cache for %s with %s", e.edge.Vertex.Name(), rec.ID)
 	res, err := e.op.LoadCache(ctx, rec)
 	if err != nil {
@@ -968,12 +1047,49 @@ func (e *edge) loadCache(ctx context.Context) (interface{}, error) {
 		return nil, errors.Wrap(err, "failed to load cache")
 	}
 
-	return NewCachedResult(res, []ExportableCacheKey{{CacheKey: rec.key, Exporter: &exporter{k: rec.key, record: rec, edge: e}}}), nil
+	cres := NewCachedResult(res, []ExportableCacheKey{{CacheKey: rec.key, Exporter: &exporter{k: rec.key, record: rec, edge: e}}})
+
+	if cmp := e.resultComparator; cmp != nil && e.resultHistory != nil {
+		if prev, ok := e.resultHistory.get(cres.ID()); ok {
+			equal, err := cmp.Equal(prev, cres)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to compare cached result")
+			}
+			if !equal {
+				// treated like a failed cache load by processUpdate: the
+				// record is dropped and the edge falls back to executing
+				res.Release(context.TODO())
+				return nil, errors.Errorf("cached result for %s failed equivalence check", e.edge.Vertex.Name())
+			}
+		}
+	}
+
+	return cres, nil
 }
 
 // execOp creates a request to execute the vertex operation
 func (e *edge) execOp(ctx context.Context) (interface{}, error) {
 	cacheKeys, inputs := e.commitOptions()
+
+	// with BUILDKIT_CACHE_DIFF=1, explain why a vertex that produced a
+	// result before is executing again instead of hitting the cache
+	if e.prevCacheKeys != nil && len(cacheKeys) > 0 {
+		dgst := e.edge.Vertex.Digest()
+		if prev, ok := e.prevCacheKeys.Load(dgst); ok {
+			if diffs := DiffCacheKeys(prev.(*CacheKey), cacheKeys[0]); len(diffs) > 0 {
+				bklog.G(ctx).Warnf("cache miss for %s, cache key changed since previous result: %s", e.edge.Vertex.Name(), strings.Join(diffs, ", "))
+			}
+		}
+		e.prevCacheKeys.Store(dgst, cacheKeys[0])
+	}
+
+	if r := e.cacheReporter; r != nil {
+		var k *CacheKey
+		if len(cacheKeys) > 0 {
+			k = cacheKeys[0]
+		}
+		r.ReportMiss(e.edge.Vertex, k, e.op.Cache().ID())
+	}
 	results, subExporters, err := e.op.Exec(ctx, toResultSlice(inputs))
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -1021,7 +1137,16 @@ func (e *edge) execOp(ctx context.Context) (interface{}, error) {
 		})
 	}
 
-	return NewCachedResult(res, ek), nil
+	cres := NewCachedResult(res, ek)
+	if e.resultComparator != nil && e.resultHistory != nil {
+		e.resultHistory.put(cres)
+	}
+	if e.resultStore != nil {
+		if _, err := e.resultStore.Save(ctx, cres); err != nil {
+			bklog.G(ctx).WithError(err).Warn("failed to persist result to result store")
+		}
+	}
+	return cres, nil
 }
 
 func (e *edge) isDep(e2 *edge) bool {
@@ -0,0 +1,99 @@
+package solver
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// EdgeDecision is a scheduling decision made for an edge, keyed by the
+// vertex digest it applies to.
+type EdgeDecision string
+
+const (
+	// EdgeDecisionMerged means the edge was merged into an equivalent edge.
+	EdgeDecisionMerged EdgeDecision = "merged"
+	// EdgeDecisionMergeSkipped means an equivalent edge existed but the
+	// merge was not performed.
+	EdgeDecisionMergeSkipped EdgeDecision = "merge-skipped"
+	// EdgeDecisionFailed means the edge completed with an error.
+	EdgeDecisionFailed EdgeDecision = "failed"
+)
+
+// EdgeMetadataStore persists scheduling decisions so they can be inspected
+// after the build, or survive daemon restarts when a durable implementation
+// is used.
+type EdgeMetadataStore interface {
+	RecordDecision(vertexDigest string, decision EdgeDecision)
+	GetDecision(vertexDigest string) (EdgeDecision, bool)
+}
+
+// MemoryEdgeMetadataStore keeps decisions in process memory
+type MemoryEdgeMetadataStore struct {
+	mu        sync.RWMutex
+	decisions map[string]EdgeDecision
+}
+
+func NewMemoryEdgeMetadataStore() *MemoryEdgeMetadataStore {
+	return &MemoryEdgeMetadataStore{decisions: map[string]EdgeDecision{}}
+}
+
+func (s *MemoryEdgeMetadataStore) RecordDecision(vertexDigest string, decision EdgeDecision) {
+	s.mu.Lock()
+	s.decisions[vertexDigest] = decision
+	s.mu.Unlock()
+}
+
+func (s *MemoryEdgeMetadataStore) GetDecision(vertexDigest string) (EdgeDecision, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.decisions[vertexDigest]
+	return d, ok
+}
+
+var edgeDecisionBucket = []byte("edge-decisions")
+
+// BoltDBEdgeMetadataStore persists decisions in a bolt database so they
+// survive daemon restarts. Write errors are swallowed: decision recording is
+// best-effort and must not interfere with the build.
+type BoltDBEdgeMetadataStore struct {
+	db *bolt.DB
+}
+
+func NewBoltDBEdgeMetadataStore(dbPath string) (*BoltDBEdgeMetadataStore, error) {
+	db, err := bolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open edge metadata store")
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(edgeDecisionBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to initialize edge metadata store")
+	}
+	return &BoltDBEdgeMetadataStore{db: db}, nil
+}
+
+func (s *BoltDBEdgeMetadataStore) RecordDecision(vertexDigest string, decision EdgeDecision) {
+	_ = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(edgeDecisionBucket).Put([]byte(vertexDigest), []byte(decision))
+	})
+}
+
+func (s *BoltDBEdgeMetadataStore) GetDecision(vertexDigest string) (EdgeDecision, bool) {
+	var d EdgeDecision
+	var ok bool
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(edgeDecisionBucket).Get([]byte(vertexDigest)); v != nil {
+			d, ok = EdgeDecision(v), true
+		}
+		return nil
+	})
+	return d, ok
+}
+
+func (s *BoltDBEdgeMetadataStore) Close() error {
+	return s.db.Close()
+}
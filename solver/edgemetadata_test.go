@@ -0,0 +1,76 @@
+package solver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryEdgeMetadataStore(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryEdgeMetadataStore()
+	_, ok := store.GetDecision("unknown")
+	require.False(t, ok)
+
+	store.RecordDecision("vtx0", EdgeDecisionMerged)
+	d, ok := store.GetDecision("vtx0")
+	require.True(t, ok)
+	require.Equal(t, EdgeDecisionMerged, d)
+}
+
+func TestBoltDBEdgeMetadataStore(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "edges.db")
+	store, err := NewBoltDBEdgeMetadataStore(dbPath)
+	require.NoError(t, err)
+
+	store.RecordDecision("vtx0", EdgeDecisionFailed)
+	d, ok := store.GetDecision("vtx0")
+	require.True(t, ok)
+	require.Equal(t, EdgeDecisionFailed, d)
+	require.NoError(t, store.Close())
+
+	// decisions survive reopening the database
+	store, err = NewBoltDBEdgeMetadataStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+	d, ok = store.GetDecision("vtx0")
+	require.True(t, ok)
+	require.Equal(t, EdgeDecisionFailed, d)
+}
+
+func TestEdgeMetadataStoreRecordsDecisions(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	store := NewMemoryEdgeMetadataStore()
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+	s.s.Stop()
+	s.s = newScheduler(s, WithEdgeMetadataStore(store))
+
+	// a failing vertex records a failed decision through dispatch
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	defer j0.Discard()
+
+	failing := vtx(vtxOpt{
+		name: "failing",
+		cachePreFunc: func(context.Context) error {
+			return errors.New("cache map failed")
+		},
+	})
+	_, err = j0.Build(ctx, Edge{Vertex: failing})
+	require.Error(t, err)
+
+	d, ok := store.GetDecision(failing.Digest().String())
+	require.True(t, ok)
+	require.Equal(t, EdgeDecisionFailed, d)
+}
@@ -0,0 +1,14 @@
+package errdefs
+
+import "fmt"
+
+// DeadlockError is returned when the scheduler determines that an edge has
+// open incoming requests but no pending work that could ever complete them.
+type DeadlockError struct {
+	VertexName   string
+	VertexDigest string
+}
+
+func (e *DeadlockError) Error() string {
+	return fmt.Sprintf("scheduler deadlock detected: edge %s (%s) has open requests but no pending work. Please report this with BUILDKIT_SCHEDULER_DEBUG=1", e.VertexName, e.VertexDigest)
+}
@@ -0,0 +1,6 @@
+package errdefs
+
+import "github.com/pkg/errors"
+
+// ErrAlreadyReleased is returned when a reference is released more than once.
+var ErrAlreadyReleased = errors.New("reference was already released")
@@ -0,0 +1,109 @@
+package solver
+
+import (
+	digest "github.com/opencontainers/go-digest"
+)
+
+// BuildEventSink receives structured notifications about the lifecycle of
+// vertexes and builds. It decouples build-event streaming systems from the
+// progress writer infrastructure.
+type BuildEventSink interface {
+	// OnVertexQueued is called when a vertex becomes part of the active
+	// build graph.
+	OnVertexQueued(v Vertex)
+	// OnVertexStarted is called when the vertex op starts executing.
+	OnVertexStarted(v Vertex)
+	// OnVertexCompleted is called when a vertex result is available. cached
+	// is true when the result was loaded from cache instead of executed.
+	OnVertexCompleted(v Vertex, cached bool)
+	// OnVertexFailed is called when the vertex evaluation failed.
+	OnVertexFailed(v Vertex, err error)
+	// OnBuildComplete is called once per build with the final results.
+	OnBuildComplete(results []CachedResult, err error)
+}
+
+// MultiSink fans events out to multiple sinks in order
+func MultiSink(sinks ...BuildEventSink) BuildEventSink {
+	return multiSink(sinks)
+}
+
+type multiSink []BuildEventSink
+
+func (m multiSink) OnVertexQueued(v Vertex) {
+	for _, s := range m {
+		s.OnVertexQueued(v)
+	}
+}
+
+func (m multiSink) OnVertexStarted(v Vertex) {
+	for _, s := range m {
+		s.OnVertexStarted(v)
+	}
+}
+
+func (m multiSink) OnVertexCompleted(v Vertex, cached bool) {
+	for _, s := range m {
+		s.OnVertexCompleted(v, cached)
+	}
+}
+
+func (m multiSink) OnVertexFailed(v Vertex, err error) {
+	for _, s := range m {
+		s.OnVertexFailed(v, err)
+	}
+}
+
+func (m multiSink) OnBuildComplete(results []CachedResult, err error) {
+	for _, s := range m {
+		s.OnBuildComplete(results, err)
+	}
+}
+
+// BuildEvent is the wire representation of a single sink notification used
+// by GRPCStreamSink.
+type BuildEvent struct {
+	Type   string        `json:"type"`
+	Digest digest.Digest `json:"digest,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Cached bool          `json:"cached,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// eventStream is the subset of a gRPC stream used by GRPCStreamSink
+type eventStream interface {
+	SendMsg(m interface{}) error
+}
+
+// GRPCStreamSink serializes build events onto a gRPC stream. Send errors are
+// dropped; event streaming is best-effort and must not fail the build.
+type GRPCStreamSink struct {
+	Stream eventStream
+}
+
+func (s *GRPCStreamSink) send(ev *BuildEvent) {
+	_ = s.Stream.SendMsg(ev)
+}
+
+func (s *GRPCStreamSink) OnVertexQueued(v Vertex) {
+	s.send(&BuildEvent{Type: "vertex.queued", Digest: v.Digest(), Name: v.Name()})
+}
+
+func (s *GRPCStreamSink) OnVertexStarted(v Vertex) {
+	s.send(&BuildEvent{Type: "vertex.started", Digest: v.Digest(), Name: v.Name()})
+}
+
+func (s *GRPCStreamSink) OnVertexCompleted(v Vertex, cached bool) {
+	s.send(&BuildEvent{Type: "vertex.completed", Digest: v.Digest(), Name: v.Name(), Cached: cached})
+}
+
+func (s *GRPCStreamSink) OnVertexFailed(v Vertex, err error) {
+	s.send(&BuildEvent{Type: "vertex.failed", Digest: v.Digest(), Name: v.Name(), Error: err.Error()})
+}
+
+func (s *GRPCStreamSink) OnBuildComplete(results []CachedResult, err error) {
+	ev := &BuildEvent{Type: "build.complete"}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	s.send(ev)
+}
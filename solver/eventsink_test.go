@@ -0,0 +1,157 @@
+package solver
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mu        sync.Mutex
+	queued    []string
+	started   []string
+	completed map[string]bool // vertex name -> cached
+	failed    []string
+	builds    int
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{completed: map[string]bool{}}
+}
+
+func (s *recordingSink) OnVertexQueued(v Vertex) {
+	s.mu.Lock()
+	s.queued = append(s.queued, v.Name())
+	s.mu.Unlock()
+}
+
+func (s *recordingSink) OnVertexStarted(v Vertex) {
+	s.mu.Lock()
+	s.started = append(s.started, v.Name())
+	s.mu.Unlock()
+}
+
+func (s *recordingSink) OnVertexCompleted(v Vertex, cached bool) {
+	s.mu.Lock()
+	s.completed[v.Name()] = cached
+	s.mu.Unlock()
+}
+
+func (s *recordingSink) OnVertexFailed(v Vertex, err error) {
+	s.mu.Lock()
+	s.failed = append(s.failed, v.Name())
+	s.mu.Unlock()
+}
+
+func (s *recordingSink) OnBuildComplete(results []CachedResult, err error) {
+	s.mu.Lock()
+	s.builds++
+	s.mu.Unlock()
+}
+
+func TestBuildEventSink(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	sink := newRecordingSink()
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+		EventSink:     sink,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	res, err := j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v0", cacheKeySeed: "seed0", value: "result0"}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+	require.NoError(t, j0.Discard())
+
+	sink.mu.Lock()
+	require.Equal(t, []string{"v0"}, sink.queued, "queued fires once per vertex")
+	require.Equal(t, []string{"v0"}, sink.started)
+	cached, ok := sink.completed["v0"]
+	require.True(t, ok)
+	require.False(t, cached, "executed result is not reported as cached")
+	require.Equal(t, 1, sink.builds)
+	sink.mu.Unlock()
+
+	// a second build of the same cache key completes from cache
+	j1, err := s.NewJob("job1")
+	require.NoError(t, err)
+	defer j1.Discard()
+	res, err = j1.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v1", cacheKeySeed: "seed0", value: "result1"}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	sink.mu.Lock()
+	cached, ok = sink.completed["v1"]
+	require.True(t, ok)
+	require.True(t, cached, "cache hit is reported as cached")
+	require.Empty(t, sink.failed)
+	sink.mu.Unlock()
+}
+
+func TestMultiSink(t *testing.T) {
+	t.Parallel()
+
+	a, b := newRecordingSink(), newRecordingSink()
+	m := MultiSink(a, b)
+
+	v := vtx(vtxOpt{name: "v0"})
+	m.OnVertexQueued(v)
+	m.OnVertexStarted(v)
+	m.OnVertexCompleted(v, true)
+	m.OnVertexFailed(v, context.Canceled)
+	m.OnBuildComplete(nil, nil)
+
+	for _, s := range []*recordingSink{a, b} {
+		require.Equal(t, []string{"v0"}, s.queued)
+		require.Equal(t, []string{"v0"}, s.started)
+		require.True(t, s.completed["v0"])
+		require.Equal(t, []string{"v0"}, s.failed)
+		require.Equal(t, 1, s.builds)
+	}
+}
+
+type recordingStream struct {
+	msgs []interface{}
+}
+
+func (s *recordingStream) SendMsg(m interface{}) error {
+	s.msgs = append(s.msgs, m)
+	return nil
+}
+
+func TestGRPCStreamSink(t *testing.T) {
+	t.Parallel()
+
+	stream := &recordingStream{}
+	sink := &GRPCStreamSink{Stream: stream}
+
+	v := vtx(vtxOpt{name: "v0"})
+	sink.OnVertexQueued(v)
+	sink.OnVertexCompleted(v, true)
+	sink.OnBuildComplete(nil, context.Canceled)
+
+	require.Len(t, stream.msgs, 3)
+
+	ev := stream.msgs[0].(*BuildEvent)
+	require.Equal(t, "vertex.queued", ev.Type)
+	require.Equal(t, v.Digest(), ev.Digest)
+	require.Equal(t, "v0", ev.Name)
+
+	ev = stream.msgs[1].(*BuildEvent)
+	require.Equal(t, "vertex.completed", ev.Type)
+	require.True(t, ev.Cached)
+
+	ev = stream.msgs[2].(*BuildEvent)
+	require.Equal(t, "build.complete", ev.Type)
+	require.Equal(t, context.Canceled.Error(), ev.Error)
+}
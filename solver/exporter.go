@@ -97,6 +97,10 @@ func (e *exporter) ExportTo(ctx context.Context, t CacheExporterTarget, opt Cach
 		addRecord = *e.override
 	}
 
+	if opt.ExportFilter != nil && e.edge != nil && !opt.ExportFilter(e.edge.edge.Vertex) {
+		addRecord = false
+	}
+
 	exportRecord := opt.ExportRoots
 	if len(deps) > 0 {
 		exportRecord = true
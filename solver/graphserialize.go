@@ -0,0 +1,119 @@
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// graphIDBaggageKey is the baggage member carrying the graph correlation ID
+// (the content-addressed root vertex digest of the build request) on spans
+// created while solving, so distributed traces spanning multiple builds can
+// be correlated.
+const graphIDBaggageKey = "buildkit.graph.id"
+
+// BuildGraph is a serializable snapshot of the active build graph. The wire
+// schema is defined in solver/pb/graph.proto; until generated bindings land
+// the canonical encoding is the equivalent JSON form.
+type BuildGraph struct {
+	ID       string        `json:"ID"`
+	Vertexes []GraphVertex `json:"vertexes"`
+}
+
+// GraphVertex describes a single vertex and its dependency edges
+type GraphVertex struct {
+	Digest    digest.Digest `json:"digest"`
+	Name      string        `json:"name"`
+	Inputs    []GraphInput  `json:"inputs,omitempty"`
+	CacheKeys []string      `json:"cache_keys,omitempty"`
+}
+
+// GraphInput is a dependency edge to another vertex output
+type GraphInput struct {
+	Digest digest.Digest `json:"digest"`
+	Index  Index         `json:"index"`
+}
+
+// SerializeGraph snapshots the currently active build graph. The graph ID is
+// content-addressed over the serialized vertexes, so identical graphs map to
+// the same ID across daemon restarts.
+func (jl *Solver) SerializeGraph() (*BuildGraph, error) {
+	type activeState struct {
+		dgst digest.Digest
+		st   *state
+	}
+	jl.mu.RLock()
+	states := make([]activeState, 0, len(jl.actives))
+	for dgst, st := range jl.actives {
+		states = append(states, activeState{dgst: dgst, st: st})
+	}
+	jl.mu.RUnlock()
+
+	g := &BuildGraph{}
+	for _, as := range states {
+		v := GraphVertex{
+			Digest: as.dgst,
+			Name:   as.st.vtx.Name(),
+		}
+		for _, in := range as.st.vtx.Inputs() {
+			v.Inputs = append(v.Inputs, GraphInput{Digest: in.Vertex.Digest(), Index: in.Index})
+		}
+		// edge cache keys are owned by the scheduler loop; snapshot them
+		// under the dispatch mutex like the loop itself does
+		jl.s.mu.Lock()
+		as.st.mu.Lock()
+		for _, e := range as.st.edges {
+			for _, k := range e.keys {
+				if k.CacheKey != nil {
+					v.CacheKeys = append(v.CacheKeys, k.ID)
+				}
+			}
+		}
+		as.st.mu.Unlock()
+		jl.s.mu.Unlock()
+		g.Vertexes = append(g.Vertexes, v)
+	}
+	sort.Slice(g.Vertexes, func(i, j int) bool {
+		return g.Vertexes[i].Digest < g.Vertexes[j].Digest
+	})
+
+	dt, err := json.Marshal(g.Vertexes)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	g.ID = digest.FromBytes(dt).String()
+	return g, nil
+}
+
+// Marshal encodes the graph for transport
+func (g *BuildGraph) Marshal() ([]byte, error) {
+	dt, err := json.Marshal(g)
+	return dt, errors.WithStack(err)
+}
+
+// DeserializeGraph decodes a graph produced by Marshal
+func DeserializeGraph(dt []byte) (*BuildGraph, error) {
+	var g BuildGraph
+	if err := json.Unmarshal(dt, &g); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &g, nil
+}
+
+// withGraphIDBaggage attaches the graph ID as an OpenTelemetry baggage
+// member so all spans created below ctx carry it.
+func withGraphIDBaggage(ctx context.Context, graphID string) context.Context {
+	member, err := baggage.NewMember(graphIDBaggageKey, graphID)
+	if err != nil {
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/moby/buildkit/client"
@@ -20,6 +21,7 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/semaphore"
 )
 
 // ResolveOpFunc finds an Op implementation for a Vertex
@@ -44,6 +46,19 @@ type Solver struct {
 	updateCond *sync.Cond
 	s          *scheduler
 	index      *edgeIndex
+
+	// resultHistory records executed results for cache hit verification,
+	// only maintained when a ResultComparator is configured
+	resultHistory *resultHistory
+
+	// queuedVtx collects vertexes newly added to the graph while the solver
+	// lock is held; load drains it to notify the event sink
+	queuedVtx []Vertex
+
+	// prevCacheKeys remembers the last committed cache key per vertex when
+	// BUILDKIT_CACHE_DIFF=1 is set, so cache misses can be diffed against
+	// the previous result
+	prevCacheKeys *sync.Map
 }
 
 type state struct {
@@ -154,6 +169,11 @@ func (s *state) getEdge(index Index) *edge {
 	}
 
 	e := newEdge(Edge{Index: index, Vertex: s.vtx}, s.op, s.index)
+	e.cacheReporter = s.opts.CacheReporter
+	e.resultComparator = s.opts.ResultComparator
+	e.resultHistory = s.solver.resultHistory
+	e.prevCacheKeys = s.solver.prevCacheKeys
+	e.resultStore = s.opts.ResultStore
 	s.edges[index] = e
 	return e
 }
@@ -171,6 +191,11 @@ func (s *state) setEdge(index Index, targetEdge *edge, targetState *state) {
 		}
 	} else {
 		e = newEdge(Edge{Index: index, Vertex: s.vtx}, s.op, s.index)
+		e.cacheReporter = s.opts.CacheReporter
+		e.resultComparator = s.opts.ResultComparator
+		e.resultHistory = s.solver.resultHistory
+		e.prevCacheKeys = s.solver.prevCacheKeys
+		e.resultStore = s.opts.ResultStore
 		s.edges[index] = e
 	}
 	targetEdge.takeOwnership(e)
@@ -312,6 +337,28 @@ type Job struct {
 type SolverOpt struct {
 	ResolveOpFunc ResolveOpFunc
 	DefaultCache  CacheManager
+	// CacheReporter, if set, is notified of every cache hit/miss decision
+	// made by the edge state machine.
+	CacheReporter CacheReporter
+	// ResultComparator, if set, verifies semantic equivalence of a freshly
+	// loaded cache result against the edge's previous result before the
+	// cached result replaces it.
+	ResultComparator ResultComparator
+	// Middleware wraps the cache map and exec phases of every resolved op,
+	// outermost first.
+	Middleware []SolverMiddleware
+	// EventSink, if set, receives vertex and build lifecycle notifications.
+	EventSink BuildEventSink
+	// ResultSizeLimit fails the build when an op produces a snapshot larger
+	// than the given number of bytes. Zero means no limit.
+	ResultSizeLimit int64
+	// ResultStore, if set, additionally persists every executed edge result
+	// so it can be listed, reloaded and deleted independently of the cache.
+	ResultStore ResultStore
+	// SchedulerWALPath enables a write-ahead log of queued edges at the
+	// given path. Entries recovered after a crash are exposed through
+	// RecoveredWALEntries.
+	SchedulerWALPath string
 }
 
 func NewSolver(opts SolverOpt) *Solver {
@@ -324,11 +371,85 @@ func NewSolver(opts SolverOpt) *Solver {
 		opts:    opts,
 		index:   newEdgeIndex(),
 	}
-	jl.s = newScheduler(jl)
+	if opts.ResultComparator != nil {
+		jl.resultHistory = newResultHistory()
+	}
+	if debugCacheDiff {
+		jl.prevCacheKeys = &sync.Map{}
+	}
+	// priority dispatch is always enabled so that the
+	// BUILDKIT_SCHEDULER_PRIORITY vertex label takes effect
+	schedulerOpts := []schedulerOpt{WithPriorityFunc(DefaultPriorityFunc)}
+	if sink := opts.EventSink; sink != nil {
+		schedulerOpts = append(schedulerOpts, withEventSink(sink))
+	}
+	if opts.SchedulerWALPath != "" {
+		schedulerOpts = append(schedulerOpts, WithWAL(opts.SchedulerWALPath))
+	}
+	jl.s = newScheduler(jl, schedulerOpts...)
 	jl.updateCond = sync.NewCond(jl.mu.RLocker())
 	return jl
 }
 
+// BuildRequest describes a single target edge for BuildMulti.
+type BuildRequest struct {
+	// Edge is the target to evaluate.
+	Edge Edge
+	// SessionID optionally associates the build with a client session.
+	SessionID string
+}
+
+// BuildResult carries the outcome of one BuildRequest.
+type BuildResult struct {
+	Result CachedResultWithProvenance
+	Err    error
+}
+
+// BuildMulti evaluates multiple independent targets concurrently under the
+// shared scheduler. Vertexes that appear in more than one request are
+// deduplicated through the shared graph state the same way concurrent jobs
+// are. The returned slice has one entry per request; individual failures are
+// recorded in BuildResult.Err and do not cancel the remaining requests.
+func (jl *Solver) BuildMulti(ctx context.Context, reqs []BuildRequest) ([]BuildResult, error) {
+	results := make([]BuildResult, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		i, req := i, req
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j, err := jl.NewJob(identity.NewID())
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			j.SessionID = req.SessionID
+			defer j.Discard()
+			res, err := j.Build(ctx, req.Edge)
+			results[i] = BuildResult{Result: res, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// RecoveredWALEntries returns the edges that were still queued when a
+// previous process using the same scheduler WAL path died. The scheduler
+// does not replay them by itself: the vertexes behind the digests no longer
+// exist in the fresh process, so the caller is expected to ask clients to
+// resubmit the corresponding builds (matching them by vertex digest) and the
+// WAL entry is considered handled once a new build for that digest runs.
+func (jl *Solver) RecoveredWALEntries() []WALEntry {
+	return jl.s.RecoveredWALEntries()
+}
+
+// FlushPending waits for the scheduler to drain its dispatch queue. It can be
+// called before Close during graceful shutdown to let in-flight builds settle
+// instead of abandoning them.
+func (jl *Solver) FlushPending(ctx context.Context) error {
+	return jl.s.FlushPending(ctx)
+}
+
 // hasOwner returns true if the provided target edge (or any of it's sibling
 // edges) has the provided owner.
 func (jl *Solver) hasOwner(target Edge, owner Edge) bool {
@@ -440,11 +561,23 @@ func (jl *Solver) Close() {
 
 func (jl *Solver) load(ctx context.Context, v, parent Vertex, j *Job) (Vertex, error) {
 	jl.mu.Lock()
-	defer jl.mu.Unlock()
 
 	cache := map[Vertex]Vertex{}
 
-	return jl.loadUnlocked(ctx, v, parent, j, cache)
+	res, err := jl.loadUnlocked(ctx, v, parent, j, cache)
+
+	// notify the event sink outside the solver lock so sink implementations
+	// can call back into the solver without deadlocking
+	queued := jl.queuedVtx
+	jl.queuedVtx = nil
+	jl.mu.Unlock()
+
+	if sink := jl.opts.EventSink; sink != nil {
+		for _, qv := range queued {
+			sink.OnVertexQueued(qv)
+		}
+	}
+	return res, err
 }
 
 // called with solver lock
@@ -513,6 +646,9 @@ func (jl *Solver) loadUnlocked(ctx context.Context, v, parent Vertex, j *Job, ca
 			origDigest:   origVtx.Digest(),
 		}
 		jl.actives[dgst] = st
+		if jl.opts.EventSink != nil {
+			jl.queuedVtx = append(jl.queuedVtx, v)
+		}
 
 		if debugScheduler {
 			lg := bklog.G(ctx).
@@ -702,7 +838,19 @@ func (j *Job) Build(ctx context.Context, e Edge) (CachedResultWithProvenance, er
 	}
 	e.Vertex = v
 
+	// the root vertex digest is content-addressed over the whole request
+	// graph, so it serves as a cheap stable trace correlation id without
+	// serializing the full active graph on every build
+	ctx = withGraphIDBaggage(ctx, e.Vertex.Digest().String())
+
 	res, err := j.list.s.build(ctx, e)
+	if sink := j.list.opts.EventSink; sink != nil {
+		var results []CachedResult
+		if res != nil {
+			results = []CachedResult{res}
+		}
+		sink.OnBuildComplete(results, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -869,9 +1017,11 @@ type sharedOp struct {
 	cacheDone bool
 	cacheErr  error
 
-	slowMu       sync.Mutex
-	slowCacheRes map[Index]digest.Digest
-	slowCacheErr map[Index]error
+	slowMu            sync.Mutex
+	slowCacheRes      map[Index]digest.Digest
+	slowCacheErr      map[Index]error
+	slowCacheSem      *semaphore.Weighted
+	slowCacheInflight int64
 }
 
 func (s *sharedOp) IgnoreCache() bool {
@@ -907,6 +1057,36 @@ func (s *sharedOp) LoadCache(ctx context.Context, rec *CacheRecord) (Result, err
 	return res, err
 }
 
+// defaultMaxParallelCacheCompute bounds concurrent slow cache key
+// computations per vertex unless overridden by the vertex options. The
+// computations were already issued concurrently through per-dependency
+// function requests; the semaphore only limits that existing concurrency
+// within one vertex, it does not serialize work across vertexes.
+const defaultMaxParallelCacheCompute = 8
+
+// parallelCacheComputeCount counts slow-cache computations that actually ran
+// concurrently with another computation for the same vertex.
+var parallelCacheComputeCount int64
+
+// ParallelCacheComputeCount returns how many slow-cache computations ran in
+// parallel with at least one other computation since process start.
+func ParallelCacheComputeCount() int64 {
+	return atomic.LoadInt64(&parallelCacheComputeCount)
+}
+
+func (s *sharedOp) slowCacheSemaphore() *semaphore.Weighted {
+	s.slowMu.Lock()
+	defer s.slowMu.Unlock()
+	if s.slowCacheSem == nil {
+		n := s.st.vtx.Options().MaxParallelCacheCompute
+		if n <= 0 {
+			n = defaultMaxParallelCacheCompute
+		}
+		s.slowCacheSem = semaphore.NewWeighted(int64(n))
+	}
+	return s.slowCacheSem
+}
+
 // CalcSlowCache computes the digest of an input that is ready and has been
 // evaluated, hence "slow" cache.
 func (s *sharedOp) CalcSlowCache(ctx context.Context, index Index, p PreprocessFunc, f ResultBasedCacheFunc, res Result) (dgst digest.Digest, err error) {
@@ -915,6 +1095,15 @@ func (s *sharedOp) CalcSlowCache(ctx context.Context, index Index, p PreprocessF
 		err = errdefs.WithOp(err, s.st.vtx.Sys())
 		err = errdefs.WrapVertex(err, s.st.origDigest)
 	}()
+	if err := s.slowCacheSemaphore().Acquire(ctx, 1); err != nil {
+		return "", err
+	}
+	defer s.slowCacheSem.Release(1)
+	if atomic.AddInt64(&s.slowCacheInflight, 1) > 1 {
+		atomic.AddInt64(&parallelCacheComputeCount, 1)
+	}
+	defer atomic.AddInt64(&s.slowCacheInflight, -1)
+
 	flightControlKey := fmt.Sprintf("slow-compute-%d", index)
 	key, err := s.gDigest.Do(ctx, flightControlKey, func(ctx context.Context) (digest.Digest, error) {
 		s.slowMu.Lock()
@@ -1018,6 +1207,12 @@ func (s *sharedOp) CacheMap(ctx context.Context, index int) (resp *cacheMapResp,
 				notifyCompleted(retErr, false)
 			}()
 		}
+		if d := s.st.vtx.Options().OperationTimeout; d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeoutCause(ctx, d, errors.WithStack(context.DeadlineExceeded))
+			defer cancel()
+		}
+
 		res, done, err := op.CacheMap(ctx, s.st, len(s.cacheRes))
 		complete := true
 		if err != nil {
@@ -1092,12 +1287,40 @@ func (s *sharedOp) Exec(ctx context.Context, inputs []Result) (outputs []Result,
 		// no cache hit. start evaluating the node
 		span, ctx := tracing.StartSpan(ctx, s.st.vtx.Name(), trace.WithAttributes(attribute.String("vertex", s.st.vtx.Digest().String())))
 		notifyCompleted := notifyStarted(ctx, &s.st.clientVertex, false)
+		if sink := s.st.opts.EventSink; sink != nil {
+			sink.OnVertexStarted(s.st.vtx)
+		}
 		defer func() {
 			tracing.FinishWithError(span, retErr)
 			notifyCompleted(retErr, false)
 		}()
 
+		if d := s.st.vtx.Options().OperationTimeout; d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeoutCause(ctx, d, errors.WithStack(context.DeadlineExceeded))
+			defer cancel()
+		}
+
 		res, err := op.Exec(ctx, s.st, inputs)
+		if err == nil {
+			if limit := s.st.opts.ResultSizeLimit; limit > 0 {
+				for _, r := range res {
+					sz, ok, szErr := resultSize(ctx, r)
+					if szErr != nil {
+						bklog.G(ctx).WithError(szErr).Warn("failed to compute result size")
+						continue
+					}
+					if ok && sz > limit {
+						err = errors.WithStack(&ResultTooLargeError{Size: sz, Limit: limit})
+						for _, r := range res {
+							r.Release(context.TODO())
+						}
+						res = nil
+						break
+					}
+				}
+			}
+		}
 		complete := true
 		if err != nil {
 			select {
@@ -1139,6 +1362,9 @@ func (s *sharedOp) getOp() (Op, error) {
 	s.opOnce.Do(func() {
 		s.subBuilder = s.st.builder()
 		s.op, s.err = s.resolver(s.st.vtx, s.subBuilder)
+		if s.err == nil && s.op != nil {
+			s.op = applyMiddleware(s.op, s.st.opts.Middleware)
+		}
 	})
 	if s.err != nil {
 		return nil, s.err
@@ -1252,6 +1478,10 @@ func releaseError(err error) {
 		Release() error
 	}); ok {
 		re.Release()
+	} else if re, ok := err.(interface {
+		Release(context.Context) error
+	}); ok {
+		re.Release(context.TODO())
 	}
 	releaseError(errors.Unwrap(err))
 }
@@ -2,27 +2,220 @@ package errdefs
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
 	"runtime"
+	"strings"
+
+	"time"
 
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ExecError will be returned when an error is encountered when evaluating an op.
 type ExecError struct {
 	error
-	Inputs        []solver.Result
-	Mounts        []solver.Result
+	inputs        []solver.Result
+	mounts        []solver.Result
 	OwnerBorrowed bool
+	// Platform is the platform the op was executing on, e.g. "linux/arm64".
+	// It is empty if the executor did not report one.
+	Platform string
+	// Annotations holds arbitrary metadata attached to the error, e.g. a
+	// build or commit identifier added by higher-level tooling.
+	Annotations map[string]string
+	// Recoverable is true when the error is likely fixable by the user
+	// (e.g. a bad command) as opposed to an infrastructure problem like an
+	// OOM kill. It defaults to true.
+	Recoverable bool
+	// Suggestion is a human-readable hint on how to fix the failure, e.g.
+	// generated by the executor for well-known failure conditions.
+	Suggestion string
+	// RemoteInputs and RemoteMounts hold the content digests of the op's
+	// inputs and mounts when the error was reconstructed from a gRPC status
+	// and the local result references are unavailable.
+	RemoteInputs []digest.Digest
+	RemoteMounts []digest.Digest
+	// SpanContext is the tracing span that was active when the error was
+	// recorded, set via WithContext.
+	SpanContext trace.SpanContext
+
+	logger *logrus.Entry
+}
+
+// WithContext records the tracing span context and logger from ctx on the
+// error so that observability tooling can correlate it with the build trace
+// later. The stored logger is notified when the error is marshaled.
+func (e *ExecError) WithContext(ctx context.Context) *ExecError {
+	e.SpanContext = trace.SpanContextFromContext(ctx)
+	e.logger = bklog.G(ctx)
+	return e
+}
+
+// WithSuggestion attaches a human-readable hint on how to fix the failure
+func (e *ExecError) WithSuggestion(msg string) *ExecError {
+	e.Suggestion = msg
+	return e
+}
+
+// WithRecoverable marks whether the error is fixable by the user. Errors
+// marked non-recoverable are surfaced with an "infrastructure error" prefix.
+func (e *ExecError) WithRecoverable(v bool) *ExecError {
+	e.Recoverable = v
+	return e
+}
+
+// IsRecoverable reports the recoverability classification without requiring
+// access to the concrete type, e.g. for the solver's retry middleware.
+func (e *ExecError) IsRecoverable() bool {
+	return e.Recoverable
+}
+
+// WithAnnotation attaches a key-value metadata pair to the error
+func (e *ExecError) WithAnnotation(key, value string) *ExecError {
+	if e.Annotations == nil {
+		e.Annotations = map[string]string{}
+	}
+	e.Annotations[key] = value
+	return e
+}
+
+func (e *ExecError) Error() string {
+	msg := e.error.Error()
+	if e.Platform != "" {
+		msg = fmt.Sprintf("exec failed (%s): %s", e.Platform, msg)
+	}
+	if !e.Recoverable {
+		msg = "infrastructure error: " + msg
+	}
+	if e.Suggestion != "" {
+		msg += "\nsuggestion: " + e.Suggestion
+	}
+	return msg
 }
 
 func (e *ExecError) Unwrap() error {
 	return e.error
 }
 
+func (e *ExecError) MarshalJSON() ([]byte, error) {
+	var traceID, spanID string
+	if e.SpanContext.IsValid() {
+		traceID = e.SpanContext.TraceID().String()
+		spanID = e.SpanContext.SpanID().String()
+	}
+	dt, err := json.Marshal(struct {
+		Error       string            `json:"error"`
+		Platform    string            `json:"platform,omitempty"`
+		Suggestion  string            `json:"suggestion,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+		Recoverable bool              `json:"recoverable"`
+		TraceID     string            `json:"traceID,omitempty"`
+		SpanID      string            `json:"spanID,omitempty"`
+	}{
+		Error:       e.Error(),
+		Platform:    e.Platform,
+		Suggestion:  e.Suggestion,
+		Annotations: e.Annotations,
+		Recoverable: e.Recoverable,
+		TraceID:     traceID,
+		SpanID:      spanID,
+	})
+	if err == nil && e.logger != nil {
+		e.logger.WithField("execError", string(dt)).Debug("exec error reported")
+	}
+	return dt, err
+}
+
+var exitCodeRegexp = regexp.MustCompile(`exit code: (\d+)`)
+
+// Summarize returns a concise single-line description of the error for
+// space-constrained progress output: the platform when known, the exit code
+// if one appears in the error chain and the innermost non-ExecError message.
+// The result is truncated to 120 characters.
+func (e *ExecError) Summarize() string {
+	innermost := error(e.error)
+	for {
+		u, ok := innermost.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		next := u.Unwrap()
+		if next == nil {
+			break
+		}
+		innermost = next
+	}
+
+	var parts []string
+	if e.Platform != "" {
+		parts = append(parts, "["+e.Platform+"]")
+	}
+	if m := exitCodeRegexp.FindStringSubmatch(e.error.Error()); m != nil {
+		parts = append(parts, "exit code "+m[1]+":")
+	}
+	parts = append(parts, innermost.Error())
+
+	s := strings.Join(parts, " ")
+	if len(s) > 120 {
+		s = s[:117] + "..."
+	}
+	return s
+}
+
+// Chain walks the error chain and returns every ExecError encountered,
+// starting with the receiver. Ops that fail because a prerequisite op failed
+// can produce several nested exec errors.
+func (e *ExecError) Chain() []*ExecError {
+	chain := []*ExecError{e}
+	err := e.Unwrap()
+	for err != nil {
+		if ee, ok := err.(*ExecError); ok {
+			chain = append(chain, ee)
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return chain
+}
+
+// Inputs returns a copy of the op's input results. Mutating the returned
+// slice does not affect the error state.
+func (e *ExecError) Inputs() []solver.Result {
+	out := make([]solver.Result, len(e.inputs))
+	copy(out, e.inputs)
+	return out
+}
+
+// Mounts returns a copy of the op's mount results. Mutating the returned
+// slice does not affect the error state.
+func (e *ExecError) Mounts() []solver.Result {
+	out := make([]solver.Result, len(e.mounts))
+	copy(out, e.mounts)
+	return out
+}
+
+// InputCount returns the number of input results without copying
+func (e *ExecError) InputCount() int {
+	return len(e.inputs)
+}
+
+// MountCount returns the number of mount results without copying
+func (e *ExecError) MountCount() int {
+	return len(e.mounts)
+}
+
 func (e *ExecError) EachRef(fn func(solver.Result) error) (err error) {
 	m := map[solver.Result]struct{}{}
-	for _, res := range e.Inputs {
+	for _, res := range e.inputs {
 		if res == nil {
 			continue
 		}
@@ -34,7 +227,7 @@ func (e *ExecError) EachRef(fn func(solver.Result) error) (err error) {
 			err = err1
 		}
 	}
-	for _, res := range e.Mounts {
+	for _, res := range e.mounts {
 		if res == nil {
 			continue
 		}
@@ -49,30 +242,107 @@ func (e *ExecError) EachRef(fn func(solver.Result) error) (err error) {
 	return err
 }
 
-func (e *ExecError) Release() error {
+// contentKeyer is implemented by results (or their Sys values) that can
+// report a content-addressable digest of their data.
+type contentKeyer interface {
+	ContentKey() digest.Digest
+}
+
+// InputDigests returns the content-addressable digests of the op's inputs
+// and mounts without requiring the caller to manage reference lifetimes.
+// Results that can't report a content key are skipped. Deduplication matches
+// EachRef: every distinct result is visited once.
+func (e *ExecError) InputDigests(ctx context.Context) ([]digest.Digest, error) {
+	if len(e.inputs) == 0 && len(e.mounts) == 0 && (len(e.RemoteInputs) > 0 || len(e.RemoteMounts) > 0) {
+		// error reconstructed from a gRPC status: only the digests survived
+		out := append([]digest.Digest(nil), e.RemoteInputs...)
+		return append(out, e.RemoteMounts...), nil
+	}
+	var dgsts []digest.Digest
+	err := e.EachRef(func(r solver.Result) error {
+		if ck, ok := r.(contentKeyer); ok {
+			dgsts = append(dgsts, ck.ContentKey())
+			return nil
+		}
+		if ck, ok := r.Sys().(contentKeyer); ok {
+			dgsts = append(dgsts, ck.ContentKey())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dgsts, nil
+}
+
+// Release releases the result references held by the error. The context
+// bounds how long releasing may take, e.g. when a snapshotter stalls.
+func (e *ExecError) Release(ctx context.Context) error {
 	if e.OwnerBorrowed {
 		return nil
 	}
 	err := e.EachRef(func(r solver.Result) error {
-		r.Release(context.TODO())
-		return nil
+		return r.Release(ctx)
 	})
 	e.OwnerBorrowed = true
 	return err
 }
 
-func WithExecError(err error, inputs, mounts []solver.Result) error {
-	return WithExecErrorWithContext(context.TODO(), err, inputs, mounts)
+// ReleaseWithTimeout releases the result references held by the error,
+// giving up after the provided duration.
+func (e *ExecError) ReleaseWithTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return e.Release(ctx)
 }
 
-func WithExecErrorWithContext(ctx context.Context, err error, inputs, mounts []solver.Result) error {
+// ExecErrorOption attaches optional metadata to an ExecError on creation
+type ExecErrorOption func(*ExecError)
+
+// WithExecErrorPlatform records the platform the failed op was running on
+func WithExecErrorPlatform(platform string) ExecErrorOption {
+	return func(e *ExecError) {
+		e.Platform = platform
+	}
+}
+
+func WithExecError(err error, inputs, mounts []solver.Result, opts ...ExecErrorOption) error {
+	return WithExecErrorWithContext(context.TODO(), err, inputs, mounts, opts...)
+}
+
+func WithExecErrorWithContext(ctx context.Context, err error, inputs, mounts []solver.Result, opts ...ExecErrorOption) error {
 	if err == nil {
 		return nil
 	}
+	// wrap the refs in SafeResult guards, reusing one wrapper per distinct
+	// underlying result so that deduplicated refs are still released once
+	safe := map[solver.Result]*solver.SafeResult{}
+	wrap := func(results []solver.Result) []solver.Result {
+		if results == nil {
+			return nil
+		}
+		out := make([]solver.Result, len(results))
+		for i, r := range results {
+			if r == nil {
+				continue
+			}
+			sr, ok := safe[r]
+			if !ok {
+				sr = solver.NewSafeResult(r)
+				safe[r] = sr
+			}
+			out[i] = sr
+		}
+		return out
+	}
 	ee := &ExecError{
-		error:  err,
-		Inputs: inputs,
-		Mounts: mounts,
+		error:       err,
+		inputs:      wrap(inputs),
+		mounts:      wrap(mounts),
+		Recoverable: true,
+	}
+	for _, opt := range opts {
+		opt(ee)
 	}
 	runtime.SetFinalizer(ee, func(e *ExecError) {
 		if !e.OwnerBorrowed {
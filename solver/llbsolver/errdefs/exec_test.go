@@ -0,0 +1,252 @@
+package errdefs
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/containerd/typeurl/v2"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/grpcerrors"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExecErrorPlatform(t *testing.T) {
+	baseErr := errors.New("process did not complete successfully")
+	err := WithExecError(baseErr, nil, nil, WithExecErrorPlatform("linux/arm64"))
+	err = errors.Wrap(err, "wrapped")
+
+	var ee *ExecError
+	require.True(t, errors.As(err, &ee))
+	require.Equal(t, "linux/arm64", ee.Platform)
+	require.Contains(t, ee.Error(), "exec failed (linux/arm64)")
+
+	dt, jsonErr := ee.MarshalJSON()
+	require.NoError(t, jsonErr)
+	require.Contains(t, string(dt), `"platform":"linux/arm64"`)
+}
+
+func TestExecErrorAnnotations(t *testing.T) {
+	err := WithExecError(errors.New("failed"), nil, nil)
+
+	var ee *ExecError
+	require.True(t, errors.As(err, &ee))
+	ee.WithAnnotation("build_id", "b123").WithAnnotation("repo", "example/repo")
+	require.Equal(t, "b123", ee.Annotations["build_id"])
+
+	dt, jsonErr := ee.MarshalJSON()
+	require.NoError(t, jsonErr)
+	require.Contains(t, string(dt), `"build_id":"b123"`)
+	require.Contains(t, string(dt), `"repo":"example/repo"`)
+}
+
+func TestExecErrorRecoverable(t *testing.T) {
+	err := WithExecError(errors.New("oom killed"), nil, nil)
+
+	var ee *ExecError
+	require.True(t, errors.As(err, &ee))
+	require.True(t, ee.Recoverable)
+
+	ee.WithRecoverable(false)
+	require.False(t, ee.Recoverable)
+	require.Contains(t, ee.Error(), "infrastructure error: oom killed")
+
+	// still recoverable through wrapping
+	wrapped := errors.Wrap(err, "wrapped")
+	var ee2 *ExecError
+	require.True(t, errors.As(wrapped, &ee2))
+	require.False(t, ee2.Recoverable)
+}
+
+func TestExecErrorChain(t *testing.T) {
+	inner := WithExecError(errors.New("inner"), nil, nil)
+	middle := WithExecError(errors.Wrap(inner, "middle"), nil, nil)
+	outer := WithExecError(errors.Wrap(middle, "outer"), nil, nil)
+
+	var ee *ExecError
+	require.True(t, errors.As(outer, &ee))
+
+	chain := ee.Chain()
+	require.Len(t, chain, 3)
+	require.Contains(t, chain[0].Error(), "outer")
+	require.Contains(t, chain[1].Error(), "middle")
+	require.Equal(t, "inner", chain[2].Error())
+}
+
+func TestExecErrorReadOnlyRefs(t *testing.T) {
+	inputs := []solver.Result{&stubResult{id: "input0"}}
+	mounts := []solver.Result{&stubResult{id: "mount0"}}
+	err := WithExecError(errors.New("failed"), inputs, mounts)
+
+	var ee *ExecError
+	require.True(t, errors.As(err, &ee))
+	require.Equal(t, 1, ee.InputCount())
+	require.Equal(t, 1, ee.MountCount())
+
+	// mutating the returned slices doesn't corrupt the error state
+	got := ee.Inputs()
+	got[0] = nil
+	require.NotNil(t, ee.Inputs()[0])
+	require.Equal(t, "input0", ee.Inputs()[0].ID())
+
+	gotMounts := ee.Mounts()
+	gotMounts[0] = nil
+	require.NotNil(t, ee.Mounts()[0])
+
+	require.NoError(t, ee.Release(context.TODO()))
+}
+
+type stubResult struct {
+	id string
+}
+
+func (r *stubResult) ContentKey() digest.Digest { return digest.FromString(r.id) }
+
+// blockingResult blocks in Release until the context is cancelled
+type blockingResult struct {
+	stubResult
+}
+
+func (r *blockingResult) Release(ctx context.Context) error {
+	<-ctx.Done()
+	return context.Cause(ctx)
+}
+
+func (r *stubResult) ID() string                    { return r.id }
+func (r *stubResult) Release(context.Context) error { return nil }
+func (r *stubResult) Sys() interface{}              { return r }
+func (r *stubResult) Clone() solver.Result          { return r }
+
+func TestNewExecErrorFromGRPCStatus(t *testing.T) {
+	det := &ExecErrorDetail{
+		Platform:    "linux/arm64",
+		Annotations: map[string]string{"build_id": "b123"},
+		Recoverable: true,
+	}
+	st := status.New(codes.Unknown, "process did not complete successfully")
+
+	// attach the detail the same way grpcerrors.ToGRPC serializes typed errors
+	dt, err2 := json.Marshal(det)
+	require.NoError(t, err2)
+	url, err2 := typeurl.TypeURL(det)
+	require.NoError(t, err2)
+	p := st.Proto()
+	p.Details = append(p.Details, &anypb.Any{TypeUrl: url, Value: dt})
+	st = status.FromProto(p)
+
+	ee, ok := NewExecErrorFromGRPCStatus(st)
+	require.True(t, ok)
+	require.Equal(t, "linux/arm64", ee.Platform)
+	require.Equal(t, "b123", ee.Annotations["build_id"])
+	require.True(t, ee.Recoverable)
+	require.NoError(t, ee.Release(context.TODO()))
+
+	// a status without details carries no exec error
+	_, ok = NewExecErrorFromGRPCStatus(status.New(codes.Unknown, "other"))
+	require.False(t, ok)
+}
+
+func TestExecErrorSummarize(t *testing.T) {
+	err := errors.New("exit code: 127")
+	for i := 0; i < 10; i++ {
+		err = errors.Wrapf(err, "a fairly long wrapping message to blow up the error text, level %d", i)
+	}
+	ee, _ := WithExecError(err, nil, nil, WithExecErrorPlatform("linux/amd64")).(*ExecError)
+
+	sum := ee.Summarize()
+	require.LessOrEqual(t, len(sum), 120)
+	require.Contains(t, sum, "[linux/amd64]")
+	require.Contains(t, sum, "exit code 127")
+}
+
+func TestExecErrorSuggestion(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		baseErr    string
+		suggestion string
+	}{
+		{"command not found", "sh: foo: not found", "check that the command is installed in the image"},
+		{"permission denied", "open /etc/shadow: permission denied", "run the command as a user with sufficient permissions"},
+		{"oom killed", "process was killed (oom)", "increase the memory available to the build"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := WithExecError(errors.New(tc.baseErr), nil, nil)
+
+			var ee *ExecError
+			require.True(t, errors.As(err, &ee))
+			ee.WithSuggestion(tc.suggestion)
+
+			require.Contains(t, ee.Error(), "suggestion: "+tc.suggestion)
+
+			dt, jsonErr := ee.MarshalJSON()
+			require.NoError(t, jsonErr)
+			require.Contains(t, string(dt), tc.suggestion)
+		})
+	}
+}
+
+func TestExecErrorGRPCRoundTrip(t *testing.T) {
+	inputs := []solver.Result{&stubResult{id: "input0"}}
+	mounts := []solver.Result{&stubResult{id: "mount0"}}
+	err := WithExecError(errors.New("process did not complete successfully"), inputs, mounts, WithExecErrorPlatform("linux/arm64"))
+
+	var ee *ExecError
+	require.True(t, errors.As(err, &ee))
+	ee.WithAnnotation("build_id", "b123")
+
+	grpcErr := grpcerrors.ToGRPC(context.TODO(), err)
+	require.NoError(t, ee.Release(context.TODO()))
+	back := grpcerrors.FromGRPC(grpcErr)
+
+	var ee2 *ExecError
+	require.True(t, errors.As(back, &ee2))
+	require.Equal(t, ee.Platform, ee2.Platform)
+	require.Equal(t, ee.Annotations, ee2.Annotations)
+	require.Equal(t, ee.Recoverable, ee2.Recoverable)
+	require.Contains(t, back.Error(), "process did not complete successfully")
+
+	// the content digests of the refs survive the round trip even though
+	// the result references themselves can't cross the wire
+	require.Equal(t, []digest.Digest{digest.FromString("input0")}, ee2.RemoteInputs)
+	require.Equal(t, []digest.Digest{digest.FromString("mount0")}, ee2.RemoteMounts)
+	dgsts, dErr := ee2.InputDigests(context.TODO())
+	require.NoError(t, dErr)
+	require.Contains(t, dgsts, digest.FromString("input0"))
+	require.Contains(t, dgsts, digest.FromString("mount0"))
+}
+
+func TestExecErrorInputDigests(t *testing.T) {
+	shared := &stubResult{id: "shared"}
+	inputs := []solver.Result{shared, &stubResult{id: "input1"}}
+	mounts := []solver.Result{shared}
+	err := WithExecError(errors.New("failed"), inputs, mounts)
+
+	var ee *ExecError
+	require.True(t, errors.As(err, &ee))
+
+	dgsts, dErr := ee.InputDigests(context.TODO())
+	require.NoError(t, dErr)
+	// the shared result is deduplicated
+	require.Len(t, dgsts, 2)
+	require.Contains(t, dgsts, digest.FromString("shared"))
+	require.Contains(t, dgsts, digest.FromString("input1"))
+
+	require.NoError(t, ee.Release(context.TODO()))
+}
+
+func TestExecErrorReleaseTimeout(t *testing.T) {
+	err := WithExecError(errors.New("failed"), []solver.Result{&blockingResult{stubResult{id: "blocked"}}}, nil)
+
+	var ee *ExecError
+	require.True(t, errors.As(err, &ee))
+
+	start := time.Now()
+	require.Error(t, ee.ReleaseWithTimeout(50*time.Millisecond))
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,123 @@
+package errdefs
+
+import (
+	"fmt"
+
+	"github.com/containerd/typeurl/v2"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/grpcerrors"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	typeurl.Register((*ExecErrorDetail)(nil), "github.com/moby/buildkit", "errdefs.ExecErrorDetail+json")
+}
+
+// ExecErrorDetail is the wire representation of ExecError metadata carried in
+// gRPC status details. Result references can not cross the wire, so the
+// content-addressable digests of the inputs and mounts are preserved
+// instead.
+type ExecErrorDetail struct {
+	InputDigests []string          `json:"inputDigests,omitempty"`
+	MountDigests []string          `json:"mountDigests,omitempty"`
+	Platform     string            `json:"platform,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Recoverable  bool              `json:"recoverable"`
+}
+
+func (d *ExecErrorDetail) Reset()         { *d = ExecErrorDetail{} }
+func (d *ExecErrorDetail) String() string { return fmt.Sprintf("%+v", *d) }
+func (*ExecErrorDetail) ProtoMessage()    {}
+
+// WrapError reattaches the detail to an error received over gRPC. The
+// reconstructed ExecError has no local result references, so it is marked
+// OwnerBorrowed and Release is a no-op; the content digests of the remote
+// refs stay available through RemoteInputs/RemoteMounts and InputDigests.
+func (d *ExecErrorDetail) WrapError(err error) error {
+	return &ExecError{
+		error:         err,
+		OwnerBorrowed: true,
+		Platform:      d.Platform,
+		Annotations:   d.Annotations,
+		Recoverable:   d.Recoverable,
+		RemoteInputs:  parseDigests(d.InputDigests),
+		RemoteMounts:  parseDigests(d.MountDigests),
+	}
+}
+
+func parseDigests(strs []string) []digest.Digest {
+	out := make([]digest.Digest, 0, len(strs))
+	for _, s := range strs {
+		dgst, err := digest.Parse(s)
+		if err != nil {
+			continue
+		}
+		out = append(out, dgst)
+	}
+	return out
+}
+
+// contentKey returns the content digest of a result when it can report one
+func contentKey(r solver.Result) (digest.Digest, bool) {
+	if ck, ok := r.(contentKeyer); ok {
+		return ck.ContentKey(), true
+	}
+	if ck, ok := r.Sys().(contentKeyer); ok {
+		return ck.ContentKey(), true
+	}
+	return "", false
+}
+
+// ToProto makes ExecError implement grpcerrors.TypedError so that its
+// metadata is attached to the gRPC status as an ExecErrorDetail and can be
+// reconstructed on the client side. Results that can't report a content
+// digest are skipped.
+func (e *ExecError) ToProto() grpcerrors.TypedErrorProto {
+	det := &ExecErrorDetail{
+		Platform:    e.Platform,
+		Annotations: e.Annotations,
+		Recoverable: e.Recoverable,
+	}
+	for _, r := range e.inputs {
+		if r == nil {
+			continue
+		}
+		if dgst, ok := contentKey(r); ok {
+			det.InputDigests = append(det.InputDigests, dgst.String())
+		}
+	}
+	for _, r := range e.mounts {
+		if r == nil {
+			continue
+		}
+		if dgst, ok := contentKey(r); ok {
+			det.MountDigests = append(det.MountDigests, dgst.String())
+		}
+	}
+	return det
+}
+
+// NewExecErrorFromGRPCStatus reconstructs an ExecError from the
+// ExecErrorDetail embedded in the status details. It returns false when the
+// status carries no exec error detail.
+func NewExecErrorFromGRPCStatus(s *status.Status) (*ExecError, bool) {
+	if s == nil {
+		return nil, false
+	}
+	for _, d := range s.Proto().Details {
+		m, err := typeurl.UnmarshalAny(d)
+		if err != nil {
+			continue
+		}
+		if det, ok := m.(*ExecErrorDetail); ok {
+			ee, ok := det.WrapError(errors.New(s.Message())).(*ExecError)
+			if !ok {
+				continue
+			}
+			return ee, true
+		}
+	}
+	return nil, false
+}
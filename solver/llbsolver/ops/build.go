@@ -57,6 +57,8 @@ func (b *BuildOp) CacheMap(ctx context.Context, g session.Group, index int) (*so
 			Selector          digest.Digest
 			ComputeDigestFunc solver.ResultBasedCacheFunc
 			PreprocessFunc    solver.PreprocessFunc
+
+			ComputeDigestPredicateFunc solver.ConditionalSlowCacheFunc
 		}, len(b.v.Inputs())),
 	}, true, nil
 }
@@ -60,6 +60,8 @@ func (d *diffOp) CacheMap(ctx context.Context, group session.Group, index int) (
 			Selector          digest.Digest
 			ComputeDigestFunc solver.ResultBasedCacheFunc
 			PreprocessFunc    solver.PreprocessFunc
+
+			ComputeDigestPredicateFunc solver.ConditionalSlowCacheFunc
 		}, depCount),
 	}
 
@@ -196,6 +196,8 @@ func (e *ExecOp) CacheMap(ctx context.Context, g session.Group, index int) (*sol
 			Selector          digest.Digest
 			ComputeDigestFunc solver.ResultBasedCacheFunc
 			PreprocessFunc    solver.PreprocessFunc
+
+			ComputeDigestPredicateFunc solver.ConditionalSlowCacheFunc
 		}, e.numInputs),
 	}
 
@@ -401,7 +403,15 @@ func (e *ExecOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 					execMounts[active.MountIndex] = worker.NewWorkerRefResult(ref, e.w)
 				}
 			}
-			err = errdefs.WithExecError(err, execInputs, execMounts)
+			var execErrOpts []errdefs.ExecErrorOption
+			if e.platform != nil {
+				execErrOpts = append(execErrOpts, errdefs.WithExecErrorPlatform(platforms.Format(ocispecs.Platform{
+					OS:           e.platform.OS,
+					Architecture: e.platform.Architecture,
+					Variant:      e.platform.Variant,
+				})))
+			}
+			err = errdefs.WithExecError(err, execInputs, execMounts, execErrOpts...)
 		} else {
 			// Only release actives if err is nil.
 			for i := len(p.Actives) - 1; i >= 0; i-- { // call in LIFO order
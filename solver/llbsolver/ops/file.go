@@ -132,6 +132,8 @@ func (f *fileOp) CacheMap(ctx context.Context, g session.Group, index int) (*sol
 			Selector          digest.Digest
 			ComputeDigestFunc solver.ResultBasedCacheFunc
 			PreprocessFunc    solver.PreprocessFunc
+
+			ComputeDigestPredicateFunc solver.ConditionalSlowCacheFunc
 		}, f.numInputs),
 	}
 
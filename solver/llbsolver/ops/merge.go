@@ -52,6 +52,8 @@ func (m *mergeOp) CacheMap(ctx context.Context, group session.Group, index int)
 			Selector          digest.Digest
 			ComputeDigestFunc solver.ResultBasedCacheFunc
 			PreprocessFunc    solver.PreprocessFunc
+
+			ComputeDigestPredicateFunc solver.ConditionalSlowCacheFunc
 		}, len(m.op.Inputs)),
 	}
 
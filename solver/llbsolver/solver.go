@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
@@ -90,6 +91,19 @@ type Solver struct {
 	entitlements              []string
 	history                   *HistoryQueue
 	sysSampler                *resources.Sampler[*resourcestypes.SysSample]
+	timings                   *TimingRecorder
+}
+
+// GraphDOTHandler serves the active build graph in Graphviz DOT format
+func (s *Solver) GraphDOTHandler() http.Handler {
+	return s.solver.DOTHandler()
+}
+
+// Timings returns the wall-clock execution data recorded for every executed
+// vertex since the solver started. Until VertexTiming messages are added to
+// SolveResponse this is the API surface for build performance tooling.
+func (s *Solver) Timings() []TimingInfo {
+	return s.timings.Timings()
 }
 
 // Processor defines a processing function to be applied after solving, but
@@ -115,14 +129,27 @@ func New(opt Opt) (*Solver, error) {
 	}
 	s.sysSampler = sampler
 
+	s.timings = NewTimingRecorder()
 	s.solver = solver.NewSolver(solver.SolverOpt{
-		ResolveOpFunc: s.resolver(),
+		ResolveOpFunc: RecordTimings(s.timings, s.resolver()),
 		DefaultCache:  opt.CacheManager,
 	})
 	return s, nil
 }
 
+// flushTimeout bounds how long Close waits for in-flight builds to settle
+// before the scheduler is stopped
+const flushTimeout = 10 * time.Second
+
 func (s *Solver) Close() error {
+	// let queued work drain so in-flight builds finish instead of being
+	// abandoned mid-dispatch on graceful shutdown
+	ctx, cancel := context.WithTimeoutCause(context.Background(), flushTimeout, errors.WithStack(context.DeadlineExceeded))
+	if err := s.solver.FlushPending(ctx); err != nil {
+		bklog.G(ctx).WithError(err).Warn("failed to flush pending builds before shutdown")
+	}
+	cancel()
+
 	s.solver.Close()
 	if s.sysSampler != nil {
 		return s.sysSampler.Close()
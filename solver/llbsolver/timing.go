@@ -0,0 +1,84 @@
+package llbsolver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// TimingInfo records wall-clock execution data for a single vertex.
+type TimingInfo struct {
+	Vertex      digest.Digest `json:"vertex"`
+	Name        string        `json:"name,omitempty"`
+	StartedAt   time.Time     `json:"startedAt"`
+	CompletedAt time.Time     `json:"completedAt"`
+	// Error holds the exec failure message; failed execs are recorded too
+	Error string `json:"error,omitempty"`
+}
+
+// Duration returns how long the vertex op executed
+func (ti TimingInfo) Duration() time.Duration {
+	return ti.CompletedAt.Sub(ti.StartedAt)
+}
+
+// TimingRecorder collects per-vertex timing information for build
+// performance analysis.
+type TimingRecorder struct {
+	mu      sync.Mutex
+	timings []TimingInfo
+}
+
+func NewTimingRecorder() *TimingRecorder {
+	return &TimingRecorder{}
+}
+
+func (r *TimingRecorder) record(ti TimingInfo) {
+	r.mu.Lock()
+	r.timings = append(r.timings, ti)
+	r.mu.Unlock()
+}
+
+// Timings returns the recorded entries in completion order
+func (r *TimingRecorder) Timings() []TimingInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TimingInfo(nil), r.timings...)
+}
+
+// RecordTimings wraps an op resolver so that every resolved op records the
+// wall-clock duration of its exec phase into the recorder.
+func RecordTimings(r *TimingRecorder, next solver.ResolveOpFunc) solver.ResolveOpFunc {
+	return func(v solver.Vertex, b solver.Builder) (solver.Op, error) {
+		op, err := next(v, b)
+		if err != nil || op == nil {
+			return op, err
+		}
+		return &timedOp{Op: op, vtx: v, rec: r}, nil
+	}
+}
+
+type timedOp struct {
+	solver.Op
+	vtx solver.Vertex
+	rec *TimingRecorder
+}
+
+func (t *timedOp) Exec(ctx context.Context, g session.Group, inputs []solver.Result) ([]solver.Result, error) {
+	started := time.Now()
+	outputs, err := t.Op.Exec(ctx, g, inputs)
+	ti := TimingInfo{
+		Vertex:      t.vtx.Digest(),
+		Name:        t.vtx.Name(),
+		StartedAt:   started,
+		CompletedAt: time.Now(),
+	}
+	if err != nil {
+		ti.Error = err.Error()
+	}
+	t.rec.record(ti)
+	return outputs, err
+}
@@ -0,0 +1,85 @@
+package llbsolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type stubTimedOp struct {
+	delay time.Duration
+}
+
+func (o *stubTimedOp) CacheMap(context.Context, session.Group, int) (*solver.CacheMap, bool, error) {
+	return &solver.CacheMap{}, true, nil
+}
+
+func (o *stubTimedOp) Exec(context.Context, session.Group, []solver.Result) ([]solver.Result, error) {
+	time.Sleep(o.delay)
+	return nil, nil
+}
+
+func (o *stubTimedOp) Acquire(context.Context) (solver.ReleaseFunc, error) {
+	return func() {}, nil
+}
+
+type stubTimedVertex struct {
+	solver.Vertex
+	name string
+}
+
+func (v stubTimedVertex) Digest() digest.Digest { return digest.FromString(v.name) }
+func (v stubTimedVertex) Name() string          { return v.name }
+
+func TestRecordTimings(t *testing.T) {
+	rec := NewTimingRecorder()
+	resolve := RecordTimings(rec, func(v solver.Vertex, b solver.Builder) (solver.Op, error) {
+		return &stubTimedOp{delay: 5 * time.Millisecond}, nil
+	})
+
+	op, err := resolve(stubTimedVertex{name: "v0"}, nil)
+	require.NoError(t, err)
+
+	_, err = op.Exec(context.TODO(), nil, nil)
+	require.NoError(t, err)
+
+	timings := rec.Timings()
+	require.Len(t, timings, 1)
+	require.Equal(t, "v0", timings[0].Name)
+	require.Equal(t, digest.FromString("v0"), timings[0].Vertex)
+	require.GreaterOrEqual(t, timings[0].Duration(), 5*time.Millisecond)
+	require.False(t, timings[0].StartedAt.IsZero())
+	require.Empty(t, timings[0].Error)
+}
+
+type failingTimedOp struct {
+	stubTimedOp
+}
+
+func (o *failingTimedOp) Exec(context.Context, session.Group, []solver.Result) ([]solver.Result, error) {
+	return nil, errors.New("exec failed")
+}
+
+func TestRecordTimingsFailure(t *testing.T) {
+	rec := NewTimingRecorder()
+	resolve := RecordTimings(rec, func(v solver.Vertex, b solver.Builder) (solver.Op, error) {
+		return &failingTimedOp{}, nil
+	})
+
+	op, err := resolve(stubTimedVertex{name: "v0"}, nil)
+	require.NoError(t, err)
+
+	_, err = op.Exec(context.TODO(), nil, nil)
+	require.Error(t, err)
+
+	// failed execs are recorded with their error instead of being dropped
+	timings := rec.Timings()
+	require.Len(t, timings, 1)
+	require.Equal(t, "exec failed", timings[0].Error)
+}
@@ -69,6 +69,25 @@ func WithCacheSources(cms []solver.CacheManager) LoadOpt {
 	}
 }
 
+// WithDeterministicCacheKey strips fields that vary between machines or
+// invocations (the configured hostname, proxy environment and local session
+// identifiers) from ops before cache keys are computed, so that the same
+// definition produces the same cache key everywhere.
+func WithDeterministicCacheKey() LoadOpt {
+	return func(op *pb.Op, _ *pb.OpMetadata, opt *solver.VertexOptions) error {
+		opt.DeterministicCacheKey = true
+		if exec := op.GetExec(); exec != nil && exec.Meta != nil {
+			exec.Meta.Hostname = ""
+			exec.Meta.ProxyEnv = nil
+		}
+		if src := op.GetSource(); src != nil {
+			delete(src.Attrs, pb.AttrLocalSessionID)
+			delete(src.Attrs, pb.AttrSharedKeyHint)
+		}
+		return nil
+	}
+}
+
 func NormalizeRuntimePlatforms() LoadOpt {
 	var defaultPlatform *pb.Platform
 	return func(op *pb.Op, _ *pb.OpMetadata, opt *solver.VertexOptions) error {
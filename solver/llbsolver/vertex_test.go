@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/solver/pb"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
@@ -53,3 +54,31 @@ func TestRecomputeDigests(t *testing.T) {
 	require.Equal(t, newDigest, op2.Inputs[0].Digest)
 	assert.NotEqual(t, op2Digest, updated)
 }
+
+func TestWithDeterministicCacheKey(t *testing.T) {
+	newOp := func(hostname string) *pb.Op {
+		return &pb.Op{
+			Op: &pb.Op_Exec{
+				Exec: &pb.ExecOp{
+					Meta: &pb.Meta{
+						Args:     []string{"/bin/sh", "-c", "true"},
+						Hostname: hostname,
+						ProxyEnv: &pb.ProxyEnv{HttpProxy: "http://proxy:3128"},
+					},
+				},
+			},
+		}
+	}
+
+	op1, op2 := newOp("machine-a"), newOp("machine-b")
+	var opt1, opt2 solver.VertexOptions
+	require.NoError(t, WithDeterministicCacheKey()(op1, nil, &opt1))
+	require.NoError(t, WithDeterministicCacheKey()(op2, nil, &opt2))
+	require.True(t, opt1.DeterministicCacheKey)
+
+	dt1, err := op1.Marshal()
+	require.NoError(t, err)
+	dt2, err := op2.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes(dt1), digest.FromBytes(dt2))
+}
@@ -0,0 +1,45 @@
+package solver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// schedulerMetrics holds the instrumentation for a scheduler instance
+type schedulerMetrics struct {
+	queueDepth      prometheus.Gauge
+	dispatchLatency prometheus.Histogram
+}
+
+// WithSchedulerMetrics registers a gauge for the current dispatch queue depth
+// and a histogram for the latency between an edge being signalled and being
+// dispatched. Callers without their own registry can pass
+// prometheus.DefaultRegisterer; re-registering reuses the existing
+// collectors so multiple scheduler instances can share one registry.
+func WithSchedulerMetrics(r prometheus.Registerer) schedulerOpt {
+	return func(s *scheduler) {
+		s.metrics = &schedulerMetrics{
+			queueDepth: registerOrReuse(r, prometheus.NewGauge(prometheus.GaugeOpts{
+				Name: "buildkit_scheduler_queue_depth",
+				Help: "Number of edges currently queued for dispatch.",
+			})),
+			dispatchLatency: registerOrReuse(r, prometheus.NewHistogram(prometheus.HistogramOpts{
+				Name:    "buildkit_scheduler_dispatch_latency_seconds",
+				Help:    "Time between an edge being signalled and dispatched.",
+				Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+			})),
+		}
+	}
+}
+
+// registerOrReuse registers c with r, returning the already registered
+// collector when one with the same descriptor exists.
+func registerOrReuse[C prometheus.Collector](r prometheus.Registerer, c C) C {
+	if err := r.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+	}
+	return c
+}
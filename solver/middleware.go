@@ -0,0 +1,158 @@
+package solver
+
+import (
+	"context"
+	"time"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/tracing"
+	"github.com/pkg/errors"
+)
+
+// CacheMapFunc mirrors Op.CacheMap for middleware wrapping
+type CacheMapFunc func(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error)
+
+// ExecFunc mirrors Op.Exec for middleware wrapping
+type ExecFunc func(ctx context.Context, g session.Group, inputs []Result) ([]Result, error)
+
+// SolverMiddleware wraps the cache map and exec phases of every op, in the
+// style of HTTP middleware chains. Middlewares are applied in order: the
+// first middleware passed to SolverOpt.Middleware is the outermost wrapper.
+type SolverMiddleware interface {
+	WrapCacheMap(next CacheMapFunc) CacheMapFunc
+	WrapExec(next ExecFunc) ExecFunc
+}
+
+// applyMiddleware wraps op with the given middleware chain
+func applyMiddleware(op Op, mws []SolverMiddleware) Op {
+	if len(mws) == 0 {
+		return op
+	}
+	cm := op.CacheMap
+	exec := op.Exec
+	for i := len(mws) - 1; i >= 0; i-- {
+		cm = mws[i].WrapCacheMap(cm)
+		exec = mws[i].WrapExec(exec)
+	}
+	return &middlewareOp{Op: op, cacheMap: cm, exec: exec}
+}
+
+type middlewareOp struct {
+	Op
+	cacheMap CacheMapFunc
+	exec     ExecFunc
+}
+
+func (m *middlewareOp) CacheMap(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
+	return m.cacheMap(ctx, g, index)
+}
+
+func (m *middlewareOp) Exec(ctx context.Context, g session.Group, inputs []Result) ([]Result, error) {
+	return m.exec(ctx, g, inputs)
+}
+
+// LoggingMiddleware logs the duration and outcome of every op phase
+type LoggingMiddleware struct{}
+
+func (LoggingMiddleware) WrapCacheMap(next CacheMapFunc) CacheMapFunc {
+	return func(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
+		start := time.Now()
+		cm, done, err := next(ctx, g, index)
+		bklog.G(ctx).
+			WithField("duration", time.Since(start)).
+			WithError(err).
+			Debug("op cache map")
+		return cm, done, err
+	}
+}
+
+func (LoggingMiddleware) WrapExec(next ExecFunc) ExecFunc {
+	return func(ctx context.Context, g session.Group, inputs []Result) ([]Result, error) {
+		start := time.Now()
+		outputs, err := next(ctx, g, inputs)
+		bklog.G(ctx).
+			WithField("duration", time.Since(start)).
+			WithError(err).
+			Debug("op exec")
+		return outputs, err
+	}
+}
+
+// TracingMiddleware creates a tracing span around every op phase
+type TracingMiddleware struct{}
+
+func (TracingMiddleware) WrapCacheMap(next CacheMapFunc) CacheMapFunc {
+	return func(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
+		span, ctx := tracing.StartSpan(ctx, "op cache map")
+		cm, done, err := next(ctx, g, index)
+		tracing.FinishWithError(span, err)
+		return cm, done, err
+	}
+}
+
+func (TracingMiddleware) WrapExec(next ExecFunc) ExecFunc {
+	return func(ctx context.Context, g session.Group, inputs []Result) ([]Result, error) {
+		span, ctx := tracing.StartSpan(ctx, "op exec")
+		outputs, err := next(ctx, g, inputs)
+		tracing.FinishWithError(span, err)
+		return outputs, err
+	}
+}
+
+// recoverableError is implemented by errors (like llbsolver's ExecError)
+// that classify whether retrying can help
+type recoverableError interface {
+	IsRecoverable() bool
+}
+
+// retryableError reports whether an error may be retried: cancellations and
+// errors explicitly classified as non-recoverable are not.
+func retryableError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var re recoverableError
+	if errors.As(err, &re) && !re.IsRecoverable() {
+		return false
+	}
+	return true
+}
+
+// RetryMiddleware re-runs failed op phases up to MaxRetries times. Canceled
+// contexts and errors classified as non-recoverable are not retried. Ops are
+// expected to be idempotent: a retried Exec starts from the same inputs, so
+// any partial side effects of the failed attempt must not leak into the
+// retry.
+type RetryMiddleware struct {
+	MaxRetries int
+}
+
+func (m RetryMiddleware) WrapCacheMap(next CacheMapFunc) CacheMapFunc {
+	return func(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
+		var cm *CacheMap
+		var done bool
+		var err error
+		for i := 0; i <= m.MaxRetries; i++ {
+			cm, done, err = next(ctx, g, index)
+			if !retryableError(ctx, err) {
+				break
+			}
+		}
+		return cm, done, err
+	}
+}
+
+func (m RetryMiddleware) WrapExec(next ExecFunc) ExecFunc {
+	return func(ctx context.Context, g session.Group, inputs []Result) ([]Result, error) {
+		var outputs []Result
+		var err error
+		for i := 0; i <= m.MaxRetries; i++ {
+			outputs, err = next(ctx, g, inputs)
+			if !retryableError(ctx, err) {
+				break
+			}
+		}
+		return outputs, err
+	}
+}
@@ -0,0 +1,106 @@
+package solver
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/moby/buildkit/session"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type countingMiddleware struct {
+	name  string
+	order *[]string
+}
+
+func (m countingMiddleware) WrapCacheMap(next CacheMapFunc) CacheMapFunc {
+	return func(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
+		*m.order = append(*m.order, m.name+".cachemap")
+		return next(ctx, g, index)
+	}
+}
+
+func (m countingMiddleware) WrapExec(next ExecFunc) ExecFunc {
+	return func(ctx context.Context, g session.Group, inputs []Result) ([]Result, error) {
+		*m.order = append(*m.order, m.name+".exec")
+		return next(ctx, g, inputs)
+	}
+}
+
+type nonRecoverableError struct{ error }
+
+func (nonRecoverableError) IsRecoverable() bool { return false }
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	var order []string
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+		Middleware: []SolverMiddleware{
+			countingMiddleware{name: "outer", order: &order},
+			countingMiddleware{name: "inner", order: &order},
+		},
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	defer j0.Discard()
+
+	res, err := j0.Build(ctx, Edge{Vertex: vtx(vtxOpt{name: "v0", value: "result0"})})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	// the first configured middleware is the outermost wrapper
+	require.Equal(t, []string{"outer.cachemap", "inner.cachemap", "outer.exec", "inner.exec"}, order)
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	var attempts int64
+	flaky := func(context.Context, session.Group, []Result) ([]Result, error) {
+		if atomic.AddInt64(&attempts, 1) < 3 {
+			return nil, errors.New("transient failure")
+		}
+		return nil, nil
+	}
+
+	// transient failures are retried up to the limit
+	_, err := RetryMiddleware{MaxRetries: 3}.WrapExec(flaky)(ctx, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), atomic.LoadInt64(&attempts))
+
+	// the retry budget is bounded
+	atomic.StoreInt64(&attempts, 0)
+	alwaysFails := func(context.Context, session.Group, []Result) ([]Result, error) {
+		atomic.AddInt64(&attempts, 1)
+		return nil, errors.New("persistent failure")
+	}
+	_, err = RetryMiddleware{MaxRetries: 2}.WrapExec(alwaysFails)(ctx, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, int64(3), atomic.LoadInt64(&attempts))
+
+	// non-recoverable errors are not retried at all
+	atomic.StoreInt64(&attempts, 0)
+	infra := func(context.Context, session.Group, []Result) ([]Result, error) {
+		atomic.AddInt64(&attempts, 1)
+		return nil, errors.Wrap(nonRecoverableError{errors.New("oom killed")}, "exec failed")
+	}
+	_, err = RetryMiddleware{MaxRetries: 5}.WrapExec(infra)(ctx, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, int64(1), atomic.LoadInt64(&attempts))
+
+	// cancelled contexts stop the retry loop
+	atomic.StoreInt64(&attempts, 0)
+	cctx, cancel := context.WithCancelCause(ctx)
+	cancel(errors.WithStack(context.Canceled))
+	_, err = RetryMiddleware{MaxRetries: 5}.WrapExec(alwaysFails)(cctx, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, int64(1), atomic.LoadInt64(&attempts))
+}
@@ -0,0 +1,135 @@
+package solver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// ErrOverlappingGraphs is returned by MultiScheduler.Build when the vertexes
+// of a request are already split across multiple child schedulers, so no
+// single child could safely process the graph. This failure mode is the
+// price of keeping every edge on exactly one dispatch loop: a graph spanning
+// two owners would need its shared edges mutated from two loops at once,
+// which the edge state machine does not support. Callers can avoid it by
+// submitting overlapping builds through the same MultiScheduler in
+// dependency order (owners are assigned transitively on first contact).
+var ErrOverlappingGraphs = errors.New("build graph overlaps vertexes owned by multiple schedulers")
+
+// MultiScheduler spreads independent builds over several child schedulers
+// using ownership-based routing, a deliberate re-scope of the originally
+// proposed work-stealing mode: moving a queued edge between dispatch loops
+// (an edgeFactory.StealEdge operation) would require transferring its open
+// pipes and loop-owned state between schedulers mid-flight, which the edge
+// state machine cannot do safely. Instead, edges are never shared between
+// children: every vertex is owned by exactly one child, a build whose graph
+// touches owned vertexes is routed to the owning child, and graphs with no
+// owner yet go to the least busy child at submission time. This balances
+// load across children for wide sets of independent builds while keeping
+// all dispatch for a given edge on a single scheduler loop; requests whose
+// vertexes are already split across children are rejected with
+// ErrOverlappingGraphs.
+type MultiScheduler struct {
+	children []*scheduler
+	inflight []int64
+
+	mu     sync.Mutex
+	owners map[digest.Digest]int
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewMultiScheduler creates n child schedulers over the solver's shared
+// graph. Vertexes must be loaded into a job before being built, same as with
+// the solver's own scheduler.
+func NewMultiScheduler(jl *Solver, n int, opts ...schedulerOpt) *MultiScheduler {
+	if n < 1 {
+		n = 1
+	}
+	m := &MultiScheduler{
+		inflight: make([]int64, n),
+		owners:   map[digest.Digest]int{},
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < n; i++ {
+		m.children = append(m.children, newScheduler(jl, opts...))
+	}
+	return m
+}
+
+// collectDigests walks the graph below v and records every vertex digest
+func collectDigests(v Vertex, out map[digest.Digest]struct{}) {
+	if _, ok := out[v.Digest()]; ok {
+		return
+	}
+	out[v.Digest()] = struct{}{}
+	for _, in := range v.Inputs() {
+		collectDigests(in.Vertex, out)
+	}
+}
+
+// route picks the child scheduler for the graph rooted at e and records
+// vertex ownership. Ownership lasts for the lifetime of the MultiScheduler,
+// mirroring how vertexes stay in the solver's shared graph state.
+func (m *MultiScheduler) route(e Edge) (int, error) {
+	dgsts := map[digest.Digest]struct{}{}
+	collectDigests(e.Vertex, dgsts)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	owner := -1
+	for d := range dgsts {
+		c, ok := m.owners[d]
+		if !ok {
+			continue
+		}
+		if owner >= 0 && owner != c {
+			return 0, errors.WithStack(ErrOverlappingGraphs)
+		}
+		owner = c
+	}
+	if owner < 0 {
+		// fresh graph: pick the child with the fewest in-flight builds
+		owner = 0
+		for i := range m.inflight {
+			if atomic.LoadInt64(&m.inflight[i]) < atomic.LoadInt64(&m.inflight[owner]) {
+				owner = i
+			}
+		}
+	}
+	for d := range dgsts {
+		m.owners[d] = owner
+	}
+	return owner, nil
+}
+
+// Build evaluates the edge on the child scheduler that owns its graph
+func (m *MultiScheduler) Build(ctx context.Context, e Edge) (CachedResult, error) {
+	select {
+	case <-m.done:
+		return nil, errors.New("multi scheduler is stopped")
+	default:
+	}
+	idx, err := m.route(e)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&m.inflight[idx], 1)
+	defer atomic.AddInt64(&m.inflight[idx], -1)
+	return m.children[idx].build(ctx, e)
+}
+
+// Stop stops all child schedulers
+func (m *MultiScheduler) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+		for _, s := range m.children {
+			s.Stop()
+		}
+	})
+}
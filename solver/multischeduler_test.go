@@ -0,0 +1,174 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestMultiSchedulerBuild(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	ms := NewMultiScheduler(s, 3)
+	defer ms.Stop()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	for i := 0; i < 6; i++ {
+		i := i
+		eg.Go(func() error {
+			v, err := s.load(egCtx, vtx(vtxOpt{
+				name:  fmt.Sprintf("v%d", i),
+				value: fmt.Sprintf("result%d", i),
+			}), nil, j0)
+			if err != nil {
+				return err
+			}
+			res, err := ms.Build(egCtx, Edge{Vertex: v})
+			if err != nil {
+				return err
+			}
+			require.Equal(t, fmt.Sprintf("result%d", i), unwrap(res))
+			return nil
+		})
+	}
+	require.NoError(t, eg.Wait())
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestMultiSchedulerOverlappingGraphs(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	ms := NewMultiScheduler(s, 3)
+	defer ms.Stop()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	shared := vtx(vtxOpt{name: "shared", value: "result-shared"})
+
+	// two graphs sharing a vertex are routed to the same child scheduler
+	v0, err := s.load(ctx, vtx(vtxOpt{
+		name:   "v0",
+		value:  "result0",
+		inputs: []Edge{{Vertex: shared}},
+	}), nil, j0)
+	require.NoError(t, err)
+	res, err := ms.Build(ctx, Edge{Vertex: v0})
+	require.NoError(t, err)
+	require.Equal(t, "result0", unwrap(res))
+
+	owner0 := ms.owners[v0.Digest()]
+	require.Equal(t, owner0, ms.owners[shared.Digest()])
+
+	v1, err := s.load(ctx, vtx(vtxOpt{
+		name:   "v1",
+		value:  "result1",
+		inputs: []Edge{{Vertex: shared}},
+	}), nil, j0)
+	require.NoError(t, err)
+	res, err = ms.Build(ctx, Edge{Vertex: v1})
+	require.NoError(t, err)
+	require.Equal(t, "result1", unwrap(res))
+	require.Equal(t, owner0, ms.owners[v1.Digest()])
+
+	// a graph whose vertexes are split across children is rejected
+	other := (owner0 + 1) % len(ms.children)
+	v2 := vtx(vtxOpt{name: "v2", value: "result2"})
+	ms.mu.Lock()
+	ms.owners[v2.Digest()] = other
+	ms.mu.Unlock()
+	loaded, err := s.load(ctx, vtx(vtxOpt{
+		name:   "v3",
+		value:  "result3",
+		inputs: []Edge{{Vertex: shared}, {Vertex: v2}},
+	}), nil, j0)
+	require.NoError(t, err)
+	_, err = ms.Build(ctx, Edge{Vertex: loaded})
+	require.True(t, errors.Is(err, ErrOverlappingGraphs))
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func benchmarkWideGraphs(b *testing.B, newBuilder func(s *Solver) (func(ctx context.Context, e Edge) (CachedResult, error), func())) {
+	ctx := context.TODO()
+	for i := 0; i < b.N; i++ {
+		s := NewSolver(SolverOpt{
+			ResolveOpFunc: testOpResolver,
+		})
+		build, cleanup := newBuilder(s)
+
+		j0, err := s.NewJob(fmt.Sprintf("job%d", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		eg, egCtx := errgroup.WithContext(ctx)
+		for d := 0; d < 16; d++ {
+			d := d
+			eg.Go(func() error {
+				v, err := s.load(egCtx, vtx(vtxOpt{
+					name:  fmt.Sprintf("b%d-v%d", i, d),
+					value: fmt.Sprintf("result%d", d),
+				}), nil, j0)
+				if err != nil {
+					return err
+				}
+				_, err = build(egCtx, Edge{Vertex: v})
+				return err
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			b.Fatal(err)
+		}
+		j0.Discard()
+		cleanup()
+		s.Close()
+	}
+}
+
+func BenchmarkWideGraphSingleScheduler(b *testing.B) {
+	benchmarkWideGraphs(b, func(s *Solver) (func(ctx context.Context, e Edge) (CachedResult, error), func()) {
+		return s.s.build, func() {}
+	})
+}
+
+func BenchmarkWideGraphMultiScheduler(b *testing.B) {
+	benchmarkWideGraphs(b, func(s *Solver) (func(ctx context.Context, e Edge) (CachedResult, error), func()) {
+		ms := NewMultiScheduler(s, 4)
+		return ms.Build, ms.Stop
+	})
+}
@@ -10,6 +10,37 @@ import (
 	"github.com/pkg/errors"
 )
 
+// ResultTooLargeError is returned when an op produces a result larger than
+// the limit configured with SolverOpt.ResultSizeLimit.
+type ResultTooLargeError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *ResultTooLargeError) Error() string {
+	return errors.Errorf("result size %d bytes exceeds configured limit of %d bytes", e.Size, e.Limit).Error()
+}
+
+// resultSizer is implemented by results (or their Sys values) that can
+// report the storage size of their snapshot.
+type resultSizer interface {
+	Size(context.Context) (int64, error)
+}
+
+// resultSize reports the storage size of res, or false when the result
+// cannot compute one.
+func resultSize(ctx context.Context, res Result) (int64, bool, error) {
+	if s, ok := res.(resultSizer); ok {
+		sz, err := s.Size(ctx)
+		return sz, true, err
+	}
+	if s, ok := res.Sys().(resultSizer); ok {
+		sz, err := s.Size(ctx)
+		return sz, true, err
+	}
+	return 0, false, nil
+}
+
 // SharedResult is a result that can be cloned
 type SharedResult struct {
 	mu   sync.Mutex
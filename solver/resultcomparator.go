@@ -0,0 +1,85 @@
+package solver
+
+import (
+	"sync"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ResultComparator verifies that a result loaded from cache is semantically
+// equivalent to the result that was originally produced for the same id
+// before the cached result is returned. Two results may share content but
+// differ in metadata (file timestamps, uid/gid), which matters for some
+// frontends and not for others. A mismatch makes the edge fall back to
+// executing the op.
+type ResultComparator interface {
+	Equal(a, b CachedResult) (bool, error)
+}
+
+// resultHistory remembers the results produced by op execution so a later
+// cache hit for the same result id can be verified against the original.
+// Entries are held without taking a reference; comparators may only inspect
+// identity-level data of the stored result.
+type resultHistory struct {
+	mu      sync.Mutex
+	results map[string]CachedResult
+}
+
+func newResultHistory() *resultHistory {
+	return &resultHistory{results: map[string]CachedResult{}}
+}
+
+func (h *resultHistory) put(res CachedResult) {
+	h.mu.Lock()
+	h.results[res.ID()] = res
+	h.mu.Unlock()
+}
+
+func (h *resultHistory) get(id string) (CachedResult, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res, ok := h.results[id]
+	return res, ok
+}
+
+// contentDigester is implemented by results that can report a
+// content-addressable digest of their data.
+type contentDigester interface {
+	ContentDigest() digest.Digest
+}
+
+// StrictComparator considers results equal only when their identity and, if
+// available, their content digests match.
+type StrictComparator struct{}
+
+func (StrictComparator) Equal(a, b CachedResult) (bool, error) {
+	if a == nil || b == nil {
+		return a == b, nil
+	}
+	if a.ID() != b.ID() {
+		return false, nil
+	}
+	ca, aok := a.Sys().(contentDigester)
+	cb, bok := b.Sys().(contentDigester)
+	if aok && bok && ca.ContentDigest() != cb.ContentDigest() {
+		return false, nil
+	}
+	return true, nil
+}
+
+// ContentOnlyComparator considers results equal when their content digests
+// match, ignoring identity and metadata. Results that can't report a content
+// digest fall back to identity comparison.
+type ContentOnlyComparator struct{}
+
+func (ContentOnlyComparator) Equal(a, b CachedResult) (bool, error) {
+	if a == nil || b == nil {
+		return a == b, nil
+	}
+	ca, aok := a.Sys().(contentDigester)
+	cb, bok := b.Sys().(contentDigester)
+	if aok && bok {
+		return ca.ContentDigest() == cb.ContentDigest(), nil
+	}
+	return a.ID() == b.ID(), nil
+}
@@ -0,0 +1,95 @@
+package solver
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultComparators(t *testing.T) {
+	a := NewCachedResult(&dummyResult{id: "id0", value: "content"}, nil)
+	b := NewCachedResult(&dummyResult{id: "id0", value: "content"}, nil)
+	c := NewCachedResult(&dummyResult{id: "id1", value: "content"}, nil)
+
+	eq, err := StrictComparator{}.Equal(a, b)
+	require.NoError(t, err)
+	require.True(t, eq)
+
+	eq, err = StrictComparator{}.Equal(a, c)
+	require.NoError(t, err)
+	require.False(t, eq)
+
+	// dummy results have no content digest, so content-only comparison
+	// falls back to identity
+	eq, err = ContentOnlyComparator{}.Equal(a, c)
+	require.NoError(t, err)
+	require.False(t, eq)
+
+	eq, err = ContentOnlyComparator{}.Equal(a, b)
+	require.NoError(t, err)
+	require.True(t, eq)
+}
+
+type countingComparator struct {
+	calls int64
+	equal bool
+}
+
+func (c *countingComparator) Equal(a, b CachedResult) (bool, error) {
+	atomic.AddInt64(&c.calls, 1)
+	return c.equal, nil
+}
+
+func testComparatorOnCacheHit(t *testing.T, equal bool) int64 {
+	ctx := context.TODO()
+
+	cmp := &countingComparator{equal: equal}
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc:    testOpResolver,
+		ResultComparator: cmp,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	res, err := j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v0", cacheKeySeed: "seed0", value: "result0"}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+	require.NoError(t, j0.Discard())
+
+	// the comparator is not consulted for executed results
+	require.Equal(t, int64(0), atomic.LoadInt64(&cmp.calls))
+
+	j1, err := s.NewJob("job1")
+	require.NoError(t, err)
+	defer j1.Discard()
+	res, err = j1.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v1", cacheKeySeed: "seed0", value: "result1"}),
+	})
+	require.NoError(t, err)
+
+	// the cache hit for the previously executed result went through Equal
+	require.GreaterOrEqual(t, atomic.LoadInt64(&cmp.calls), int64(1))
+
+	if equal {
+		require.Equal(t, unwrap(res), "result0")
+	} else {
+		// failed equivalence check falls back to executing the op
+		require.Equal(t, unwrap(res), "result1")
+	}
+	return atomic.LoadInt64(&cmp.calls)
+}
+
+func TestResultComparatorVerifiesCacheHit(t *testing.T) {
+	t.Parallel()
+	testComparatorOnCacheHit(t, true)
+}
+
+func TestResultComparatorRejectsCacheHit(t *testing.T) {
+	t.Parallel()
+	testComparatorOnCacheHit(t, false)
+}
@@ -0,0 +1,144 @@
+package solver
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrResultNotFound is returned by ResultStore.Load for unknown result ids
+var ErrResultNotFound = errors.New("result not found")
+
+// ResultStore is a pluggable persistence backend for build results, allowing
+// result storage to be routed somewhere other than the default containerd
+// snapshotter.
+type ResultStore interface {
+	Save(ctx context.Context, res CachedResult) (string, error)
+	Load(ctx context.Context, id string) (CachedResult, error)
+	List(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryResultStore keeps results in process memory. It is useful for tests
+// and ephemeral workers where persistence across restarts isn't needed.
+type MemoryResultStore struct {
+	mu      sync.Mutex
+	results map[string]CachedResult
+}
+
+func NewMemoryResultStore() *MemoryResultStore {
+	return &MemoryResultStore{results: map[string]CachedResult{}}
+}
+
+func (s *MemoryResultStore) Save(ctx context.Context, res CachedResult) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := res.ID()
+	s.results[id] = res
+	return id, nil
+}
+
+func (s *MemoryResultStore) Load(ctx context.Context, id string) (CachedResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.results[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrResultNotFound, "id %s", id)
+	}
+	return res, nil
+}
+
+func (s *MemoryResultStore) List(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.results))
+	for id := range s.results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *MemoryResultStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.results[id]
+	if !ok {
+		return errors.Wrapf(ErrResultNotFound, "id %s", id)
+	}
+	delete(s.results, id)
+	return res.Release(ctx)
+}
+
+// SnapshotterResultStore routes result persistence through the existing
+// cache result storage, i.e. the containerd snapshotter in the default
+// worker setup.
+type SnapshotterResultStore struct {
+	mu      sync.Mutex
+	storage CacheResultStorage
+	saved   map[string]CacheResult
+}
+
+func NewSnapshotterResultStore(storage CacheResultStorage) *SnapshotterResultStore {
+	return &SnapshotterResultStore{storage: storage, saved: map[string]CacheResult{}}
+}
+
+func (s *SnapshotterResultStore) Save(ctx context.Context, res CachedResult) (string, error) {
+	cr, err := s.storage.Save(res, time.Now())
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.saved[cr.ID] = cr
+	s.mu.Unlock()
+	return cr.ID, nil
+}
+
+func (s *SnapshotterResultStore) Load(ctx context.Context, id string) (CachedResult, error) {
+	s.mu.Lock()
+	cr, ok := s.saved[id]
+	s.mu.Unlock()
+	if !ok {
+		if !s.storage.Exists(ctx, id) {
+			return nil, errors.Wrapf(ErrResultNotFound, "id %s", id)
+		}
+		cr = CacheResult{ID: id}
+	}
+	res, err := s.storage.Load(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+	return NewCachedResult(res, nil), nil
+}
+
+func (s *SnapshotterResultStore) List(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.saved))
+	for id := range s.saved {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *SnapshotterResultStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	cr, ok := s.saved[id]
+	if !ok {
+		s.mu.Unlock()
+		return errors.Wrapf(ErrResultNotFound, "id %s", id)
+	}
+	delete(s.saved, id)
+	s.mu.Unlock()
+
+	// release the stored snapshot so Delete doesn't leak the result
+	res, err := s.storage.Load(ctx, cr)
+	if err != nil {
+		return err
+	}
+	return res.Release(ctx)
+}
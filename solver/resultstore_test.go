@@ -0,0 +1,85 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryResultStore(t *testing.T) {
+	ctx := context.TODO()
+	s := NewMemoryResultStore()
+
+	res := NewCachedResult(&dummyResult{id: "id0", value: "content"}, nil)
+	id, err := s.Save(ctx, res)
+	require.NoError(t, err)
+	require.Equal(t, "id0", id)
+
+	loaded, err := s.Load(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "content", unwrap(loaded))
+
+	ids, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"id0"}, ids)
+
+	require.NoError(t, s.Delete(ctx, id))
+	_, err = s.Load(ctx, id)
+	require.True(t, errors.Is(err, ErrResultNotFound))
+
+	err = s.Delete(ctx, "missing")
+	require.True(t, errors.Is(err, ErrResultNotFound))
+}
+
+func TestSnapshotterResultStore(t *testing.T) {
+	ctx := context.TODO()
+	s := NewSnapshotterResultStore(NewInMemoryResultStorage())
+
+	res := NewCachedResult(&dummyResult{id: "id0", value: "content"}, nil)
+	id, err := s.Save(ctx, res)
+	require.NoError(t, err)
+
+	loaded, err := s.Load(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "content", unwrap(loaded))
+
+	ids, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{id}, ids)
+
+	require.NoError(t, s.Delete(ctx, id))
+	ids, err = s.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, ids)
+}
+
+func TestResultStoreReceivesExecutedResults(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	store := NewMemoryResultStore()
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+		ResultStore:   store,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	defer j0.Discard()
+
+	res, err := j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v0", value: "result0"}),
+	})
+	require.NoError(t, err)
+
+	ids, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+
+	stored, err := store.Load(ctx, res.ID())
+	require.NoError(t, err)
+	require.Equal(t, "result0", unwrap(stored))
+}
@@ -0,0 +1,50 @@
+package solver
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/pkg/errors"
+)
+
+// SafeResult wraps a Result with an atomic reference count that guards
+// against double-release and use-after-release bugs. The underlying result
+// is only released when the count drops to zero; releasing more often
+// returns errdefs.ErrAlreadyReleased.
+type SafeResult struct {
+	res  Result
+	refs int64
+}
+
+// NewSafeResult wraps res with an initial reference count of one
+func NewSafeResult(res Result) *SafeResult {
+	return &SafeResult{res: res, refs: 1}
+}
+
+func (r *SafeResult) ID() string {
+	return r.res.ID()
+}
+
+func (r *SafeResult) Sys() interface{} {
+	return r.res.Sys()
+}
+
+// Clone increments the reference count. Release needs to be called once per
+// clone before the underlying result is released.
+func (r *SafeResult) Clone() Result {
+	atomic.AddInt64(&r.refs, 1)
+	return r
+}
+
+func (r *SafeResult) Release(ctx context.Context) error {
+	refs := atomic.AddInt64(&r.refs, -1)
+	if refs < 0 {
+		atomic.AddInt64(&r.refs, 1) // restore for later callers to fail consistently
+		return errors.WithStack(errdefs.ErrAlreadyReleased)
+	}
+	if refs == 0 {
+		return r.res.Release(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeResult(t *testing.T) {
+	r := NewSafeResult(&dummyResult{id: "id0", value: "content"})
+	require.Equal(t, "id0", r.ID())
+
+	// a clone requires an extra release before the underlying result goes
+	c := r.Clone()
+	require.NoError(t, c.Release(context.TODO()))
+	require.NoError(t, r.Release(context.TODO()))
+
+	err := r.Release(context.TODO())
+	require.Error(t, err)
+	require.True(t, errors.Is(err, errdefs.ErrAlreadyReleased))
+}
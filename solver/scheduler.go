@@ -1,15 +1,23 @@
 package solver
 
 import (
+	"container/heap"
 	"context"
 	"encoding/csv"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/moby/buildkit/identity"
+	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/internal/pipe"
 	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/cond"
+	"github.com/moby/buildkit/util/progress"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 )
 
@@ -17,30 +25,315 @@ var debugScheduler = false // TODO: replace with logs in build trace
 var debugSchedulerSteps []string
 var debugSchedulerStepsParseOnce sync.Once
 
+// debugCacheDiff logs the cache key diff against the previous result when a
+// vertex that hit the cache before misses again
+var debugCacheDiff = false
+
 func init() {
 	if os.Getenv("BUILDKIT_SCHEDULER_DEBUG") == "1" {
 		debugScheduler = true
 	}
+	if os.Getenv("BUILDKIT_CACHE_DIFF") == "1" {
+		debugCacheDiff = true
+	}
 }
 
-func newScheduler(ef edgeFactory) *scheduler {
+func newScheduler(ef edgeFactory, opts ...schedulerOpt) *scheduler {
 	s := &scheduler{
-		waitq:    map[*edge]struct{}{},
-		incoming: map[*edge][]*edgePipe{},
-		outgoing: map[*edge][]*edgePipe{},
+		waitq:           map[*edge]struct{}{},
+		resignalPending: map[*edge]struct{}{},
+		incoming:        map[*edge][]*edgePipe{},
+		outgoing:        map[*edge][]*edgePipe{},
 
-		stopped: make(chan struct{}),
-		closed:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+		closed:   make(chan struct{}),
+		qUpdated: make(chan struct{}),
 
 		ef: ef,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
 	s.cond = cond.NewStatefulCond(&s.mu)
 
 	go s.loop()
+	if s.heartbeatInterval > 0 {
+		go s.heartbeat()
+	}
+	if s.deadlockInterval > 0 {
+		go s.detectDeadlocks()
+	}
 
 	return s
 }
 
+// detectDeadlocks periodically scans for edges that can no longer make
+// progress and fails them with a DeadlockError.
+func (s *scheduler) detectDeadlocks() {
+	t := time.NewTicker(s.deadlockInterval)
+	defer t.Stop()
+	lastDispatch := map[*edge]int{}
+	for {
+		select {
+		case <-s.stopped:
+			return
+		case <-t.C:
+		}
+
+		// the loop goroutine holds mu while it is making progress; skip
+		// this scan rather than stalling it
+		if !s.mu.TryLock() {
+			continue
+		}
+		seen := map[*edge]int{}
+		for e := range s.incoming {
+			seen[e] = e.dispatchCount
+			if len(s.outgoing[e]) > 0 {
+				continue
+			}
+			s.muQ.Lock()
+			_, queued := s.waitq[e]
+			s.muQ.Unlock()
+			if queued {
+				continue
+			}
+			if prev, ok := lastDispatch[e]; !ok || prev != e.dispatchCount {
+				// first observation or still progressing
+				continue
+			}
+			e.markFailed(&pipeFactory{s: s, e: e}, &errdefs.DeadlockError{
+				VertexName:   e.edge.Vertex.Name(),
+				VertexDigest: e.edge.Vertex.Digest().String(),
+			})
+		}
+		s.mu.Unlock()
+		lastDispatch = seen
+	}
+}
+
+// heartbeat periodically checks the age of queued edges and escalates from a
+// warning to failing the edge when it doesn't get dispatched.
+func (s *scheduler) heartbeat() {
+	t := time.NewTicker(s.heartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stopped:
+			return
+		case <-t.C:
+		}
+
+		var stuck []*edge
+		s.muQ.Lock()
+		for e := range s.waitq {
+			age := time.Since(e.queuedAt)
+			if age < 2*s.heartbeatInterval {
+				continue
+			}
+			log := bklog.G(context.TODO()).
+				WithField("edge_vertex_name", e.edge.Vertex.Name()).
+				WithField("edge_vertex_digest", e.edge.Vertex.Digest()).
+				WithField("queue_age", age)
+			if age >= 3*s.heartbeatInterval {
+				stuck = append(stuck, e)
+				log.Error("edge exceeded heartbeat timeout")
+			} else {
+				log.Warn("edge has been queued for longer than the heartbeat interval")
+			}
+		}
+		s.muQ.Unlock()
+
+		if len(stuck) == 0 {
+			continue
+		}
+		// failing an edge needs the dispatch mutex; if the loop is wedged
+		// inside a dispatch we try again on the next tick
+		if !s.mu.TryLock() {
+			continue
+		}
+		for _, e := range stuck {
+			e.markFailed(&pipeFactory{s: s, e: e}, errors.Errorf("buildkit scheduler heartbeat timeout: edge %s was queued for longer than %v", e.edge.Vertex.Name(), 3*s.heartbeatInterval))
+		}
+		s.mu.Unlock()
+	}
+}
+
+// schedulerOpt configures optional scheduler behavior in newScheduler
+type schedulerOpt func(*scheduler)
+
+// WithWAL enables a write-ahead log at the given path recording every queued
+// edge. After a crash the recovered entries identify the builds that were in
+// flight so that clients can be asked to resubmit them. Open errors are
+// logged and disable the WAL rather than failing scheduler construction.
+func WithWAL(path string) schedulerOpt {
+	return func(s *scheduler) {
+		wal, recovered, err := openSchedulerWAL(path)
+		if err != nil {
+			bklog.G(context.TODO()).WithError(err).Errorf("failed to open scheduler WAL at %s", path)
+			return
+		}
+		s.wal = wal
+		s.walRecovered = recovered
+	}
+}
+
+// WithEdgeCompletionCallback registers a callback invoked whenever an edge
+// transitions to a completed state. On success the callback receives the
+// cached result, on failure the error. It is called synchronously from the
+// scheduler loop, so implementations that do significant work should hand it
+// off to their own goroutine or channel.
+func WithEdgeCompletionCallback(fn func(e Edge, result CachedResult, err error)) schedulerOpt {
+	return func(s *scheduler) {
+		s.onEdgeComplete = fn
+	}
+}
+
+// MergeSkipReason enumerates why two equivalent edges were not merged
+type MergeSkipReason string
+
+const (
+	// MergeSkipIgnoreCacheMismatch means the source edge ignores the cache
+	// while the target does not, so merging would change cache semantics.
+	MergeSkipIgnoreCacheMismatch MergeSkipReason = "ignore-cache-mismatch"
+	// MergeSkipCircularDependency means the edges depend on each other.
+	MergeSkipCircularDependency MergeSkipReason = "circular-dependency"
+)
+
+// MergeSkippedEvent describes a merge between two equivalent edges that the
+// scheduler declined to perform.
+type MergeSkippedEvent struct {
+	Source digest.Digest
+	Dest   digest.Digest
+	Reason MergeSkipReason
+}
+
+// WithMergeTracing emits a MergeSkippedEvent through the given progress
+// writer whenever the scheduler declines to merge two equivalent edges, so
+// unexpected cache-miss rates can be traced back to merge decisions.
+func WithMergeTracing(pw progress.Writer) schedulerOpt {
+	return func(s *scheduler) {
+		s.onMergeSkipped = func(ev MergeSkippedEvent) {
+			if err := pw.Write(identity.NewID(), ev); err != nil {
+				bklog.G(context.TODO()).WithError(err).Warn("failed to write merge skip event")
+			}
+		}
+	}
+}
+
+func (s *scheduler) emitMergeSkipped(dest, src *edge, reason MergeSkipReason) {
+	if s.onMergeSkipped == nil {
+		return
+	}
+	s.onMergeSkipped(MergeSkippedEvent{
+		Source: src.edge.Vertex.Digest(),
+		Dest:   dest.edge.Vertex.Digest(),
+		Reason: reason,
+	})
+}
+
+// WithDeadlockDetection starts a background scan that fails edges which have
+// open incoming requests but no outgoing work and have not been dispatched
+// since the previous scan. Long-running ops keep an open outgoing function
+// pipe and are never flagged. A non-positive interval selects the default of
+// 30 seconds.
+func WithDeadlockDetection(interval time.Duration) schedulerOpt {
+	return func(s *scheduler) {
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		s.deadlockInterval = interval
+	}
+}
+
+// SchedulerPriorityLabel is the vertex description key that biases dispatch
+// priority, settable e.g. through a BUILDKIT_SCHEDULER_PRIORITY label on a
+// Dockerfile instruction. The value must be an integer; higher values
+// dispatch earlier and 0 is the default.
+const SchedulerPriorityLabel = "BUILDKIT_SCHEDULER_PRIORITY"
+
+// DefaultPriorityFunc orders edges by the user-supplied priority label,
+// using the static structural cost as a tie breaker. It only reads immutable
+// vertex data: priority functions run from signal() on arbitrary goroutines
+// holding only the queue mutex, so the dispatch-loop-owned edge state
+// (deps, open requests, keys) is off limits here; see estimateCost for the
+// dynamic variant that requires the dispatch mutex.
+func DefaultPriorityFunc(e *edge) int {
+	base := 0
+	if v, ok := e.edge.Vertex.Options().Description[SchedulerPriorityLabel]; ok {
+		if p, err := strconv.Atoi(v); err == nil {
+			base = p
+		} else {
+			bklog.G(context.TODO()).
+				WithField("edge_vertex_name", e.edge.Vertex.Name()).
+				Warnf("invalid %s value %q", SchedulerPriorityLabel, v)
+		}
+	}
+	return base*1000 + e.edge.Vertex.Options().SchedulerWeight*100 + 10*len(e.edge.Vertex.Inputs())
+}
+
+// WithPriorityFunc replaces the FIFO dispatch order with a priority queue.
+// The function is called when an edge is enqueued and returns its priority;
+// higher values are dispatched first. Edges with equal priority keep their
+// FIFO order.
+//
+// Priority functions are evaluated from signal() on arbitrary goroutines
+// while only the queue mutex is held. They must therefore restrict
+// themselves to immutable vertex data (e.edge.Vertex and derived values);
+// the dispatch-loop-owned edge state (deps, depRequests, keys, cacheMap and
+// friends) is guarded by the dispatch mutex and reading it from a priority
+// function is a data race.
+func WithPriorityFunc(fn func(e *edge) int) schedulerOpt {
+	return func(s *scheduler) {
+		s.priorityFunc = fn
+	}
+}
+
+// WithEdgeMetadataStore records merge and failure decisions for edges in the
+// given store so they can be inspected after the fact.
+func WithEdgeMetadataStore(store EdgeMetadataStore) schedulerOpt {
+	return func(s *scheduler) {
+		s.metadataStore = store
+	}
+}
+
+// WithGroupDispatch makes the dispatcher batch-process queued edges that
+// share the same cache map digest and output index in a single loop
+// iteration. For large fan-in graphs this cuts down on queue churn while the
+// edges wait to be merged.
+func WithGroupDispatch(v bool) schedulerOpt {
+	return func(s *scheduler) {
+		s.groupDispatch = v
+	}
+}
+
+// WithHeartbeatInterval enables a periodic scan for edges that are stuck in
+// the wait queue. An edge queued for longer than twice the interval is
+// logged as a warning; after three intervals it is failed with a heartbeat
+// timeout error. This catches scheduler stalls without external watchdogs.
+func WithHeartbeatInterval(d time.Duration) schedulerOpt {
+	return func(s *scheduler) {
+		s.heartbeatInterval = d
+	}
+}
+
+// withEventSink notifies the sink of edge completions, including whether the
+// result was loaded from cache.
+func withEventSink(sink BuildEventSink) schedulerOpt {
+	return func(s *scheduler) {
+		s.eventSink = sink
+	}
+}
+
+// WithEdgeResignalMinInterval sets the minimum interval between two dispatches
+// of the same edge. Signals that arrive faster than the interval after the
+// previous dispatch are coalesced into a single delayed re-enqueue so that an
+// edge that keeps signaling itself can't starve the dispatcher.
+func WithEdgeResignalMinInterval(d time.Duration) schedulerOpt {
+	return func(s *scheduler) {
+		s.resignalMinInterval = d
+	}
+}
+
 type dispatcher struct {
 	next *dispatcher
 	e    *edge
@@ -60,6 +353,39 @@ type scheduler struct {
 	stoppedOnce sync.Once
 	closed      chan struct{}
 
+	resignalMinInterval time.Duration
+	resignalPending     map[*edge]struct{}
+
+	// qUpdated is closed and replaced after every dispatch so that waiters
+	// can recheck the queue state. Guarded by muQ.
+	qUpdated chan struct{}
+
+	// successor redirects signals to the scheduler that replaced this one
+	// after a Snapshot/RestoreScheduler cycle
+	successor atomic.Pointer[scheduler]
+
+	wal          *schedulerWAL
+	walRecovered []WALEntry
+
+	onEdgeComplete func(e Edge, result CachedResult, err error)
+	eventSink      BuildEventSink
+
+	heartbeatInterval time.Duration
+	groupDispatch     bool
+	metadataStore     EdgeMetadataStore
+
+	metrics *schedulerMetrics
+
+	deadlockInterval time.Duration
+	onMergeSkipped   func(MergeSkippedEvent)
+
+	// priorityFunc, when set, switches the dispatch queue from FIFO order
+	// to a max-heap ordered by the returned priority. pq and pqSeq are
+	// guarded by muQ.
+	priorityFunc func(e *edge) int
+	pq           edgePriorityQueue
+	pqSeq        uint64
+
 	incoming map[*edge][]*edgePipe
 	outgoing map[*edge][]*edgePipe
 }
@@ -69,6 +395,15 @@ func (s *scheduler) Stop() {
 		close(s.stopped)
 	})
 	<-s.closed
+	if s.wal != nil {
+		s.wal.close()
+	}
+}
+
+// RecoveredWALEntries returns the edges that were still queued when a
+// previous process using the same WAL path died.
+func (s *scheduler) RecoveredWALEntries() []WALEntry {
+	return s.walRecovered
 }
 
 func (s *scheduler) loop() {
@@ -102,25 +437,278 @@ func (s *scheduler) loop() {
 		default:
 		}
 		s.muQ.Lock()
-		l := s.next
-		if l != nil {
+		var next *edge
+		if s.priorityFunc != nil {
+			if s.pq.Len() > 0 {
+				next = heap.Pop(&s.pq).(*prioritizedEdge).e
+			}
+		} else if l := s.next; l != nil {
 			if l == s.last {
 				s.last = nil
 			}
 			s.next = l.next
-			delete(s.waitq, l.e)
+			next = l.e
+		}
+		if next != nil {
+			delete(s.waitq, next)
+			if s.resignalMinInterval > 0 {
+				next.lastDispatchTime = time.Now()
+			}
+			if s.metrics != nil {
+				if !next.queuedAt.IsZero() {
+					s.metrics.dispatchLatency.Observe(time.Since(next.queuedAt).Seconds())
+				}
+				s.metrics.queueDepth.Set(float64(len(s.waitq)))
+			}
 		}
 		s.muQ.Unlock()
-		if l == nil {
+		if next == nil {
 			s.cond.Wait()
 			continue
 		}
-		s.dispatch(l.e)
+		group := []*edge{next}
+		if s.groupDispatch {
+			group = s.popGroup(next)
+		}
+		for _, e := range group {
+			s.dispatch(e)
+		}
+
+		s.muQ.Lock()
+		close(s.qUpdated)
+		s.qUpdated = make(chan struct{})
+		drained := len(s.waitq) == 0
+		s.muQ.Unlock()
+
+		if drained && s.wal != nil {
+			if err := s.wal.compact(); err != nil {
+				bklog.G(context.TODO()).WithError(err).Error("failed to compact scheduler WAL")
+			}
+		}
+	}
+}
+
+// FlushPending blocks until the dispatch queue has drained or the context is
+// cancelled. Unlike Stop it does not abandon queued edges: edges that get
+// re-signalled while draining are processed as well. It is intended for
+// graceful shutdown paths that want in-flight builds to settle before the
+// scheduler is stopped.
+func (s *scheduler) FlushPending(ctx context.Context) error {
+	for {
+		s.muQ.Lock()
+		empty := len(s.waitq) == 0
+		upd := s.qUpdated
+		s.muQ.Unlock()
+		if empty {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-s.stopped:
+			return nil
+		case <-upd:
+		}
+	}
+}
+
+// WaitForIdle blocks until the scheduler has no queued edges and no open
+// incoming or outgoing pipes, or until the context is cancelled. It is mainly
+// useful for tests and graceful shutdown paths that need to observe the
+// scheduler in a settled state.
+func (s *scheduler) WaitForIdle(ctx context.Context) error {
+	for {
+		s.muQ.Lock()
+		upd := s.qUpdated
+		qEmpty := len(s.waitq) == 0
+		s.muQ.Unlock()
+
+		if qEmpty {
+			s.mu.Lock()
+			idle := len(s.incoming) == 0 && len(s.outgoing) == 0
+			s.mu.Unlock()
+			if idle {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-s.stopped:
+			return nil
+		case <-upd:
+		}
+	}
+}
+
+// SchedulerState is an opaque snapshot of a scheduler's pending work,
+// produced by Snapshot and consumed by RestoreScheduler.
+type SchedulerState struct {
+	from     *scheduler
+	queued   []*edge
+	incoming map[*edge][]*edgePipe
+	outgoing map[*edge][]*edgePipe
+}
+
+// Snapshot captures the pending wait queue and the open pipe registrations
+// so the scheduler can be recreated without losing in-flight requests, e.g.
+// around a worker configuration reload. The scheduler should be stopped
+// after the snapshot is taken.
+func (s *scheduler) Snapshot() SchedulerState {
+	st := SchedulerState{
+		from:     s,
+		incoming: map[*edge][]*edgePipe{},
+		outgoing: map[*edge][]*edgePipe{},
+	}
+	s.mu.Lock()
+	for e, pipes := range s.incoming {
+		st.incoming[e] = append([]*edgePipe(nil), pipes...)
+	}
+	for e, pipes := range s.outgoing {
+		st.outgoing[e] = append([]*edgePipe(nil), pipes...)
+	}
+	s.muQ.Lock()
+	for d := s.next; d != nil; d = d.next {
+		st.queued = append(st.queued, d.e)
+	}
+	s.muQ.Unlock()
+	s.mu.Unlock()
+	return st
+}
+
+// RestoreScheduler creates a new scheduler from a snapshot. The old
+// scheduler forwards any late pipe-completion signals to the new one through
+// its successor pointer, so the completion callbacks installed before the
+// snapshot stay untouched, and every edge with pending work is re-signalled
+// so evaluation resumes where the old scheduler left off.
+func RestoreScheduler(state SchedulerState, ef edgeFactory, opts ...schedulerOpt) *scheduler {
+	s := newScheduler(ef, opts...)
+
+	s.mu.Lock()
+	for e, pipes := range state.incoming {
+		s.incoming[e] = pipes
+	}
+	for e, pipes := range state.outgoing {
+		s.outgoing[e] = pipes
+	}
+	resignal := map[*edge]struct{}{}
+	for _, e := range state.queued {
+		resignal[e] = struct{}{}
+	}
+	for e := range state.incoming {
+		resignal[e] = struct{}{}
+	}
+	for e := range state.outgoing {
+		resignal[e] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	if state.from != nil {
+		state.from.successor.Store(s)
+	}
+
+	for e := range resignal {
+		s.signal(e)
+	}
+	return s
+}
+
+// EdgeCount returns the number of edges that currently have open incoming
+// pipes and the number with open outgoing pipes. It is intended for
+// monitoring the amount of in-flight work in the scheduler.
+func (s *scheduler) EdgeCount() (incoming, outgoing int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.incoming), len(s.outgoing)
+}
+
+// prioritizedEdge is an entry in the priority dispatch queue
+type prioritizedEdge struct {
+	e        *edge
+	priority int
+	seq      uint64
+}
+
+// edgePriorityQueue is a max-heap of queued edges; equal priorities keep
+// FIFO order through the sequence number
+type edgePriorityQueue []*prioritizedEdge
+
+func (q edgePriorityQueue) Len() int { return len(q) }
+
+func (q edgePriorityQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q edgePriorityQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *edgePriorityQueue) Push(x any) { *q = append(*q, x.(*prioritizedEdge)) }
+
+func (q *edgePriorityQueue) Pop() any {
+	old := *q
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return it
+}
+
+// popGroup removes all queued edges that share first's cache map digest and
+// output index from the wait queue (FIFO list or priority queue) and returns
+// them together with first, so that they can be dispatched as one batch.
+// It reads edge cache maps and must only be called from the dispatch loop
+// while the dispatch mutex is held.
+func (s *scheduler) popGroup(first *edge) []*edge {
+	group := []*edge{first}
+	if first.cacheMap == nil {
+		return group
+	}
+	matches := func(e *edge) bool {
+		return e.cacheMap != nil && e.cacheMap.Digest == first.cacheMap.Digest && e.edge.Index == first.edge.Index
+	}
+	s.muQ.Lock()
+	if s.priorityFunc != nil {
+		for i := 0; i < s.pq.Len(); {
+			e := s.pq[i].e
+			if !matches(e) {
+				i++
+				continue
+			}
+			heap.Remove(&s.pq, i)
+			delete(s.waitq, e)
+			group = append(group, e)
+			// heap.Remove moved another entry to index i, recheck it
+		}
+	} else {
+		var prev *dispatcher
+		for d := s.next; d != nil; d = d.next {
+			e := d.e
+			if matches(e) {
+				if prev == nil {
+					s.next = d.next
+				} else {
+					prev.next = d.next
+				}
+				if d == s.last {
+					s.last = prev
+				}
+				delete(s.waitq, e)
+				group = append(group, e)
+				continue
+			}
+			prev = d
+		}
 	}
+	s.muQ.Unlock()
+	return group
 }
 
 // dispatch schedules an edge to be processed
 func (s *scheduler) dispatch(e *edge) {
+	e.dispatchCount++
 	inc := make([]pipe.Sender, len(s.incoming[e]))
 	for i, p := range s.incoming[e] {
 		inc[i] = p.Sender
@@ -152,6 +740,27 @@ func (s *scheduler) dispatch(e *edge) {
 		debugSchedulerPostUnpark(e, inc)
 	}
 
+	if !e.completionNotified && e.isComplete() {
+		e.completionNotified = true
+		if s.metadataStore != nil && e.err != nil {
+			s.metadataStore.RecordDecision(e.edge.Vertex.Digest().String(), EdgeDecisionFailed)
+		}
+		if s.onEdgeComplete != nil {
+			var res CachedResult
+			if e.result != nil {
+				res = e.result.CachedResult
+			}
+			s.onEdgeComplete(e.edge, res, e.err)
+		}
+		if s.eventSink != nil {
+			if e.err != nil {
+				s.eventSink.OnVertexFailed(e.edge.Vertex, e.err)
+			} else {
+				s.eventSink.OnVertexCompleted(e.edge.Vertex, e.execCacheLoad)
+			}
+		}
+	}
+
 	// set up new requests that didn't complete/were added by this run
 	openIncoming := make([]*edgePipe, 0, len(inc))
 	for _, r := range s.incoming[e] {
@@ -184,6 +793,7 @@ func (s *scheduler) dispatch(e *edge) {
 			origEdge := e.index.LoadOrStore(k, e)
 			if origEdge != nil {
 				if e.isDep(origEdge) || origEdge.isDep(e) {
+					s.emitMergeSkipped(origEdge, e, MergeSkipCircularDependency)
 					bklog.G(context.TODO()).
 						WithField("edge_vertex_name", e.edge.Vertex.Name()).
 						WithField("edge_vertex_digest", e.edge.Vertex.Digest()).
@@ -215,8 +825,14 @@ func (s *scheduler) dispatch(e *edge) {
 						WithField("dest_index", dest.edge.Index).
 						Debug("merging edges")
 					if s.mergeTo(dest, src) {
+						if s.metadataStore != nil {
+							s.metadataStore.RecordDecision(src.edge.Vertex.Digest().String(), EdgeDecisionMerged)
+						}
 						s.ef.setEdge(src.edge, dest)
 					} else {
+						if s.metadataStore != nil {
+							s.metadataStore.RecordDecision(src.edge.Vertex.Digest().String(), EdgeDecisionMergeSkipped)
+						}
 						bklog.G(context.TODO()).
 							WithField("source_edge_vertex_name", src.edge.Vertex.Name()).
 							WithField("source_edge_vertex_digest", src.edge.Vertex.Digest()).
@@ -244,18 +860,60 @@ func (s *scheduler) dispatch(e *edge) {
 	}
 }
 
-// signal notifies that an edge needs to be processed again
+// signal notifies that an edge needs to be processed again. Re-signal
+// coalescing applies regardless of whether the edge then enters the FIFO
+// list or the priority queue.
 func (s *scheduler) signal(e *edge) {
+	if succ := s.successor.Load(); succ != nil {
+		// this scheduler was replaced via RestoreScheduler; completions of
+		// pipes created before the snapshot wake up the successor instead
+		succ.signal(e)
+		return
+	}
 	s.muQ.Lock()
 	if _, ok := s.waitq[e]; !ok {
-		d := &dispatcher{e: e}
-		if s.last == nil {
-			s.next = d
+		if s.resignalMinInterval > 0 {
+			if _, ok := s.resignalPending[e]; ok {
+				// an earlier signal already scheduled a delayed re-enqueue
+				s.muQ.Unlock()
+				return
+			}
+			if elapsed := time.Since(e.lastDispatchTime); elapsed < s.resignalMinInterval {
+				s.resignalPending[e] = struct{}{}
+				time.AfterFunc(s.resignalMinInterval-elapsed, func() {
+					s.muQ.Lock()
+					delete(s.resignalPending, e)
+					s.muQ.Unlock()
+					s.signal(e)
+				})
+				s.muQ.Unlock()
+				return
+			}
+		}
+		if s.priorityFunc != nil {
+			s.pqSeq++
+			heap.Push(&s.pq, &prioritizedEdge{e: e, priority: s.priorityFunc(e), seq: s.pqSeq})
 		} else {
-			s.last.next = d
+			d := &dispatcher{e: e}
+			if s.last == nil {
+				s.next = d
+			} else {
+				s.last.next = d
+			}
+			s.last = d
 		}
-		s.last = d
 		s.waitq[e] = struct{}{}
+		if s.heartbeatInterval > 0 || s.metrics != nil {
+			e.queuedAt = time.Now()
+		}
+		if s.metrics != nil {
+			s.metrics.queueDepth.Set(float64(len(s.waitq)))
+		}
+		if s.wal != nil {
+			if err := s.wal.append(e.edge.Vertex.Digest(), e.edge.Index); err != nil {
+				bklog.G(context.TODO()).WithError(err).Error("failed to append to scheduler WAL")
+			}
+		}
 		s.cond.Signal()
 	}
 	s.muQ.Unlock()
@@ -299,13 +957,19 @@ func (s *scheduler) build(ctx context.Context, edge Edge) (CachedResult, error)
 
 // newPipe creates a new request pipe between two edges
 func (s *scheduler) newPipe(target, from *edge, req pipe.Request) *pipe.Pipe {
+	s.signal(target)
+	return s.registerPipe(target, from, req)
+}
+
+// registerPipe wires up a request pipe between two edges without signalling
+// the target. Callers must make sure the target gets signalled separately.
+func (s *scheduler) registerPipe(target, from *edge, req pipe.Request) *pipe.Pipe {
 	p := &edgePipe{
 		Pipe:   pipe.New(req),
 		Target: target,
 		From:   from,
 	}
 
-	s.signal(target)
 	if from != nil {
 		p.OnSendCompletion = func() {
 			p.mu.Lock()
@@ -342,8 +1006,30 @@ func (s *scheduler) newRequestWithFunc(e *edge, f func(context.Context) (interfa
 
 // mergeTo merges the state from one edge to another. source edge is discarded.
 func (s *scheduler) mergeTo(target, src *edge) bool {
+	if max := target.edge.Vertex.Options().MaxFanoutBeforeSplit; max > 0 {
+		if len(s.incoming[target])+len(s.incoming[src]) > max {
+			// keeping the edges separate trades duplicate work for bounded
+			// fan-out on the shared result
+			return false
+		}
+	}
 	if !target.edge.Vertex.Options().IgnoreCache && src.edge.Vertex.Options().IgnoreCache {
-		return false
+		if target.isComplete() {
+			// the target already holds a result (possibly loaded from
+			// cache); a downgrade can't undo that, so the ignore-cache
+			// source must stay on its own edge
+			s.emitMergeSkipped(target, src, MergeSkipIgnoreCacheMismatch)
+			return false
+		}
+		// the merged edge has to honor the stricter cache policy: downgrade
+		// the target to ignore-cache mode and drop the cache state it has
+		// accumulated so far
+		s.emitMergeSkipped(target, src, MergeSkipIgnoreCacheMismatch)
+		target.mergedIgnoreCache = true
+		target.cacheRecords = map[string]*CacheRecord{}
+		target.cacheRecordsLoaded = map[string]struct{}{}
+		target.keyMap = map[string]struct{}{}
+		target.keys = nil
 	}
 	for _, inc := range s.incoming[src] {
 		inc.mu.Lock()
@@ -414,6 +1100,44 @@ func (pf *pipeFactory) NewInputRequest(ee Edge, req *edgeRequest) pipe.Receiver
 	return p.Receiver
 }
 
+// batchedInputRequest pairs a dependency edge with its request payload for
+// NewBatchedRequest.
+type batchedInputRequest struct {
+	edge Edge
+	req  *edgeRequest
+}
+
+// NewBatchedRequest creates input requests to multiple edges in one pass.
+// All pipes are registered first and every distinct target edge is signalled
+// exactly once, reducing dispatch queue churn for vertexes with many
+// dependencies compared to issuing the lookups individually.
+func (pf *pipeFactory) NewBatchedRequest(reqs []batchedInputRequest) []pipe.Receiver {
+	out := make([]pipe.Receiver, 0, len(reqs))
+	targets := map[*edge]struct{}{}
+	for _, r := range reqs {
+		ee := r.edge
+		target := pf.s.ef.getEdge(ee)
+		if target == nil {
+			bklog.G(context.TODO()).
+				WithField("edge_vertex_name", ee.Vertex.Name()).
+				WithField("edge_vertex_digest", ee.Vertex.Digest()).
+				WithField("edge_index", ee.Index).
+				Error("failed to get edge: inconsistent graph state")
+			out = append(out, pf.NewFuncRequest(func(_ context.Context) (interface{}, error) {
+				return nil, errors.Errorf("failed to get edge: inconsistent graph state in edge %s %s %d", ee.Vertex.Name(), ee.Vertex.Digest(), ee.Index)
+			}))
+			continue
+		}
+		p := pf.s.registerPipe(target, pf.e, pipe.Request{Payload: r.req})
+		targets[target] = struct{}{}
+		out = append(out, p.Receiver)
+	}
+	for target := range targets {
+		pf.s.signal(target)
+	}
+	return out
+}
+
 func (pf *pipeFactory) NewFuncRequest(f func(context.Context) (interface{}, error)) pipe.Receiver {
 	p := pf.s.newRequestWithFunc(pf.e, f)
 	if pf.e.debug {
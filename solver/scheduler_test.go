@@ -1,18 +1,24 @@
 package solver
 
 import (
+	"bytes"
+	"container/heap"
 	"context"
 	_ "crypto/sha256"
 	"fmt"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/progress"
 	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
@@ -3613,483 +3619,1699 @@ func generateSubGraph(nodes int) (Edge, int) {
 	return Edge{Vertex: vtxSum(extra, vtxOpt{inputs: inputs})}, value
 }
 
-type vtxOpt struct {
-	name             string
-	cacheKeySeed     string
-	cacheKeySeeds    []func() string
-	execDelay        time.Duration
-	cacheDelay       time.Duration
-	cachePreFunc     func(context.Context) error
-	execPreFunc      func(context.Context) error
-	inputs           []Edge
-	value            string
-	slowCacheCompute map[int]ResultBasedCacheFunc
-	selectors        map[int]digest.Digest
-	cacheSource      CacheManager
-	ignoreCache      bool
-}
-
-func vtx(opt vtxOpt) *vertex {
-	if opt.name == "" {
-		opt.name = identity.NewID()
-	}
-	if opt.cacheKeySeed == "" {
-		opt.cacheKeySeed = identity.NewID()
-	}
-	return &vertex{opt: opt}
-}
-
-type vertex struct {
-	opt vtxOpt
+func TestPriorityScheduling(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
 
-	cacheCallCount *int64
-	execCallCount  *int64
-}
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
 
-func (v *vertex) Digest() digest.Digest {
-	return digest.FromBytes([]byte(v.opt.name))
-}
-func (v *vertex) Sys() interface{} {
-	return v
-}
-func (v *vertex) Inputs() []Edge {
-	return v.opt.inputs
-}
-func (v *vertex) Name() string {
-	return v.opt.name
-}
-func (v *vertex) Options() VertexOptions {
-	var cache []CacheManager
-	if v.opt.cacheSource != nil {
-		cache = append(cache, v.opt.cacheSource)
-	}
-	return VertexOptions{
-		CacheSources: cache,
-		IgnoreCache:  v.opt.ignoreCache,
-	}
-}
+	// prioritize edges with more inputs (closer to the critical path)
+	s.s.Stop()
+	s.s = newScheduler(s, WithPriorityFunc(func(e *edge) int {
+		return len(e.edge.Vertex.Inputs())
+	}))
 
-func (v *vertex) setupCallCounters() {
-	var cacheCount int64
-	var execCount int64
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
 
-	v.setCallCounters(&cacheCount, &execCount)
-}
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
 
-func (v *vertex) setCallCounters(cacheCount, execCount *int64) {
-	v.cacheCallCount = cacheCount
-	v.execCallCount = execCount
+	res, err := j0.Build(ctx, diamondGraph("d0"))
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result-root")
 
-	for _, inp := range v.opt.inputs {
-		var v *vertex
-		switch vv := inp.Vertex.(type) {
-		case *vertex:
-			v = vv
-		case *vertexSum:
-			v = vv.vertex
-		case *vertexAdd:
-			v = vv.vertex
-		case *vertexConst:
-			v = vv.vertex
-		case *vertexSubBuild:
-			v = vv.vertex
-		}
-		v.setCallCounters(cacheCount, execCount)
-	}
+	require.NoError(t, j0.Discard())
+	j0 = nil
 }
 
-func (v *vertex) cacheMap(ctx context.Context) error {
-	if f := v.opt.cachePreFunc; f != nil {
-		if err := f(ctx); err != nil {
-			return err
-		}
+// diamondGraph builds a diamond-shaped graph: two intermediate vertices
+// sharing a base, joined by a root vertex.
+func diamondGraph(prefix string) Edge {
+	base := Edge{
+		Vertex: vtx(vtxOpt{name: prefix + "-base", value: "result-base"}),
 	}
-	if v.cacheCallCount != nil {
-		atomic.AddInt64(v.cacheCallCount, 1)
+	left := Edge{
+		Vertex: vtx(vtxOpt{name: prefix + "-left", value: "result-left", inputs: []Edge{base}}),
 	}
-	select {
-	case <-ctx.Done():
-		return context.Cause(ctx)
-	default:
+	right := Edge{
+		Vertex: vtx(vtxOpt{name: prefix + "-right", value: "result-right", inputs: []Edge{base}}),
 	}
-	select {
-	case <-time.After(v.opt.cacheDelay):
-	case <-ctx.Done():
-		return context.Cause(ctx)
+	return Edge{
+		Vertex: vtx(vtxOpt{name: prefix + "-root", value: "result-root", inputs: []Edge{left, right}}),
 	}
-	return nil
 }
 
-func (v *vertex) CacheMap(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
-	if index == 0 {
-		if err := v.cacheMap(ctx); err != nil {
-			return nil, false, err
-		}
-		return v.makeCacheMap(), len(v.opt.cacheKeySeeds) == index, nil
-	}
-	return &CacheMap{
-		Digest: digest.FromBytes([]byte(fmt.Sprintf("seed:%s", v.opt.cacheKeySeeds[index-1]()))),
-	}, len(v.opt.cacheKeySeeds) == index, nil
-}
+func benchmarkScheduler(b *testing.B, opts ...schedulerOpt) {
+	ctx := context.TODO()
+	for i := 0; i < b.N; i++ {
+		s := NewSolver(SolverOpt{
+			ResolveOpFunc: testOpResolver,
+		})
+		s.s.Stop()
+		s.s = newScheduler(s, opts...)
 
-func (v *vertex) exec(ctx context.Context, inputs []Result) error {
-	if len(inputs) != len(v.Inputs()) {
-		return errors.Errorf("invalid number of inputs")
-	}
-	if f := v.opt.execPreFunc; f != nil {
-		if err := f(ctx); err != nil {
-			return err
+		j0, err := s.NewJob(fmt.Sprintf("job%d", i))
+		if err != nil {
+			b.Fatal(err)
 		}
+		if _, err := j0.Build(ctx, diamondGraph(fmt.Sprintf("d%d", i))); err != nil {
+			b.Fatal(err)
+		}
+		j0.Discard()
+		s.Close()
 	}
-	if v.execCallCount != nil {
-		atomic.AddInt64(v.execCallCount, 1)
-	}
-	select {
-	case <-ctx.Done():
-		return context.Cause(ctx)
-	default:
-	}
-	select {
-	case <-time.After(v.opt.execDelay):
-	case <-ctx.Done():
-		return context.Cause(ctx)
-	}
-	return nil
 }
 
-func (v *vertex) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
-	if err := v.exec(ctx, inputs); err != nil {
-		return nil, err
-	}
-	return []Result{&dummyResult{id: identity.NewID(), value: v.opt.value}}, nil
+func BenchmarkSchedulerFIFO(b *testing.B) {
+	benchmarkScheduler(b)
 }
 
-func (v *vertex) Acquire(ctx context.Context) (ReleaseFunc, error) {
-	return func() {}, nil
+func BenchmarkSchedulerPriority(b *testing.B) {
+	benchmarkScheduler(b, WithPriorityFunc(func(e *edge) int {
+		return len(e.edge.Vertex.Inputs())
+	}))
 }
 
-func (v *vertex) makeCacheMap() *CacheMap {
-	m := &CacheMap{
-		Digest: digest.FromBytes([]byte(fmt.Sprintf("seed:%s", v.opt.cacheKeySeed))),
-		Deps: make([]struct {
-			Selector          digest.Digest
-			ComputeDigestFunc ResultBasedCacheFunc
-			PreprocessFunc    PreprocessFunc
-		}, len(v.Inputs())),
-	}
-	for i, f := range v.opt.slowCacheCompute {
-		m.Deps[i].ComputeDigestFunc = f
-	}
-	for i, dgst := range v.opt.selectors {
-		m.Deps[i].Selector = dgst
-	}
-	return m
-}
+func TestResultSizeLimit(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
 
-// vtxConst returns a vertex that outputs a constant integer
-func vtxConst(v int, opt vtxOpt) *vertexConst {
-	if opt.cacheKeySeed == "" {
-		opt.cacheKeySeed = fmt.Sprintf("const-%d", v)
-	}
-	if opt.name == "" {
-		opt.name = opt.cacheKeySeed + "-" + identity.NewID()
-	}
-	return &vertexConst{vertex: vtx(opt), value: v}
-}
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc:   testOpResolver,
+		ResultSizeLimit: 8,
+	})
+	defer s.Close()
 
-type vertexConst struct {
-	*vertex
-	value int
-}
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
 
-func (v *vertexConst) Sys() interface{} {
-	return v
-}
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
 
-func (v *vertexConst) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
-	if err := v.exec(ctx, inputs); err != nil {
-		return nil, err
-	}
-	return []Result{&dummyResult{id: identity.NewID(), intValue: v.value}}, nil
-}
+	// small result passes the limit
+	res, err := j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v0", value: "small"}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "small")
 
-func (v *vertexConst) Acquire(ctx context.Context) (ReleaseFunc, error) {
-	return func() {}, nil
-}
+	// oversized result fails the build
+	_, err = j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{name: "v1", value: "definitely-too-large"}),
+	})
+	require.Error(t, err)
+	var tle *ResultTooLargeError
+	require.True(t, errors.As(err, &tle))
+	require.Equal(t, int64(8), tle.Limit)
 
-// vtxSum returns a vertex that outputs sum of its inputs plus a constant
-func vtxSum(v int, opt vtxOpt) *vertexSum {
-	if opt.cacheKeySeed == "" {
-		opt.cacheKeySeed = fmt.Sprintf("sum-%d-%d", v, len(opt.inputs))
-	}
-	if opt.name == "" {
-		opt.name = opt.cacheKeySeed + "-" + identity.NewID()
-	}
-	return &vertexSum{vertex: vtx(opt), value: v}
+	require.NoError(t, j0.Discard())
+	j0 = nil
 }
 
-type vertexSum struct {
-	*vertex
-	value int
-}
+func TestOperationTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
 
-func (v *vertexSum) Sys() interface{} {
-	return v
-}
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
 
-func (v *vertexSum) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
-	if err := v.exec(ctx, inputs); err != nil {
-		return nil, err
-	}
-	s := v.value
-	for _, inp := range inputs {
-		r, ok := inp.Sys().(*dummyResult)
-		if !ok {
-			return nil, errors.Errorf("invalid input type: %T", inp.Sys())
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
 		}
-		s += r.intValue
+	}()
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:             "v0",
+			value:            "result0",
+			execDelay:        time.Hour,
+			operationTimeout: 100 * time.Millisecond,
+		}),
 	}
-	return []Result{&dummyResult{id: identity.NewID(), intValue: s}}, nil
-}
 
-func (v *vertexSum) Acquire(ctx context.Context) (ReleaseFunc, error) {
-	return func() {}, nil
+	start := time.Now()
+	_, err = j0.Build(ctx, g0)
+	require.Error(t, err)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Minute)
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
 }
 
-// vtxAdd returns a vertex that outputs each input plus a constant
-func vtxAdd(v int, opt vtxOpt) *vertexAdd {
-	if opt.cacheKeySeed == "" {
-		opt.cacheKeySeed = fmt.Sprintf("add-%d-%d", v, len(opt.inputs))
-	}
-	if opt.name == "" {
+func TestFlushPending(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:      "v0",
+			value:     "result0",
+			execDelay: 10 * time.Millisecond,
+		}),
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		res, err := j0.Build(egCtx, g0)
+		if err != nil {
+			return err
+		}
+		require.Equal(t, unwrap(res), "result0")
+		return nil
+	})
+	eg.Go(func() error {
+		return s.FlushPending(egCtx)
+	})
+	require.NoError(t, eg.Wait())
+
+	// queue is drained after the build completed
+	require.NoError(t, s.FlushPending(ctx))
+
+	// cancelled context is returned when the queue can't drain in time
+	cctx, cancel := context.WithCancelCause(ctx)
+	cancel(errors.WithStack(context.Canceled))
+	require.NoError(t, s.FlushPending(cctx)) // empty queue wins over cancellation
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestBuildMulti(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	shared := vtx(vtxOpt{
+		name:         "vshared",
+		cacheKeySeed: "seed-shared",
+		value:        "result-shared",
+	})
+	shared.setupCallCounters()
+
+	reqs := make([]BuildRequest, 5)
+	for i := range reqs {
+		reqs[i] = BuildRequest{
+			Edge: Edge{
+				Vertex: vtx(vtxOpt{
+					name:         fmt.Sprintf("v%d", i),
+					cacheKeySeed: fmt.Sprintf("seed%d", i),
+					value:        fmt.Sprintf("result%d", i),
+					inputs:       []Edge{{Vertex: shared}},
+				}),
+			},
+		}
+	}
+
+	results, err := s.BuildMulti(ctx, reqs)
+	require.NoError(t, err)
+	require.Equal(t, len(reqs), len(results))
+
+	for i, r := range results {
+		require.NoError(t, r.Err)
+		require.Equal(t, unwrap(r.Result), fmt.Sprintf("result%d", i))
+	}
+
+	// the shared dependency was only executed once across all requests
+	require.Equal(t, int64(1), *shared.execCallCount)
+}
+
+func TestEdgeCount(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	// chain of 5 vertices
+	var g0 Edge
+	for i := 0; i < 5; i++ {
+		opt := vtxOpt{
+			name:  fmt.Sprintf("v%d", i),
+			value: fmt.Sprintf("result%d", i),
+		}
+		if g0.Vertex != nil {
+			opt.inputs = []Edge{g0}
+		}
+		if i == 4 {
+			opt.execDelay = 100 * time.Millisecond
+		}
+		g0 = Edge{Vertex: vtx(opt)}
+	}
+
+	sawActive := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(sawActive)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			inc, out := s.s.EdgeCount()
+			if inc > 0 && out > 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	res, err := j0.Build(ctx, g0)
+	close(done)
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result4")
+	<-sawActive
+
+	require.NoError(t, s.s.WaitForIdle(ctx))
+	inc, out := s.s.EdgeCount()
+	require.Equal(t, 0, inc)
+	require.Equal(t, 0, out)
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestWaitForIdle(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v0",
+			value: "result0",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{
+					name:  "v1",
+					value: "result1",
+				}),
+			}},
+		}),
+	}
+
+	res, err := j0.Build(ctx, g0)
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	require.NoError(t, s.s.WaitForIdle(ctx))
+
+	s.s.mu.Lock()
+	require.Equal(t, 0, len(s.s.incoming))
+	require.Equal(t, 0, len(s.s.outgoing))
+	s.s.mu.Unlock()
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestEdgeCompletionCallback(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	var completed int64
+	s.s.Stop()
+	s.s = newScheduler(s, WithEdgeCompletionCallback(func(e Edge, result CachedResult, err error) {
+		if err == nil && result != nil {
+			atomic.AddInt64(&completed, 1)
+		}
+	}))
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v0",
+			value: "result0",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{
+					name:  "v1",
+					value: "result1",
+				}),
+			}},
+		}),
+	}
+
+	res, err := j0.Build(ctx, g0)
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	// both edges of the two-level graph completed successfully
+	require.Equal(t, int64(2), atomic.LoadInt64(&completed))
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestEdgeResignalMinInterval(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	// replace the scheduler with one that coalesces rapid re-signals
+	s.s.Stop()
+	s.s = newScheduler(s, WithEdgeResignalMinInterval(5*time.Millisecond))
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v0",
+			value: "result0",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{
+					name:  "v1",
+					value: "result1",
+				}),
+			}},
+		}),
+	}
+	g0.Vertex.(*vertex).setupCallCounters()
+
+	res, err := j0.Build(ctx, g0)
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	require.Equal(t, *g0.Vertex.(*vertex).cacheCallCount, int64(2))
+	require.Equal(t, *g0.Vertex.(*vertex).execCallCount, int64(2))
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+type vtxOpt struct {
+	name               string
+	cacheKeySeed       string
+	cacheKeySeeds      []func() string
+	execDelay          time.Duration
+	cacheDelay         time.Duration
+	cachePreFunc       func(context.Context) error
+	execPreFunc        func(context.Context) error
+	inputs             []Edge
+	value              string
+	slowCacheCompute   map[int]ResultBasedCacheFunc
+	slowCachePredicate map[int]ConditionalSlowCacheFunc
+	selectors          map[int]digest.Digest
+	cacheSource        CacheManager
+	ignoreCache        bool
+	operationTimeout   time.Duration
+	maxFanout          int
+	schedulerWeight    int
+	description        map[string]string
+}
+
+func vtx(opt vtxOpt) *vertex {
+	if opt.name == "" {
+		opt.name = identity.NewID()
+	}
+	if opt.cacheKeySeed == "" {
+		opt.cacheKeySeed = identity.NewID()
+	}
+	return &vertex{opt: opt}
+}
+
+type vertex struct {
+	opt vtxOpt
+
+	cacheCallCount *int64
+	execCallCount  *int64
+}
+
+func (v *vertex) Digest() digest.Digest {
+	return digest.FromBytes([]byte(v.opt.name))
+}
+func (v *vertex) Sys() interface{} {
+	return v
+}
+func (v *vertex) Inputs() []Edge {
+	return v.opt.inputs
+}
+func (v *vertex) Name() string {
+	return v.opt.name
+}
+func (v *vertex) Options() VertexOptions {
+	var cache []CacheManager
+	if v.opt.cacheSource != nil {
+		cache = append(cache, v.opt.cacheSource)
+	}
+	return VertexOptions{
+		CacheSources:         cache,
+		IgnoreCache:          v.opt.ignoreCache,
+		OperationTimeout:     v.opt.operationTimeout,
+		MaxFanoutBeforeSplit: v.opt.maxFanout,
+		SchedulerWeight:      v.opt.schedulerWeight,
+		Description:          v.opt.description,
+	}
+}
+
+func (v *vertex) setupCallCounters() {
+	var cacheCount int64
+	var execCount int64
+
+	v.setCallCounters(&cacheCount, &execCount)
+}
+
+func (v *vertex) setCallCounters(cacheCount, execCount *int64) {
+	v.cacheCallCount = cacheCount
+	v.execCallCount = execCount
+
+	for _, inp := range v.opt.inputs {
+		var v *vertex
+		switch vv := inp.Vertex.(type) {
+		case *vertex:
+			v = vv
+		case *vertexSum:
+			v = vv.vertex
+		case *vertexAdd:
+			v = vv.vertex
+		case *vertexConst:
+			v = vv.vertex
+		case *vertexSubBuild:
+			v = vv.vertex
+		}
+		v.setCallCounters(cacheCount, execCount)
+	}
+}
+
+func (v *vertex) cacheMap(ctx context.Context) error {
+	if f := v.opt.cachePreFunc; f != nil {
+		if err := f(ctx); err != nil {
+			return err
+		}
+	}
+	if v.cacheCallCount != nil {
+		atomic.AddInt64(v.cacheCallCount, 1)
+	}
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	default:
+	}
+	select {
+	case <-time.After(v.opt.cacheDelay):
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+func (v *vertex) CacheMap(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
+	if index == 0 {
+		if err := v.cacheMap(ctx); err != nil {
+			return nil, false, err
+		}
+		return v.makeCacheMap(), len(v.opt.cacheKeySeeds) == index, nil
+	}
+	return &CacheMap{
+		Digest: digest.FromBytes([]byte(fmt.Sprintf("seed:%s", v.opt.cacheKeySeeds[index-1]()))),
+	}, len(v.opt.cacheKeySeeds) == index, nil
+}
+
+func (v *vertex) exec(ctx context.Context, inputs []Result) error {
+	if len(inputs) != len(v.Inputs()) {
+		return errors.Errorf("invalid number of inputs")
+	}
+	if f := v.opt.execPreFunc; f != nil {
+		if err := f(ctx); err != nil {
+			return err
+		}
+	}
+	if v.execCallCount != nil {
+		atomic.AddInt64(v.execCallCount, 1)
+	}
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	default:
+	}
+	select {
+	case <-time.After(v.opt.execDelay):
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+func (v *vertex) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
+	if err := v.exec(ctx, inputs); err != nil {
+		return nil, err
+	}
+	return []Result{&dummyResult{id: identity.NewID(), value: v.opt.value}}, nil
+}
+
+func (v *vertex) Acquire(ctx context.Context) (ReleaseFunc, error) {
+	return func() {}, nil
+}
+
+func (v *vertex) makeCacheMap() *CacheMap {
+	m := &CacheMap{
+		Digest: digest.FromBytes([]byte(fmt.Sprintf("seed:%s", v.opt.cacheKeySeed))),
+		Deps: make([]struct {
+			Selector          digest.Digest
+			ComputeDigestFunc ResultBasedCacheFunc
+			PreprocessFunc    PreprocessFunc
+
+			ComputeDigestPredicateFunc ConditionalSlowCacheFunc
+		}, len(v.Inputs())),
+	}
+	for i, f := range v.opt.slowCacheCompute {
+		m.Deps[i].ComputeDigestFunc = f
+	}
+	for i, f := range v.opt.slowCachePredicate {
+		m.Deps[i].ComputeDigestPredicateFunc = f
+	}
+	for i, dgst := range v.opt.selectors {
+		m.Deps[i].Selector = dgst
+	}
+	return m
+}
+
+// vtxConst returns a vertex that outputs a constant integer
+func vtxConst(v int, opt vtxOpt) *vertexConst {
+	if opt.cacheKeySeed == "" {
+		opt.cacheKeySeed = fmt.Sprintf("const-%d", v)
+	}
+	if opt.name == "" {
+		opt.name = opt.cacheKeySeed + "-" + identity.NewID()
+	}
+	return &vertexConst{vertex: vtx(opt), value: v}
+}
+
+type vertexConst struct {
+	*vertex
+	value int
+}
+
+func (v *vertexConst) Sys() interface{} {
+	return v
+}
+
+func (v *vertexConst) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
+	if err := v.exec(ctx, inputs); err != nil {
+		return nil, err
+	}
+	return []Result{&dummyResult{id: identity.NewID(), intValue: v.value}}, nil
+}
+
+func (v *vertexConst) Acquire(ctx context.Context) (ReleaseFunc, error) {
+	return func() {}, nil
+}
+
+// vtxSum returns a vertex that outputs sum of its inputs plus a constant
+func vtxSum(v int, opt vtxOpt) *vertexSum {
+	if opt.cacheKeySeed == "" {
+		opt.cacheKeySeed = fmt.Sprintf("sum-%d-%d", v, len(opt.inputs))
+	}
+	if opt.name == "" {
+		opt.name = opt.cacheKeySeed + "-" + identity.NewID()
+	}
+	return &vertexSum{vertex: vtx(opt), value: v}
+}
+
+type vertexSum struct {
+	*vertex
+	value int
+}
+
+func (v *vertexSum) Sys() interface{} {
+	return v
+}
+
+func (v *vertexSum) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
+	if err := v.exec(ctx, inputs); err != nil {
+		return nil, err
+	}
+	s := v.value
+	for _, inp := range inputs {
+		r, ok := inp.Sys().(*dummyResult)
+		if !ok {
+			return nil, errors.Errorf("invalid input type: %T", inp.Sys())
+		}
+		s += r.intValue
+	}
+	return []Result{&dummyResult{id: identity.NewID(), intValue: s}}, nil
+}
+
+func (v *vertexSum) Acquire(ctx context.Context) (ReleaseFunc, error) {
+	return func() {}, nil
+}
+
+// vtxAdd returns a vertex that outputs each input plus a constant
+func vtxAdd(v int, opt vtxOpt) *vertexAdd {
+	if opt.cacheKeySeed == "" {
+		opt.cacheKeySeed = fmt.Sprintf("add-%d-%d", v, len(opt.inputs))
+	}
+	if opt.name == "" {
+		opt.name = opt.cacheKeySeed + "-" + identity.NewID()
+	}
+	return &vertexAdd{vertex: vtx(opt), value: v}
+}
+
+type vertexAdd struct {
+	*vertex
+	value int
+}
+
+func (v *vertexAdd) Sys() interface{} {
+	return v
+}
+
+func (v *vertexAdd) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
+	if err := v.exec(ctx, inputs); err != nil {
+		return nil, err
+	}
+	for _, inp := range inputs {
+		r, ok := inp.Sys().(*dummyResult)
+		if !ok {
+			return nil, errors.Errorf("invalid input type: %T", inp.Sys())
+		}
+		outputs = append(outputs, &dummyResult{id: identity.NewID(), intValue: r.intValue + v.value})
+	}
+	return outputs, nil
+}
+
+func (v *vertexAdd) Acquire(ctx context.Context) (ReleaseFunc, error) {
+	return func() {}, nil
+}
+
+func vtxSubBuild(g Edge, opt vtxOpt) *vertexSubBuild {
+	if opt.cacheKeySeed == "" {
+		opt.cacheKeySeed = fmt.Sprintf("sub-%s", identity.NewID())
+	}
+	if opt.name == "" {
 		opt.name = opt.cacheKeySeed + "-" + identity.NewID()
 	}
-	return &vertexAdd{vertex: vtx(opt), value: v}
+	return &vertexSubBuild{vertex: vtx(opt), g: g}
+}
+
+type vertexSubBuild struct {
+	*vertex
+	g Edge
+	b Builder
+}
+
+func (v *vertexSubBuild) Sys() interface{} {
+	return v
+}
+
+func (v *vertexSubBuild) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
+	if err := v.exec(ctx, inputs); err != nil {
+		return nil, err
+	}
+	res, err := v.b.Build(ctx, v.g)
+	if err != nil {
+		return nil, err
+	}
+	return []Result{res}, nil
+}
+
+func (v *vertexSubBuild) Acquire(ctx context.Context) (ReleaseFunc, error) {
+	return func() {}, nil
+}
+
+//nolint:unused
+func printGraph(e Edge, pfx string) {
+	name := e.Vertex.Name()
+	fmt.Printf("%s %d %s\n", pfx, e.Index, name)
+	for _, inp := range e.Vertex.Inputs() {
+		printGraph(inp, pfx+"-->")
+	}
+}
+
+type dummyResult struct {
+	id       string
+	value    string
+	intValue int
+}
+
+func (r *dummyResult) ID() string { return r.id }
+func (r *dummyResult) Size(context.Context) (int64, error) {
+	return int64(len(r.value)), nil
+}
+func (r *dummyResult) Release(context.Context) error { return nil }
+func (r *dummyResult) Sys() interface{}              { return r }
+func (r *dummyResult) Clone() Result                 { return r }
+
+func testOpResolver(v Vertex, b Builder) (Op, error) {
+	if op, ok := v.Sys().(Op); ok {
+		if vtx, ok := op.(*vertexSubBuild); ok {
+			vtx.b = b
+		}
+		return op, nil
+	}
+
+	return nil, errors.Errorf("invalid vertex")
+}
+
+func unwrap(res Result) string {
+	r, ok := res.Sys().(*dummyResult)
+	if !ok {
+		return "unwrap-error"
+	}
+	return r.value
+}
+
+func unwrapInt(res Result) int {
+	r, ok := res.Sys().(*dummyResult)
+	if !ok {
+		return -1e6
+	}
+	return r.intValue
+}
+
+func blockingFuncion(i int) func(context.Context) error {
+	limit := int64(i)
+	block := make(chan struct{})
+	return func(context.Context) error {
+		if atomic.AddInt64(&limit, -1) == 0 {
+			close(block)
+		}
+		<-block
+		return nil
+	}
+}
+
+func newTrackingCacheManager(cm CacheManager) *trackingCacheManager {
+	return &trackingCacheManager{CacheManager: cm}
+}
+
+type trackingCacheManager struct {
+	CacheManager
+	loadCounter int64
+	forceFail   bool
+}
+
+func (cm *trackingCacheManager) Load(ctx context.Context, rec *CacheRecord) (Result, error) {
+	atomic.AddInt64(&cm.loadCounter, 1)
+	if cm.forceFail {
+		return nil, errors.Errorf("force fail")
+	}
+	return cm.CacheManager.Load(ctx, rec)
+}
+
+func digestFromResult(ctx context.Context, res Result, _ session.Group) (digest.Digest, error) {
+	return digest.FromBytes([]byte(unwrap(res))), nil
+}
+
+func testExporterOpts(all bool) CacheExportOpt {
+	mode := CacheExportModeMin
+	if all {
+		mode = CacheExportModeMax
+	}
+	return CacheExportOpt{
+		ResolveRemotes: func(ctx context.Context, res Result) ([]*Remote, error) {
+			if dr, ok := res.Sys().(*dummyResult); ok {
+				return []*Remote{{Descriptors: []ocispecs.Descriptor{{
+					Annotations: map[string]string{"value": fmt.Sprintf("%d", dr.intValue)},
+				}}}}, nil
+			}
+			return nil, nil
+		},
+		Mode: mode,
+	}
+}
+
+func newTestExporterTarget() *testExporterTarget {
+	return &testExporterTarget{
+		visited: map[interface{}]struct{}{},
+	}
+}
+
+type testExporterTarget struct {
+	visited map[interface{}]struct{}
+	records []*testExporterRecord
+}
+
+func (t *testExporterTarget) Add(dgst digest.Digest) CacheExporterRecord {
+	r := &testExporterRecord{dgst: dgst}
+	t.records = append(t.records, r)
+	return r
+}
+
+func (t *testExporterTarget) Visit(v interface{}) {
+	t.visited[v] = struct{}{}
+}
+
+func (t *testExporterTarget) Visited(v interface{}) bool {
+	_, ok := t.visited[v]
+	return ok
+}
+
+func (t *testExporterTarget) normalize() {
+	m := map[digest.Digest]struct{}{}
+	rec := make([]*testExporterRecord, 0, len(t.records))
+	for _, r := range t.records {
+		if _, ok := m[r.dgst]; ok {
+			for _, r2 := range t.records {
+				delete(r2.linkMap, r.dgst)
+				r2.links = len(r2.linkMap)
+			}
+			continue
+		}
+		m[r.dgst] = struct{}{}
+		rec = append(rec, r)
+	}
+	t.records = rec
+}
+
+type testExporterRecord struct {
+	dgst    digest.Digest
+	results int
+	links   int
+	linkMap map[digest.Digest]struct{}
+}
+
+func (r *testExporterRecord) AddResult(_ digest.Digest, _ int, createdAt time.Time, result *Remote) {
+	r.results++
+}
+
+func (r *testExporterRecord) LinkFrom(src CacheExporterRecord, index int, selector string) {
+	if s, ok := src.(*testExporterRecord); ok {
+		if r.linkMap == nil {
+			r.linkMap = map[digest.Digest]struct{}{}
+		}
+		if _, ok := r.linkMap[s.dgst]; !ok {
+			r.linkMap[s.dgst] = struct{}{}
+			r.links++
+		}
+	}
 }
 
-type vertexAdd struct {
-	*vertex
-	value int
+func TestMergeSkippedEvent(t *testing.T) {
+	t.Parallel()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	var mu sync.Mutex
+	var events []MergeSkippedEvent
+	s.s.Stop()
+	s.s = newScheduler(s, WithMergeTracing(&recordingProgressWriter{write: func(v interface{}) {
+		if ev, ok := v.(MergeSkippedEvent); ok {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		}
+	}}))
+
+	target := newEdge(Edge{Vertex: vtx(vtxOpt{name: "target"})}, nil, nil)
+	src := newEdge(Edge{Vertex: vtx(vtxOpt{name: "src", ignoreCache: true})}, nil, nil)
+	target.keys = append(target.keys, ExportableCacheKey{})
+
+	// merging an ignore-cache edge into a cache-using target downgrades the
+	// target instead of skipping the merge, and the mismatch is traced
+	require.True(t, s.s.mergeTo(target, src))
+	require.True(t, target.mergedIgnoreCache)
+	require.Len(t, target.keys, 0)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 1)
+	require.Equal(t, MergeSkipIgnoreCacheMismatch, events[0].Reason)
+	require.Equal(t, src.edge.Vertex.Digest(), events[0].Source)
+	require.Equal(t, target.edge.Vertex.Digest(), events[0].Dest)
 }
 
-func (v *vertexAdd) Sys() interface{} {
-	return v
+type recordingProgressWriter struct {
+	write func(interface{})
 }
 
-func (v *vertexAdd) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
-	if err := v.exec(ctx, inputs); err != nil {
-		return nil, err
+func (w *recordingProgressWriter) Write(id string, value interface{}) error {
+	w.write(value)
+	return nil
+}
+
+func (w *recordingProgressWriter) WriteRawProgress(p *progress.Progress) error {
+	w.write(p.Sys)
+	return nil
+}
+
+func (w *recordingProgressWriter) Close() error { return nil }
+
+// TestCancelPropagatesToExec verifies that cancelling the last build request
+// for an edge propagates to the edge's outgoing work, stopping the exec op
+// instead of leaving it running in the background.
+func TestCancelPropagatesToExec(t *testing.T) {
+	t.Parallel()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v0",
+			value: "result0",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{
+					name:  "v1",
+					value: "result1",
+					execPreFunc: func(ctx context.Context) error {
+						close(started)
+						select {
+						case <-ctx.Done():
+							close(cancelled)
+							return context.Cause(ctx)
+						case <-time.After(10 * time.Second):
+							return errors.New("exec was not cancelled")
+						}
+					},
+				}),
+			}},
+		}),
 	}
-	for _, inp := range inputs {
-		r, ok := inp.Sys().(*dummyResult)
-		if !ok {
-			return nil, errors.Errorf("invalid input type: %T", inp.Sys())
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	buildErr := make(chan error, 1)
+	go func() {
+		_, err := j0.Build(ctx, g0)
+		buildErr <- err
+	}()
+
+	<-started
+	cancel(errors.WithStack(context.Canceled))
+
+	select {
+	case err := <-buildErr:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("build did not return after cancellation")
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("exec op did not observe cancellation")
+	}
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestMaxFanoutBeforeSplit(t *testing.T) {
+	t.Parallel()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	target := newEdge(Edge{Vertex: vtx(vtxOpt{name: "target", maxFanout: 2})}, nil, nil)
+	src := newEdge(Edge{Vertex: vtx(vtxOpt{name: "src"})}, nil, nil)
+
+	// two existing consumers on the target plus one on the source exceed the
+	// fan-out limit of two, so the merge is refused
+	s.s.incoming[target] = []*edgePipe{{}, {}}
+	s.s.incoming[src] = []*edgePipe{{}}
+	require.False(t, s.s.mergeTo(target, src))
+
+	// within the limit the merge is performed
+	s.s.incoming[target] = []*edgePipe{{}}
+	require.True(t, s.s.mergeTo(target, src))
+}
+
+func TestConditionalSlowCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
 		}
-		outputs = append(outputs, &dummyResult{id: identity.NewID(), intValue: r.intValue + v.value})
+	}()
+
+	var computeCalled int64
+	slowCache := map[int]ResultBasedCacheFunc{
+		0: func(context.Context, Result, session.Group) (digest.Digest, error) {
+			atomic.AddInt64(&computeCalled, 1)
+			return digest.FromString("slow-key"), nil
+		},
 	}
-	return outputs, nil
+
+	// predicate returns false: the slow cache function must not run
+	res, err := j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v0",
+			value: "result0",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{name: "v1", value: "result1"}),
+			}},
+			slowCacheCompute: slowCache,
+			slowCachePredicate: map[int]ConditionalSlowCacheFunc{
+				0: func(context.Context, Result) (bool, error) { return false, nil },
+			},
+		}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+	require.Equal(t, int64(0), atomic.LoadInt64(&computeCalled))
+
+	// predicate returns true: the slow cache function runs
+	res, err = j0.Build(ctx, Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v2",
+			value: "result2",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{name: "v3", value: "result3"}),
+			}},
+			slowCacheCompute: slowCache,
+			slowCachePredicate: map[int]ConditionalSlowCacheFunc{
+				0: func(context.Context, Result) (bool, error) { return true, nil },
+			},
+		}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result2")
+	require.Equal(t, int64(1), atomic.LoadInt64(&computeCalled))
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestWriteDOTGraph(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v0",
+			value: "result0",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{name: "v1", value: "result1"}),
+			}},
+		}),
+	}
+
+	res, err := j0.Build(ctx, g0)
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, s.WriteDOTGraph(buf))
+	dot := buf.String()
+	require.Contains(t, dot, "digraph buildkit")
+	require.Contains(t, dot, "v0")
+	require.Contains(t, dot, "v1")
+	require.Contains(t, dot, "->")
+	require.Contains(t, dot, "cluster_legend")
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestSchedulerSnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	started := make(chan struct{})
+	var startedOnce sync.Once
+
+	g0 := Edge{
+		Vertex: vtx(vtxOpt{
+			name:  "v0",
+			value: "result0",
+			inputs: []Edge{{
+				Vertex: vtx(vtxOpt{
+					name:  "v1",
+					value: "result1",
+					execPreFunc: func(ctx context.Context) error {
+						startedOnce.Do(func() { close(started) })
+						time.Sleep(50 * time.Millisecond)
+						return nil
+					},
+				}),
+			}},
+		}),
+	}
+
+	buildDone := make(chan struct{})
+	var res CachedResultWithProvenance
+	go func() {
+		defer close(buildDone)
+		res, err = j0.Build(context.TODO(), g0)
+	}()
+
+	// snapshot mid-build, while the dependency exec is in flight, and swap
+	// in a restored scheduler
+	<-started
+	old := s.s
+	state := old.Snapshot()
+	s.s = RestoreScheduler(state, s)
+	old.stoppedOnce.Do(func() { close(old.stopped) })
+
+	select {
+	case <-buildDone:
+	case <-time.After(10 * time.Second):
+		t.Fatal("build did not complete after scheduler restore")
+	}
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
+
+func TestEstimateCost(t *testing.T) {
+	t.Parallel()
+
+	root := diamondGraph("cost")
+	rootEdge := newEdge(root, nil, nil)
+	leftEdge := newEdge(root.Vertex.Inputs()[0], nil, nil)
+	baseEdge := newEdge(root.Vertex.Inputs()[0].Vertex.Inputs()[0], nil, nil)
+
+	// the diamond root with two incomplete deps scores higher than a leaf
+	require.Greater(t, rootEdge.estimateCost(), leftEdge.estimateCost())
+	require.Greater(t, leftEdge.estimateCost(), baseEdge.estimateCost())
+
+	// explicit weights dominate structural cost
+	weighted := newEdge(Edge{Vertex: vtx(vtxOpt{name: "weighted", schedulerWeight: 5})}, nil, nil)
+	require.Greater(t, weighted.estimateCost(), rootEdge.estimateCost())
+}
+
+func TestSerializeGraph(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	res, err := j0.Build(ctx, diamondGraph("ser"))
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result-root")
+
+	g, err := s.SerializeGraph()
+	require.NoError(t, err)
+	require.Len(t, g.Vertexes, 4)
+	require.NotEmpty(t, g.ID)
+
+	dt, err := g.Marshal()
+	require.NoError(t, err)
+	g2, err := DeserializeGraph(dt)
+	require.NoError(t, err)
+	require.Equal(t, g, g2)
+
+	// identical graph content produces the same content-addressed ID
+	g3, err := s.SerializeGraph()
+	require.NoError(t, err)
+	require.Equal(t, g.ID, g3.ID)
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
 }
 
-func (v *vertexAdd) Acquire(ctx context.Context) (ReleaseFunc, error) {
-	return func() {}, nil
-}
+func TestSchedulerPriorityLabel(t *testing.T) {
+	t.Parallel()
 
-func vtxSubBuild(g Edge, opt vtxOpt) *vertexSubBuild {
-	if opt.cacheKeySeed == "" {
-		opt.cacheKeySeed = fmt.Sprintf("sub-%s", identity.NewID())
-	}
-	if opt.name == "" {
-		opt.name = opt.cacheKeySeed + "-" + identity.NewID()
-	}
-	return &vertexSubBuild{vertex: vtx(opt), g: g}
+	high := newEdge(Edge{Vertex: vtx(vtxOpt{
+		name:        "high",
+		description: map[string]string{SchedulerPriorityLabel: "10"},
+	})}, nil, nil)
+	low := newEdge(Edge{Vertex: vtx(vtxOpt{
+		name:        "low",
+		description: map[string]string{SchedulerPriorityLabel: "1"},
+	})}, nil, nil)
+	unlabeled := newEdge(Edge{Vertex: vtx(vtxOpt{name: "unlabeled"})}, nil, nil)
+
+	require.Greater(t, DefaultPriorityFunc(high), DefaultPriorityFunc(low))
+	require.Greater(t, DefaultPriorityFunc(low), DefaultPriorityFunc(unlabeled))
+
+	// the priority queue dispatches the high-priority edge first even when
+	// it was enqueued last
+	var q edgePriorityQueue
+	heap.Push(&q, &prioritizedEdge{e: low, priority: DefaultPriorityFunc(low), seq: 1})
+	heap.Push(&q, &prioritizedEdge{e: unlabeled, priority: DefaultPriorityFunc(unlabeled), seq: 2})
+	heap.Push(&q, &prioritizedEdge{e: high, priority: DefaultPriorityFunc(high), seq: 3})
+
+	require.Same(t, high, heap.Pop(&q).(*prioritizedEdge).e)
+	require.Same(t, low, heap.Pop(&q).(*prioritizedEdge).e)
+	require.Same(t, unlabeled, heap.Pop(&q).(*prioritizedEdge).e)
 }
 
-type vertexSubBuild struct {
-	*vertex
-	g Edge
-	b Builder
-}
+func benchmarkParallelSlowCache(b *testing.B) {
+	ctx := context.TODO()
+	for i := 0; i < b.N; i++ {
+		s := NewSolver(SolverOpt{
+			ResolveOpFunc: testOpResolver,
+		})
 
-func (v *vertexSubBuild) Sys() interface{} {
-	return v
-}
+		j0, err := s.NewJob(fmt.Sprintf("job%d", i))
+		if err != nil {
+			b.Fatal(err)
+		}
 
-func (v *vertexSubBuild) Exec(ctx context.Context, g session.Group, inputs []Result) (outputs []Result, err error) {
-	if err := v.exec(ctx, inputs); err != nil {
-		return nil, err
-	}
-	res, err := v.b.Build(ctx, v.g)
-	if err != nil {
-		return nil, err
+		inputs := make([]Edge, 20)
+		slowCache := map[int]ResultBasedCacheFunc{}
+		for d := range inputs {
+			inputs[d] = Edge{Vertex: vtx(vtxOpt{
+				name:  fmt.Sprintf("b%d-dep%d", i, d),
+				value: fmt.Sprintf("result%d", d),
+			})}
+			slowCache[d] = func(context.Context, Result, session.Group) (digest.Digest, error) {
+				time.Sleep(time.Millisecond)
+				return digest.FromString("slow"), nil
+			}
+		}
+		g := Edge{Vertex: vtx(vtxOpt{
+			name:             fmt.Sprintf("b%d-root", i),
+			value:            "result-root",
+			inputs:           inputs,
+			slowCacheCompute: slowCache,
+		})}
+		g.Vertex.(*vertex).opt.cacheKeySeed = fmt.Sprintf("seed%d", i)
+
+		if _, err := j0.Build(ctx, g); err != nil {
+			b.Fatal(err)
+		}
+		j0.Discard()
+		s.Close()
 	}
-	return []Result{res}, nil
 }
 
-func (v *vertexSubBuild) Acquire(ctx context.Context) (ReleaseFunc, error) {
-	return func() {}, nil
+func BenchmarkSlowCacheParallel(b *testing.B) {
+	benchmarkParallelSlowCache(b)
 }
 
-//nolint:unused
-func printGraph(e Edge, pfx string) {
-	name := e.Vertex.Name()
-	fmt.Printf("%s %d %s\n", pfx, e.Index, name)
-	for _, inp := range e.Vertex.Inputs() {
-		printGraph(inp, pfx+"-->")
-	}
-}
+func TestParallelCacheComputeCounter(t *testing.T) {
+	// not parallel: mutates a process-global counter
+	ctx := context.TODO()
 
-type dummyResult struct {
-	id       string
-	value    string
-	intValue int
-}
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
 
-func (r *dummyResult) ID() string                    { return r.id }
-func (r *dummyResult) Release(context.Context) error { return nil }
-func (r *dummyResult) Sys() interface{}              { return r }
-func (r *dummyResult) Clone() Result                 { return r }
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
 
-func testOpResolver(v Vertex, b Builder) (Op, error) {
-	if op, ok := v.Sys().(Op); ok {
-		if vtx, ok := op.(*vertexSubBuild); ok {
-			vtx.b = b
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	before := ParallelCacheComputeCount()
+
+	inputs := make([]Edge, 8)
+	slowCache := map[int]ResultBasedCacheFunc{}
+	for d := range inputs {
+		inputs[d] = Edge{Vertex: vtx(vtxOpt{
+			name:  fmt.Sprintf("pcc-dep%d", d),
+			value: fmt.Sprintf("result%d", d),
+		})}
+		slowCache[d] = func(context.Context, Result, session.Group) (digest.Digest, error) {
+			time.Sleep(10 * time.Millisecond)
+			return digest.FromString("slow"), nil
 		}
-		return op, nil
 	}
 
-	return nil, errors.Errorf("invalid vertex")
-}
+	res, err := j0.Build(ctx, Edge{Vertex: vtx(vtxOpt{
+		name:             "pcc-root",
+		value:            "result-root",
+		inputs:           inputs,
+		slowCacheCompute: slowCache,
+	})})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result-root")
 
-func unwrap(res Result) string {
-	r, ok := res.Sys().(*dummyResult)
-	if !ok {
-		return "unwrap-error"
-	}
-	return r.value
-}
+	// with 8 slow inputs and the default limit of 8, at least some of the
+	// computations ran concurrently
+	require.Greater(t, ParallelCacheComputeCount(), before)
 
-func unwrapInt(res Result) int {
-	r, ok := res.Sys().(*dummyResult)
-	if !ok {
-		return -1e6
-	}
-	return r.intValue
+	require.NoError(t, j0.Discard())
+	j0 = nil
 }
 
-func blockingFuncion(i int) func(context.Context) error {
-	limit := int64(i)
-	block := make(chan struct{})
-	return func(context.Context) error {
-		if atomic.AddInt64(&limit, -1) == 0 {
-			close(block)
-		}
-		<-block
-		return nil
-	}
-}
+// TestSchedulerPriorityLabelDispatchOrder verifies the production signal path
+// orders queued edges by the BUILDKIT_SCHEDULER_PRIORITY label.
+func TestSchedulerPriorityLabelDispatchOrder(t *testing.T) {
+	t.Parallel()
 
-func newTrackingCacheManager(cm CacheManager) *trackingCacheManager {
-	return &trackingCacheManager{CacheManager: cm}
-}
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
 
-type trackingCacheManager struct {
-	CacheManager
-	loadCounter int64
-	forceFail   bool
+	// the production solver scheduler runs with priority dispatch enabled
+	require.NotNil(t, s.s.priorityFunc)
+
+	// use a stopped scheduler so queued edges can be inspected without the
+	// loop racing the test
+	sched := newScheduler(s, WithPriorityFunc(DefaultPriorityFunc))
+	sched.Stop()
+
+	low := newEdge(Edge{Vertex: vtx(vtxOpt{
+		name:        "low",
+		description: map[string]string{SchedulerPriorityLabel: "1"},
+	})}, nil, nil)
+	high := newEdge(Edge{Vertex: vtx(vtxOpt{
+		name:        "high",
+		description: map[string]string{SchedulerPriorityLabel: "10"},
+	})}, nil, nil)
+	unlabeled := newEdge(Edge{Vertex: vtx(vtxOpt{name: "unlabeled"})}, nil, nil)
+
+	sched.signal(low)
+	sched.signal(unlabeled)
+	sched.signal(high)
+
+	sched.muQ.Lock()
+	defer sched.muQ.Unlock()
+	require.Equal(t, 3, sched.pq.Len())
+	require.Same(t, high, heap.Pop(&sched.pq).(*prioritizedEdge).e)
+	require.Same(t, low, heap.Pop(&sched.pq).(*prioritizedEdge).e)
+	require.Same(t, unlabeled, heap.Pop(&sched.pq).(*prioritizedEdge).e)
 }
 
-func (cm *trackingCacheManager) Load(ctx context.Context, rec *CacheRecord) (Result, error) {
-	atomic.AddInt64(&cm.loadCounter, 1)
-	if cm.forceFail {
-		return nil, errors.Errorf("force fail")
-	}
-	return cm.CacheManager.Load(ctx, rec)
-}
+// BenchmarkManyDependencies exercises the batched input request path with a
+// vertex that has 50 dependencies.
+func BenchmarkManyDependencies(b *testing.B) {
+	ctx := context.TODO()
+	for i := 0; i < b.N; i++ {
+		s := NewSolver(SolverOpt{
+			ResolveOpFunc: testOpResolver,
+		})
 
-func digestFromResult(ctx context.Context, res Result, _ session.Group) (digest.Digest, error) {
-	return digest.FromBytes([]byte(unwrap(res))), nil
-}
+		j0, err := s.NewJob(fmt.Sprintf("job%d", i))
+		if err != nil {
+			b.Fatal(err)
+		}
 
-func testExporterOpts(all bool) CacheExportOpt {
-	mode := CacheExportModeMin
-	if all {
-		mode = CacheExportModeMax
-	}
-	return CacheExportOpt{
-		ResolveRemotes: func(ctx context.Context, res Result) ([]*Remote, error) {
-			if dr, ok := res.Sys().(*dummyResult); ok {
-				return []*Remote{{Descriptors: []ocispecs.Descriptor{{
-					Annotations: map[string]string{"value": fmt.Sprintf("%d", dr.intValue)},
-				}}}}, nil
-			}
-			return nil, nil
-		},
-		Mode: mode,
+		inputs := make([]Edge, 50)
+		for d := range inputs {
+			inputs[d] = Edge{Vertex: vtx(vtxOpt{
+				name:  fmt.Sprintf("b%d-dep%d", i, d),
+				value: fmt.Sprintf("result%d", d),
+			})}
+		}
+		res, err := j0.Build(ctx, Edge{Vertex: vtx(vtxOpt{
+			name:   fmt.Sprintf("b%d-root", i),
+			value:  "result-root",
+			inputs: inputs,
+		})})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if unwrap(res) != "result-root" {
+			b.Fatal("unexpected result")
+		}
+		j0.Discard()
+		s.Close()
 	}
 }
 
-func newTestExporterTarget() *testExporterTarget {
-	return &testExporterTarget{
-		visited: map[interface{}]struct{}{},
-	}
-}
+func TestDOTHandler(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
 
-type testExporterTarget struct {
-	visited map[interface{}]struct{}
-	records []*testExporterRecord
-}
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
 
-func (t *testExporterTarget) Add(dgst digest.Digest) CacheExporterRecord {
-	r := &testExporterRecord{dgst: dgst}
-	t.records = append(t.records, r)
-	return r
-}
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	defer j0.Discard()
 
-func (t *testExporterTarget) Visit(v interface{}) {
-	t.visited[v] = struct{}{}
-}
+	_, err = j0.Build(ctx, Edge{Vertex: vtx(vtxOpt{name: "v0", value: "result0"})})
+	require.NoError(t, err)
 
-func (t *testExporterTarget) Visited(v interface{}) bool {
-	_, ok := t.visited[v]
-	return ok
+	rec := httptest.NewRecorder()
+	s.DOTHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/graph.dot", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/vnd.graphviz", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "digraph buildkit")
+	require.Contains(t, rec.Body.String(), "v0")
 }
 
-func (t *testExporterTarget) normalize() {
-	m := map[digest.Digest]struct{}{}
-	rec := make([]*testExporterRecord, 0, len(t.records))
-	for _, r := range t.records {
-		if _, ok := m[r.dgst]; ok {
-			for _, r2 := range t.records {
-				delete(r2.linkMap, r.dgst)
-				r2.links = len(r2.linkMap)
-			}
-			continue
+func TestCacheExportingFiltered(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	l := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+		DefaultCache:  NewInMemoryCacheManager(),
+	})
+	defer l.Close()
+
+	j0, err := l.NewJob("j0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
 		}
-		m[r.dgst] = struct{}{}
-		rec = append(rec, r)
+	}()
+
+	g0 := Edge{
+		Vertex: vtxSum(1, vtxOpt{
+			inputs: []Edge{
+				{Vertex: vtxConst(2, vtxOpt{})},
+				{Vertex: vtxConst(3, vtxOpt{})},
+			},
+		}),
 	}
-	t.records = rec
-}
 
-type testExporterRecord struct {
-	dgst    digest.Digest
-	results int
-	links   int
-	linkMap map[digest.Digest]struct{}
+	res, err := j0.Build(ctx, g0)
+	require.NoError(t, err)
+	require.Equal(t, unwrapInt(res), 6)
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+
+	// filter out the root vertex: its result is skipped while the key
+	// chain and the dependency records still link up
+	rootDigest := g0.Vertex.Digest()
+	opt := testExporterOpts(true)
+	WithCacheExportFilter(func(v Vertex) bool {
+		return v.Digest() != rootDigest
+	})(&opt)
+
+	expTarget := newTestExporterTarget()
+	_, err = res.CacheKeys()[0].Exporter.ExportTo(ctx, expTarget, opt)
+	require.NoError(t, err)
+
+	expTarget.normalize()
+	require.Equal(t, 3, len(expTarget.records))
+	require.Equal(t, 0, expTarget.records[0].results, "filtered root result is not exported")
+	require.Equal(t, 2, expTarget.records[0].links, "dependency links are preserved")
 }
 
-func (r *testExporterRecord) AddResult(_ digest.Digest, _ int, createdAt time.Time, result *Remote) {
-	r.results++
+// TestPriorityModeComposesWithOtherOptions verifies that re-signal
+// coalescing and group dispatch stay functional when the priority queue is
+// enabled, as it is in the production solver.
+func TestPriorityModeComposesWithOtherOptions(t *testing.T) {
+	t.Parallel()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	sched := newScheduler(s,
+		WithPriorityFunc(DefaultPriorityFunc),
+		WithEdgeResignalMinInterval(time.Minute),
+		WithGroupDispatch(true),
+	)
+	sched.Stop()
+
+	// re-signal coalescing: an edge dispatched moments ago is deferred
+	// instead of entering the priority queue
+	recent := newEdge(Edge{Vertex: vtx(vtxOpt{name: "recent"})}, nil, nil)
+	recent.lastDispatchTime = time.Now()
+	sched.signal(recent)
+
+	sched.muQ.Lock()
+	_, queued := sched.waitq[recent]
+	_, pending := sched.resignalPending[recent]
+	sched.muQ.Unlock()
+	require.False(t, queued, "rapid re-signal must not enter the priority queue")
+	require.True(t, pending, "rapid re-signal is coalesced into a delayed enqueue")
+
+	// group dispatch: edges sharing a cache map digest are popped together
+	// from the priority queue
+	cm := &CacheMap{Digest: digest.FromString("shared-group")}
+	e0 := newEdge(Edge{Vertex: vtx(vtxOpt{name: "g0"})}, nil, nil)
+	e1 := newEdge(Edge{Vertex: vtx(vtxOpt{name: "g1"})}, nil, nil)
+	other := newEdge(Edge{Vertex: vtx(vtxOpt{name: "other"})}, nil, nil)
+	e0.cacheMap, e1.cacheMap = cm, cm
+	other.cacheMap = &CacheMap{Digest: digest.FromString("different")}
+
+	// e0 plays the part of the edge the loop just popped; e1 and other are
+	// still queued
+	sched.signal(e1)
+	sched.signal(other)
+
+	group := sched.popGroup(e0)
+	require.ElementsMatch(t, []*edge{e0, e1}, group)
+
+	sched.muQ.Lock()
+	defer sched.muQ.Unlock()
+	_, e1Queued := sched.waitq[e1]
+	_, otherQueued := sched.waitq[other]
+	require.False(t, e1Queued, "grouped edge is removed from the queue")
+	require.True(t, otherQueued, "unrelated edge stays queued")
+	require.Equal(t, 1, sched.pq.Len())
 }
 
-func (r *testExporterRecord) LinkFrom(src CacheExporterRecord, index int, selector string) {
-	if s, ok := src.(*testExporterRecord); ok {
-		if r.linkMap == nil {
-			r.linkMap = map[digest.Digest]struct{}{}
-		}
-		if _, ok := r.linkMap[s.dgst]; !ok {
-			r.linkMap[s.dgst] = struct{}{}
-			r.links++
-		}
-	}
+// TestMergeIgnoreCacheCompletedTarget verifies that an ignore-cache edge is
+// not merged into a target that already completed, since the downgrade can't
+// retract an already-delivered (possibly cache-loaded) result.
+func TestMergeIgnoreCacheCompletedTarget(t *testing.T) {
+	t.Parallel()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	target := newEdge(Edge{Vertex: vtx(vtxOpt{name: "target"})}, nil, nil)
+	src := newEdge(Edge{Vertex: vtx(vtxOpt{name: "src", ignoreCache: true})}, nil, nil)
+
+	target.result = NewSharedCachedResult(NewCachedResult(&dummyResult{id: "done", value: "done"}, nil))
+	target.execCacheLoad = true
+
+	require.False(t, s.s.mergeTo(target, src))
+	require.False(t, target.mergedIgnoreCache)
 }
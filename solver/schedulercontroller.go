@@ -0,0 +1,35 @@
+package solver
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrEdgeNotFound is returned by SchedulerController.Requeue when the
+// requested vertex is not part of the currently active build graph.
+var ErrEdgeNotFound = errors.New("edge not found in active build graph")
+
+// SchedulerController provides controlled external access to the scheduler,
+// e.g. for cache-invalidation hooks that need to force re-evaluation of a
+// specific edge without being part of the dispatch loop.
+type SchedulerController struct {
+	s  *scheduler
+	ef edgeFactory
+}
+
+// NewSchedulerController returns a controller bound to the solver's shared
+// scheduler.
+func NewSchedulerController(jl *Solver) *SchedulerController {
+	return &SchedulerController{s: jl.s, ef: jl}
+}
+
+// Requeue signals the edge for the given vertex and output index so that it
+// is re-evaluated by the scheduler. ErrEdgeNotFound is returned when the
+// vertex is not loaded in the current build graph.
+func (c *SchedulerController) Requeue(v Vertex, idx Index) error {
+	e := c.ef.getEdge(Edge{Index: idx, Vertex: v})
+	if e == nil {
+		return errors.WithStack(ErrEdgeNotFound)
+	}
+	c.s.signal(e)
+	return nil
+}
@@ -0,0 +1,42 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerControllerRequeue(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	ctrl := NewSchedulerController(s)
+
+	// unknown vertexes are rejected
+	err := ctrl.Requeue(vtx(vtxOpt{name: "unknown"}), 0)
+	require.True(t, errors.Is(err, ErrEdgeNotFound))
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	defer j0.Discard()
+
+	v := vtx(vtxOpt{name: "v0", value: "result0"})
+	res, err := j0.Build(ctx, Edge{Vertex: v})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result0")
+
+	// a loaded vertex can be requeued for re-evaluation
+	loaded, err := s.load(ctx, v, nil, j0)
+	require.NoError(t, err)
+	require.NoError(t, ctrl.Requeue(loaded, 0))
+
+	// the edge settles again after the external signal
+	require.NoError(t, s.s.WaitForIdle(ctx))
+}
@@ -54,6 +54,27 @@ type VertexOptions struct {
 	CacheSources []CacheManager
 	Description  map[string]string // text values with no special meaning for solver
 	ExportCache  *bool
+	// MaxParallelCacheCompute limits how many result-based cache key
+	// computations for this vertex's inputs may run concurrently. Zero
+	// selects the default of 8.
+	MaxParallelCacheCompute int
+	// SchedulerWeight biases the edge cost estimate used by priority
+	// scheduling. Higher weights dispatch earlier. Zero is neutral.
+	SchedulerWeight int
+	// MaxFanoutBeforeSplit limits how many incoming requests a merged edge
+	// for this vertex may accumulate. When a merge would push the number of
+	// consumers above the limit the merge is refused, so an extra copy of
+	// the work runs instead of all consumers sharing one result. Zero means
+	// no limit.
+	MaxFanoutBeforeSplit int
+	// DeterministicCacheKey requests machine-independent cache keys for the
+	// vertex. It is set by loaders that normalize non-deterministic fields
+	// out of the op definition.
+	DeterministicCacheKey bool
+	// OperationTimeout limits the time a single evaluation of the vertex op
+	// (cache map or exec) may take. Zero means no limit. The timeout restarts
+	// for every new attempt.
+	OperationTimeout time.Duration
 	// WorkerConstraint
 	ProgressGroup *pb.ProgressGroup
 }
@@ -112,6 +133,19 @@ type CacheExportOpt struct {
 	CompressionOpt *compression.Config
 	// ExportRoots defines if records for root vertexes should be exported.
 	ExportRoots bool
+	// ExportFilter allows skipping the layer results of specific vertexes
+	// from the export. When it returns false the result for the vertex is
+	// not exported, but its cache key chain and dependencies still are so
+	// that the remaining records keep linking up. Usually set through
+	// WithCacheExportFilter.
+	ExportFilter func(Vertex) bool
+}
+
+// WithCacheExportFilter applies a vertex filter to cache export options
+func WithCacheExportFilter(filter func(Vertex) bool) func(*CacheExportOpt) {
+	return func(opt *CacheExportOpt) {
+		opt.ExportFilter = filter
+	}
 }
 
 // CacheExporter can export the artifacts of the build chain
@@ -179,6 +213,11 @@ type ProvenanceProvider interface {
 type ResultBasedCacheFunc func(context.Context, Result, session.Group) (digest.Digest, error)
 type PreprocessFunc func(context.Context, Result, session.Group) error
 
+// ConditionalSlowCacheFunc decides whether the result based cache function
+// for an input should run at all. Returning false skips the slow cache
+// computation for that input.
+type ConditionalSlowCacheFunc func(context.Context, Result) (bool, error)
+
 // CacheMap is a description for calculating the cache key of an operation.
 type CacheMap struct {
 	// Digest returns a checksum for the operation. The operation result can be
@@ -206,6 +245,10 @@ type CacheMap struct {
 
 		// PreprocessFunc is a function that runs on an input before it is passed to op
 		PreprocessFunc PreprocessFunc
+
+		// ComputeDigestPredicateFunc optionally gates ComputeDigestFunc. If
+		// it returns false the slow cache key for this input is skipped.
+		ComputeDigestPredicateFunc ConditionalSlowCacheFunc
 	}
 
 	// Opts specifies generic options that will be passed to cache load calls if/when
@@ -0,0 +1,158 @@
+package solver
+
+import (
+	"context"
+	"strings"
+
+	"github.com/moby/buildkit/session"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// VertexGroup presents a sequence of vertexes as a single cacheable unit.
+// The group digest combines the digests of all members, so the group is
+// cached together: either every member's work is reflected in a cache hit or
+// the whole group is re-executed. Groups are executed by wrapping the op
+// resolver with ResolveVertexGroups: members run sequentially, each member
+// after the first receiving the previous member's outputs as its inputs.
+// Only the first member's declared inputs are visible to the scheduler.
+type VertexGroup struct {
+	vertices []Vertex
+	dgst     digest.Digest
+}
+
+// NewVertexGroup wraps the given vertexes into a single Vertex. The inputs
+// of the group are the inputs of its first member; subsequent members are
+// expected to consume the results of their predecessors internally.
+func NewVertexGroup(vertices ...Vertex) Vertex {
+	h := strings.Builder{}
+	for _, v := range vertices {
+		h.WriteString(v.Digest().String())
+		h.WriteByte('\n')
+	}
+	return &VertexGroup{
+		vertices: vertices,
+		dgst:     digest.FromBytes([]byte(h.String())),
+	}
+}
+
+// Vertices returns the members of the group in execution order
+func (g *VertexGroup) Vertices() []Vertex {
+	return g.vertices
+}
+
+func (g *VertexGroup) Digest() digest.Digest {
+	return g.dgst
+}
+
+func (g *VertexGroup) Sys() interface{} {
+	return g
+}
+
+func (g *VertexGroup) Options() VertexOptions {
+	var opts VertexOptions
+	for _, v := range g.vertices {
+		vo := v.Options()
+		if vo.IgnoreCache {
+			opts.IgnoreCache = true
+		}
+		if vo.OperationTimeout > opts.OperationTimeout {
+			opts.OperationTimeout = vo.OperationTimeout
+		}
+		if vo.SchedulerWeight > opts.SchedulerWeight {
+			opts.SchedulerWeight = vo.SchedulerWeight
+		}
+		for k, v := range vo.Description {
+			if opts.Description == nil {
+				opts.Description = map[string]string{}
+			}
+			opts.Description[k] = v
+		}
+		opts.CacheSources = append(opts.CacheSources, vo.CacheSources...)
+	}
+	return opts
+}
+
+func (g *VertexGroup) Inputs() []Edge {
+	if len(g.vertices) == 0 {
+		return nil
+	}
+	return g.vertices[0].Inputs()
+}
+
+func (g *VertexGroup) Name() string {
+	names := make([]string, len(g.vertices))
+	for i, v := range g.vertices {
+		names[i] = v.Name()
+	}
+	return "group(" + strings.Join(names, " -> ") + ")"
+}
+
+// ResolveVertexGroups wraps an op resolver so that VertexGroup vertexes are
+// executed as a unit under the group's combined cache key. Non-group
+// vertexes pass through to the wrapped resolver unchanged.
+func ResolveVertexGroups(next ResolveOpFunc) ResolveOpFunc {
+	return func(v Vertex, b Builder) (Op, error) {
+		g, ok := v.Sys().(*VertexGroup)
+		if !ok {
+			return next(v, b)
+		}
+		if len(g.Vertices()) == 0 {
+			return nil, errors.New("cannot resolve empty vertex group")
+		}
+		return &vertexGroupOp{group: g, next: next, builder: b}, nil
+	}
+}
+
+// vertexGroupOp executes the members of a group sequentially, feeding each
+// member the outputs of its predecessor
+type vertexGroupOp struct {
+	group   *VertexGroup
+	next    ResolveOpFunc
+	builder Builder
+}
+
+func (o *vertexGroupOp) CacheMap(ctx context.Context, g session.Group, index int) (*CacheMap, bool, error) {
+	return &CacheMap{
+		Digest: o.group.Digest(),
+		Deps: make([]struct {
+			Selector          digest.Digest
+			ComputeDigestFunc ResultBasedCacheFunc
+			PreprocessFunc    PreprocessFunc
+
+			ComputeDigestPredicateFunc ConditionalSlowCacheFunc
+		}, len(o.group.Inputs())),
+	}, true, nil
+}
+
+func (o *vertexGroupOp) Exec(ctx context.Context, sg session.Group, inputs []Result) ([]Result, error) {
+	cur := inputs
+	for i, member := range o.group.Vertices() {
+		op, err := o.next(member, o.builder)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve op for group member %s", member.Name())
+		}
+		release, err := op.Acquire(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to acquire resources for group member %s", member.Name())
+		}
+		outputs, err := op.Exec(ctx, sg, cur)
+		release()
+		if err != nil {
+			return nil, errors.Wrapf(err, "group member %s failed", member.Name())
+		}
+		if i > 0 {
+			// intermediate results are owned by the group
+			for _, r := range cur {
+				r.Release(context.TODO())
+			}
+		}
+		cur = outputs
+	}
+	return cur, nil
+}
+
+func (o *vertexGroupOp) Acquire(ctx context.Context) (ReleaseFunc, error) {
+	// resources are acquired per member during Exec
+	return func() {}, nil
+}
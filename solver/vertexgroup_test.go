@@ -0,0 +1,73 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVertexGroup(t *testing.T) {
+	v0 := vtx(vtxOpt{name: "v0"})
+	v1 := vtx(vtxOpt{name: "v1"})
+
+	g := NewVertexGroup(v0, v1)
+	g2 := NewVertexGroup(v0, v1)
+	require.Equal(t, g.Digest(), g2.Digest())
+
+	// order matters for the combined key
+	g3 := NewVertexGroup(v1, v0)
+	require.NotEqual(t, g.Digest(), g3.Digest())
+
+	// group digest differs from any member's digest
+	require.NotEqual(t, g.Digest(), v0.Digest())
+	require.NotEqual(t, g.Digest(), v1.Digest())
+
+	require.Equal(t, "group(v0 -> v1)", g.Name())
+	require.Equal(t, []Vertex{Vertex(v0), Vertex(v1)}, g.(*VertexGroup).Vertices())
+}
+
+func TestVertexGroupExecution(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: ResolveVertexGroups(testOpResolver),
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	m1 := vtx(vtxOpt{name: "m1", cacheKeySeed: "seed-m1", value: "result1"})
+	m2 := vtx(vtxOpt{
+		name:         "m2",
+		cacheKeySeed: "seed-m2",
+		value:        "result2",
+		inputs:       []Edge{{Vertex: m1}},
+	})
+	// counters are shared across the member chain: the total counts both
+	// m1 and m2 executions
+	m2.setupCallCounters()
+
+	// the group executes both members and returns the last member's result
+	res, err := j0.Build(ctx, Edge{Vertex: NewVertexGroup(m1, m2)})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result2")
+	require.Equal(t, int64(2), *m2.execCallCount)
+
+	// building the same group again is a single cache hit: no member re-runs
+	res, err = j0.Build(ctx, Edge{Vertex: NewVertexGroup(m1, m2)})
+	require.NoError(t, err)
+	require.Equal(t, unwrap(res), "result2")
+	require.Equal(t, int64(2), *m2.execCallCount)
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+}
@@ -0,0 +1,142 @@
+package solver
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// walRecordSize is the fixed on-disk size of a single WAL record:
+// 96 bytes zero-padded vertex digest, 4 bytes edge index, 8 bytes sequence
+// number and a 4 byte checksum over the preceding fields.
+const walRecordSize = 96 + 4 + 8 + 4
+
+// WALEntry describes a single queued edge recorded in the scheduler WAL.
+type WALEntry struct {
+	Digest digest.Digest
+	Index  Index
+	Seq    uint64
+}
+
+func (e WALEntry) encode() ([]byte, error) {
+	if len(e.Digest) > 96 {
+		return nil, errors.Errorf("digest %q too long for WAL record", e.Digest)
+	}
+	buf := make([]byte, walRecordSize)
+	copy(buf, e.Digest)
+	binary.BigEndian.PutUint32(buf[96:], uint32(e.Index))
+	binary.BigEndian.PutUint64(buf[100:], e.Seq)
+	binary.BigEndian.PutUint32(buf[108:], crc32.ChecksumIEEE(buf[:108]))
+	return buf, nil
+}
+
+func decodeWALEntry(buf []byte) (WALEntry, error) {
+	if len(buf) != walRecordSize {
+		return WALEntry{}, errors.Errorf("invalid WAL record size %d", len(buf))
+	}
+	if crc32.ChecksumIEEE(buf[:108]) != binary.BigEndian.Uint32(buf[108:]) {
+		return WALEntry{}, errors.New("WAL record checksum mismatch")
+	}
+	dgst := buf[:96]
+	for i, b := range dgst {
+		if b == 0 {
+			dgst = dgst[:i]
+			break
+		}
+	}
+	return WALEntry{
+		Digest: digest.Digest(dgst),
+		Index:  Index(binary.BigEndian.Uint32(buf[96:])),
+		Seq:    binary.BigEndian.Uint64(buf[100:]),
+	}, nil
+}
+
+// schedulerWAL is a write-ahead log of scheduler signal events. On daemon
+// restart the recorded entries describe the edges that were queued when the
+// process died so that clients can be asked to resubmit those builds.
+type schedulerWAL struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	seq  uint64
+}
+
+func openSchedulerWAL(path string) (*schedulerWAL, []WALEntry, error) {
+	entries, err := readWALEntries(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open scheduler WAL")
+	}
+	return &schedulerWAL{path: path, f: f}, entries, nil
+}
+
+func readWALEntries(path string) ([]WALEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read scheduler WAL")
+	}
+	defer f.Close()
+
+	var entries []WALEntry
+	buf := make([]byte, walRecordSize)
+	for {
+		if _, err := io.ReadFull(f, buf); err != nil {
+			// a short trailing record means the previous process died
+			// mid-write; drop it
+			break
+		}
+		e, err := decodeWALEntry(buf)
+		if err != nil {
+			// damaged record, everything after it is suspect
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// append records a signal event for the given edge
+func (w *schedulerWAL) append(dgst digest.Digest, index Index) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	buf, err := WALEntry{Digest: dgst, Index: index, Seq: w.seq}.encode()
+	if err != nil {
+		return err
+	}
+	if _, err := w.f.Write(buf); err != nil {
+		return errors.Wrap(err, "failed to append to scheduler WAL")
+	}
+	return nil
+}
+
+// compact truncates the log. Called when the wait queue has fully drained, at
+// which point none of the recorded entries are pending anymore.
+func (w *schedulerWAL) compact() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.f.Truncate(0); err != nil {
+		return errors.Wrap(err, "failed to compact scheduler WAL")
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to compact scheduler WAL")
+	}
+	return nil
+}
+
+func (w *schedulerWAL) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
@@ -0,0 +1,84 @@
+package solver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALEntryRoundTrip(t *testing.T) {
+	e := WALEntry{
+		Digest: digest.FromBytes([]byte("v0")),
+		Index:  Index(3),
+		Seq:    42,
+	}
+	buf, err := e.encode()
+	require.NoError(t, err)
+	require.Len(t, buf, walRecordSize)
+
+	dec, err := decodeWALEntry(buf)
+	require.NoError(t, err)
+	require.Equal(t, e, dec)
+
+	// corruption is detected
+	buf[10] ^= 0xff
+	_, err = decodeWALEntry(buf)
+	require.Error(t, err)
+}
+
+func TestWALRecoveryAndCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.wal")
+
+	wal, recovered, err := openSchedulerWAL(path)
+	require.NoError(t, err)
+	require.Empty(t, recovered)
+
+	d0 := digest.FromBytes([]byte("v0"))
+	d1 := digest.FromBytes([]byte("v1"))
+	require.NoError(t, wal.append(d0, 0))
+	require.NoError(t, wal.append(d1, 1))
+	require.NoError(t, wal.close())
+
+	// reopening recovers the unprocessed entries in order
+	wal, recovered, err = openSchedulerWAL(path)
+	require.NoError(t, err)
+	require.Len(t, recovered, 2)
+	require.Equal(t, d0, recovered[0].Digest)
+	require.Equal(t, Index(0), recovered[0].Index)
+	require.Equal(t, d1, recovered[1].Digest)
+	require.Equal(t, Index(1), recovered[1].Index)
+
+	// compaction truncates the log
+	require.NoError(t, wal.append(d0, 0))
+	require.NoError(t, wal.compact())
+	require.NoError(t, wal.close())
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), fi.Size())
+}
+
+func TestSolverRecoversWALEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.wal")
+
+	// simulate a crashed process that left queued entries behind
+	wal, _, err := openSchedulerWAL(path)
+	require.NoError(t, err)
+	d0 := digest.FromBytes([]byte("crashed-v0"))
+	require.NoError(t, wal.append(d0, 0))
+	require.NoError(t, wal.close())
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc:    testOpResolver,
+		SchedulerWALPath: path,
+	})
+	defer s.Close()
+
+	recovered := s.RecoveredWALEntries()
+	require.Len(t, recovered, 1)
+	require.Equal(t, d0, recovered[0].Digest)
+	require.Equal(t, Index(0), recovered[0].Index)
+}
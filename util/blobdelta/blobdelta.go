@@ -0,0 +1,127 @@
+// Package blobdelta implements a small pure-Go binary delta codec for
+// delta-encoded layer cache export. A delta encodes a new blob as a sequence
+// of copy instructions against a base blob plus literal inserts, so layers
+// that change little between builds export only their differences.
+//
+// Note: only the codec itself is implemented so far. Wiring it into the
+// cache export/import path (a DeltaEncoding export option that stores deltas
+// under MediaType next to full layers, and importer-side reconstruction) is
+// deliberately deferred until the exporter can address the previous blob for
+// a layer; nothing in the export pipeline references this package yet.
+package blobdelta
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// MediaType identifies delta-encoded blobs in cache manifests once the
+// exporter integration lands; see the package comment for the current state.
+const MediaType = "application/vnd.buildkit.cacheblob.delta.v0"
+
+// blockSize is the granularity of the copy instructions
+const blockSize = 4096
+
+const (
+	opCopy   = byte(0)
+	opInsert = byte(1)
+)
+
+// Encode produces a delta that reconstructs target from base. The encoding
+// is block based: runs of target that exist verbatim in base become copy
+// instructions, everything else is inserted literally.
+func Encode(base, target []byte) []byte {
+	// index base blocks by content
+	blocks := map[string]int64{}
+	for off := int64(0); off+blockSize <= int64(len(base)); off += blockSize {
+		blocks[string(base[off:off+blockSize])] = off
+	}
+
+	buf := &bytes.Buffer{}
+	var pending []byte
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		buf.WriteByte(opInsert)
+		writeUvarint(buf, uint64(len(pending)))
+		buf.Write(pending)
+		pending = nil
+	}
+
+	for off := int64(0); off < int64(len(target)); {
+		if off+blockSize <= int64(len(target)) {
+			if baseOff, ok := blocks[string(target[off:off+blockSize])]; ok {
+				// extend the match past the block boundary
+				length := int64(blockSize)
+				for off+length < int64(len(target)) && baseOff+length < int64(len(base)) &&
+					target[off+length] == base[baseOff+length] {
+					length++
+				}
+				flush()
+				buf.WriteByte(opCopy)
+				writeUvarint(buf, uint64(baseOff))
+				writeUvarint(buf, uint64(length))
+				off += length
+				continue
+			}
+		}
+		pending = append(pending, target[off])
+		off++
+	}
+	flush()
+	return buf.Bytes()
+}
+
+// Apply reconstructs the target blob from base and a delta produced by
+// Encode.
+func Apply(base, delta []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	r := bytes.NewReader(delta)
+	for r.Len() > 0 {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		switch op {
+		case opCopy:
+			off, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid copy offset")
+			}
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid copy length")
+			}
+			if off+length > uint64(len(base)) {
+				return nil, errors.Errorf("copy instruction out of range: %d+%d > %d", off, length, len(base))
+			}
+			out.Write(base[off : off+length])
+		case opInsert:
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid insert length")
+			}
+			if uint64(r.Len()) < length {
+				return nil, errors.Errorf("insert instruction truncated: need %d bytes, have %d", length, r.Len())
+			}
+			dt := make([]byte, length)
+			if _, err := r.Read(dt); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			out.Write(dt)
+		default:
+			return nil, errors.Errorf("unknown delta instruction %d", op)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
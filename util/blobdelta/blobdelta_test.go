@@ -0,0 +1,61 @@
+package blobdelta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1)) //nolint:gosec
+	base := make([]byte, 512*1024)
+	_, err := rnd.Read(base)
+	require.NoError(t, err)
+
+	// a small modification in the middle of an otherwise identical blob
+	target := append([]byte(nil), base...)
+	copy(target[200000:], []byte("changed bytes in the middle"))
+	target = append(target, []byte("trailing addition")...)
+
+	delta := Encode(base, target)
+	// the delta is much smaller than the full blob
+	require.Less(t, len(delta), len(target)/10)
+
+	restored, err := Apply(base, delta)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(target, restored))
+}
+
+func TestDeltaUnrelatedBlobs(t *testing.T) {
+	base := []byte("completely different")
+	target := bytes.Repeat([]byte("new content "), 1000)
+
+	delta := Encode(base, target)
+	restored, err := Apply(base, delta)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(target, restored))
+}
+
+func TestDeltaCorruption(t *testing.T) {
+	base := bytes.Repeat([]byte("base"), 4096)
+	delta := Encode(base, base)
+
+	_, err := Apply(base[:10], delta)
+	require.Error(t, err)
+}
+
+func BenchmarkDeltaEncode(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1)) //nolint:gosec
+	base := make([]byte, 4*1024*1024)
+	rnd.Read(base) //nolint:errcheck
+	target := append([]byte(nil), base...)
+	copy(target[1024*1024:], []byte("application layer change"))
+
+	b.ResetTimer()
+	b.SetBytes(int64(len(target)))
+	for i := 0; i < b.N; i++ {
+		Encode(base, target)
+	}
+}
@@ -0,0 +1,106 @@
+// Package cacheinvalidation provides helpers for invalidating solver cache
+// entries when external inputs change without a rebuild.
+package cacheinvalidation
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/bklog"
+)
+
+// FileWatcher polls registered files and invalidates the associated cache
+// keys through the hook when a file's modification time changes.
+type FileWatcher struct {
+	hook     solver.CacheInvalidationHook
+	interval time.Duration
+
+	mu    sync.Mutex
+	files map[string]*watchedFile
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+type watchedFile struct {
+	modTime time.Time
+	keys    []*solver.CacheKey
+}
+
+// NewFileWatcher creates a watcher that polls at the given interval. A
+// non-positive interval selects one second.
+func NewFileWatcher(hook solver.CacheInvalidationHook, interval time.Duration) *FileWatcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	w := &FileWatcher{
+		hook:     hook,
+		interval: interval,
+		files:    map[string]*watchedFile{},
+		stop:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Watch registers cache keys to invalidate when the file at path changes
+func (w *FileWatcher) Watch(path string, keys ...*solver.CacheKey) {
+	var modTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime()
+	}
+	w.mu.Lock()
+	if f, ok := w.files[path]; ok {
+		f.keys = append(f.keys, keys...)
+	} else {
+		w.files[path] = &watchedFile{modTime: modTime, keys: keys}
+	}
+	w.mu.Unlock()
+}
+
+func (w *FileWatcher) run() {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+		}
+		w.poll()
+	}
+}
+
+func (w *FileWatcher) poll() {
+	var invalidate []*solver.CacheKey
+	w.mu.Lock()
+	for path, f := range w.files {
+		fi, err := os.Stat(path)
+		var modTime time.Time
+		if err == nil {
+			modTime = fi.ModTime()
+		}
+		if modTime != f.modTime {
+			f.modTime = modTime
+			invalidate = append(invalidate, f.keys...)
+		}
+	}
+	w.mu.Unlock()
+
+	if len(invalidate) == 0 {
+		return
+	}
+	if err := w.hook.Invalidate(context.TODO(), invalidate); err != nil {
+		bklog.G(context.TODO()).WithError(err).Warn("failed to invalidate cache entries for changed files")
+	}
+}
+
+// Close stops the watcher
+func (w *FileWatcher) Close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
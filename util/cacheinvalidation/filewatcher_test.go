@@ -0,0 +1,59 @@
+package cacheinvalidation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/solver"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHook struct {
+	mu   sync.Mutex
+	keys []*solver.CacheKey
+}
+
+func (h *recordingHook) Invalidate(ctx context.Context, keys []*solver.CacheKey) error {
+	h.mu.Lock()
+	h.keys = append(h.keys, keys...)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *recordingHook) invalidated() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.keys)
+}
+
+func TestFileWatcherInvalidatesOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.txt")
+	require.NoError(t, os.WriteFile(path, []byte("v1"), 0644))
+
+	hook := &recordingHook{}
+	w := NewFileWatcher(hook, 10*time.Millisecond)
+	defer w.Close()
+
+	key := solver.NewCacheKey(digest.FromString("op"), digest.FromString("vtx"), 0)
+	w.Watch(path, key)
+
+	// no change, no invalidation
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 0, hook.invalidated())
+
+	// changing the file triggers invalidation of the registered key
+	require.NoError(t, os.WriteFile(path, []byte("v2"), 0644))
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for hook.invalidated() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.GreaterOrEqual(t, hook.invalidated(), 1)
+}
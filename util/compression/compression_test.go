@@ -0,0 +1,42 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	cdcompression "github.com/containerd/containerd/archive/compression"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("buildkit layer data\n"), 1024)
+	origDigest := digest.FromBytes(payload)
+
+	for _, typ := range []Type{Uncompressed, Gzip, Zstd} {
+		t.Run(typ.String(), func(t *testing.T) {
+			comp := New(typ)
+			compressorFunc, _ := typ.Compress(context.TODO(), comp)
+
+			buf := &bytes.Buffer{}
+			w, err := compressorFunc(buf, typ.MediaType())
+			require.NoError(t, err)
+			_, err = w.Write(payload)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			if typ != Uncompressed {
+				require.Less(t, buf.Len(), len(payload))
+			}
+
+			r, err := cdcompression.DecompressStream(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			defer r.Close()
+			dt, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, origDigest, digest.FromBytes(dt))
+		})
+	}
+}
@@ -33,6 +33,20 @@ func (wr *WorkerRef) Release(ctx context.Context) error {
 	return wr.ImmutableRef.Release(ctx)
 }
 
+// Size returns the storage size of the underlying snapshot, when the ref
+// implementation can compute it.
+func (wr *WorkerRef) Size(ctx context.Context) (int64, error) {
+	if wr.ImmutableRef == nil {
+		return 0, nil
+	}
+	if s, ok := wr.ImmutableRef.(interface {
+		Size(context.Context) (int64, error)
+	}); ok {
+		return s.Size(ctx)
+	}
+	return 0, nil
+}
+
 // GetRemotes method abstracts ImmutableRef's GetRemotes to allow a Worker to override.
 // This is needed for moby integration.
 // Use this method instead of calling ImmutableRef.GetRemotes() directly.